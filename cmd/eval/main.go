@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/eval"
+
+	"github.com/joho/godotenv"
+)
+
+// eval plays scripted conversations with the NPCs and reports how their replies score.
+// AI_PROVIDER=fake plays back the suite's fake replies, so it can run in CI.
+func main() {
+	suitePath := flag.String("suite", "internal/config/evals", "suite file, or a directory of them")
+	out := flag.String("out", "eval-report", "report path, .json and .html are added")
+	baselinePath := flag.String("baseline", "", "earlier JSON report to compare against")
+	useJudge := flag.Bool("judge", false, "also have a model rate each conversation")
+	promptVersion := flag.String("prompt-version", os.Getenv("PROMPT_VERSION"), "prompt template version")
+	promptsDir := flag.String("prompts-dir", os.Getenv("PROMPTS_DIR"), "load prompt templates from disk instead of the binary")
+	minScore := flag.Float64("min-score", 0, "exit with 1 when fewer than this share of checks pass")
+	failOnRegression := flag.Bool("fail-on-regression", false, "exit with 1 when a turn passing in the baseline fails")
+	flag.Parse()
+
+	// The .env file is optional, CI sets the environment directly
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Printf("Could not load .env file: %v", err)
+	}
+
+	npcs, err := npc.LoadNPCConfig("internal/config/npc.json")
+	if err != nil {
+		log.Fatalf("Cannot Load NPC Config: %v", err)
+	}
+	npcPhoneNumbers := npc.BuildPhoneIndex(npcs)
+
+	suite, err := eval.Load(*suitePath)
+	if err != nil {
+		log.Fatalf("Cannot Load Suite: %v", err)
+	}
+	if err := suite.Check(npcs); err != nil {
+		log.Fatalf("Invalid Suite: %v", err)
+	}
+
+	// Without a script the fake provider plays back the suite's own replies
+	var provider ai.Provider
+	if os.Getenv("AI_PROVIDER") == ai.ProviderFake && os.Getenv("AI_FAKE_SCRIPT") == "" {
+		provider = ai.NewFakeProvider(suite.FakeReplies()...)
+	} else if provider, err = ai.NewProviderFromEnv(); err != nil {
+		log.Fatalf("AI Provider Error: %v", err)
+	}
+
+	aiHandler := ai.NewAIHandler(provider, &npcs, &npcPhoneNumbers)
+	promptSet, err := prompts.Load(*promptVersion, *promptsDir)
+	if err != nil {
+		log.Fatalf("Cannot Load Prompts: %v", err)
+	}
+	aiHandler.SetPrompts(promptSet)
+
+	// Same defense as the server, without recording detections
+	injectionConfig, err := ai.LoadInjectionConfig("internal/config/injection.json")
+	if err != nil {
+		log.Fatalf("Cannot Load Injection Config: %v", err)
+	}
+	detector, err := ai.NewRuleInjectionDetector(injectionConfig)
+	if err != nil {
+		log.Fatalf("Invalid Injection Config: %v", err)
+	}
+	aiHandler.SetInjectionDefense(detector, injectionConfig, nil)
+
+	var judge *eval.Judge
+	if *useJudge {
+		// The judge's calls would take the fake replies meant for the NPCs
+		if provider.Name() == ai.ProviderFake {
+			log.Printf("The fake provider can't judge, only running the rule checks")
+		} else {
+			judge = eval.NewJudge(aiHandler)
+		}
+	}
+
+	report := eval.NewRunner(aiHandler, &npcs, judge).Run(suite)
+	report.Provider = provider.Name()
+	report.PromptVersion = promptSet.Version()
+
+	if *baselinePath != "" {
+		baseline, err := eval.LoadReport(*baselinePath)
+		if err != nil {
+			log.Fatalf("Cannot Load Baseline: %v", err)
+		}
+		report.Compare(baseline)
+	}
+
+	if err := report.WriteJSON(*out + ".json"); err != nil {
+		log.Fatalf("Cannot Write Report: %v", err)
+	}
+	if err := report.WriteHTML(*out + ".html"); err != nil {
+		log.Fatalf("Cannot Write Report: %v", err)
+	}
+
+	log.Printf("%s: %d of %d checks passed (%.1f%%), report in %s.html", report.Suite, report.Summary.Passed, report.Summary.Checks, report.Summary.Score*100, *out)
+
+	failed := false
+	if report.Summary.Score < *minScore {
+		log.Printf("Score is below %.1f%%", *minScore*100)
+		failed = true
+	}
+	if report.Baseline != nil {
+		for _, key := range report.Baseline.Regressions {
+			log.Printf("Regression: %s", key)
+		}
+		if *failOnRegression && len(report.Baseline.Regressions) > 0 {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
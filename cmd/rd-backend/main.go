@@ -4,10 +4,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"rd-backend/internal/actions"
 	"rd-backend/internal/ai"
 	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/ai/tools"
 	"rd-backend/internal/api"
+	"rd-backend/internal/clock"
 	"rd-backend/internal/db"
+	"rd-backend/internal/events"
+	"rd-backend/internal/gossip"
+	"rd-backend/internal/lore"
+	"rd-backend/internal/memory"
+	"rd-backend/internal/quests"
+	"rd-backend/internal/ratelimit"
+	"rd-backend/internal/relationships"
+	"rd-backend/internal/scene"
+	"rd-backend/internal/texting"
 	"rd-backend/internal/ws"
 
 	"github.com/gin-gonic/gin"
@@ -39,6 +52,15 @@ func main() {
 	}
 	npcPhoneNumbers := npc.BuildPhoneIndex(npcs)
 
+	// NPC Tools
+	toolConfig, err := tools.LoadToolConfig("internal/config/tools.json")
+	if err != nil {
+		log.Fatalf("Cannot Load Tool Config: %v", err)
+	}
+	if err := toolConfig.CheckNPCs(npcs); err != nil {
+		log.Fatalf("Invalid NPC Tools: %v", err)
+	}
+
 	// Database
 	dbHandler, err := db.NewDBHandler()
 	if err != nil {
@@ -47,15 +69,170 @@ func main() {
 	defer dbHandler.Disconnect()
 
 	// AI
-	aiHandler := ai.NewAIHandler(&npcs, &npcPhoneNumbers)
+	provider, err := ai.NewProviderFromEnv()
+	if err != nil {
+		log.Fatalf("AI Provider Error: %v", err)
+	}
+	aiHandler := ai.NewAIHandler(provider, &npcs, &npcPhoneNumbers)
+
+	// Relationships, RELATIONSHIP_JUDGE=llm judges exchanges with a model instead of word lists
+	relationshipConfig, err := relationships.LoadConfig("internal/config/relationships.json")
+	if err != nil {
+		log.Fatalf("Cannot Load Relationship Config: %v", err)
+	}
+	var judge relationships.Judge = relationships.NewRuleJudge(relationshipConfig.Exchange)
+	if os.Getenv("RELATIONSHIP_JUDGE") == "llm" {
+		judge = relationships.NewLLMJudge(aiHandler)
+	}
+	tracker := relationships.NewTracker(dbHandler, &npcs, relationshipConfig, judge)
+	aiHandler.SetRelationshipStore(dbHandler)
+
+	// Quests, NPCs write them from their goals and events move them along
+	questConfig, err := quests.LoadConfig("internal/config/quests.json")
+	if err != nil {
+		log.Fatalf("Cannot Load Quest Config: %v", err)
+	}
+	questBoard := quests.NewBoard(dbHandler, aiHandler, &npcs, *questConfig)
+	aiHandler.SetQuestStore(dbHandler)
+
+	aiHandler.SetTools(toolConfig, actions.NewActionHandler(dbHandler, tracker, questBoard))
+	aiHandler.SetUsageStore(dbHandler)
+
+	// Game time as the clients report it, NPC schedules follow it
+	gameClock := clock.New()
+	aiHandler.SetClock(gameClock)
+	if os.Getenv("EXPRESSION_TAGGING") != "off" {
+		aiHandler.SetExpressionTagger(ai.NewLLMExpressionTagger(aiHandler))
+	}
+
+	// Prompt templates, PROMPTS_DIR loads them from disk instead of the binary
+	promptsDir := os.Getenv("PROMPTS_DIR")
+	promptSet, err := prompts.Load(os.Getenv("PROMPT_VERSION"), promptsDir)
+	if err != nil {
+		log.Fatalf("Cannot Load Prompts: %v", err)
+	}
+	aiHandler.SetPrompts(promptSet)
+
+	// Moderation, MODERATION_LLM=true adds a model check after the rules
+	moderationConfig, err := ai.LoadModerationConfig("internal/config/moderation.json")
+	if err != nil {
+		log.Fatalf("Cannot Load Moderation Config: %v", err)
+	}
+	ruleModerator, err := ai.NewRuleModerator(moderationConfig)
+	if err != nil {
+		log.Fatalf("Invalid Moderation Config: %v", err)
+	}
+	moderator := ai.ChainModerator{ruleModerator}
+	if os.Getenv("MODERATION_LLM") == "true" {
+		moderator = append(moderator, ai.NewLLMModerator(aiHandler))
+	}
+	aiHandler.SetModeration(moderator, dbHandler)
+
+	// Prompt injection and out-of-character replies, INJECTION_LLM=true adds a model check after the rules
+	injectionConfig, err := ai.LoadInjectionConfig("internal/config/injection.json")
+	if err != nil {
+		log.Fatalf("Cannot Load Injection Config: %v", err)
+	}
+	ruleDetector, err := ai.NewRuleInjectionDetector(injectionConfig)
+	if err != nil {
+		log.Fatalf("Invalid Injection Config: %v", err)
+	}
+	detector := ai.ChainInjectionDetector{ruleDetector}
+	if os.Getenv("INJECTION_LLM") == "true" {
+		detector = append(detector, ai.NewLLMInjectionDetector(aiHandler))
+	}
+	aiHandler.SetInjectionDefense(detector, injectionConfig, dbHandler)
+
+	// Long-term memory
+	embedder, err := ai.NewEmbedderFromEnv()
+	if err != nil {
+		log.Fatalf("Embedder Error: %v", err)
+	}
+	aiHandler.SetMemoryStore(embedder, dbHandler)
+	summarizer := memory.NewSummarizer(dbHandler, aiHandler)
+	indexer := memory.NewIndexer(dbHandler, embedder)
+
+	// Lore, LORE_EMBEDDINGS=true ranks by embeddings as well as keywords. Leave it off with
+	// the hashing embedder, it only matches words and BM25 does that better.
+	loreDir := os.Getenv("LORE_DIR")
+	if loreDir == "" {
+		loreDir = "internal/config/lore"
+	}
+	loreChunks, err := lore.Load(loreDir)
+	if err != nil {
+		log.Fatalf("Cannot Load Lore: %v", err)
+	}
+	if err := lore.CheckNPCs(loreChunks, npcs); err != nil {
+		log.Fatalf("Invalid Lore: %v", err)
+	}
+	var loreEmbedder ai.Embedder
+	if os.Getenv("LORE_EMBEDDINGS") == "true" {
+		loreEmbedder = embedder
+	}
+	loreIndex, err := lore.NewIndex(loreChunks, loreEmbedder)
+	if err != nil {
+		log.Fatalf("Lore Index Error: %v", err)
+	}
+	aiHandler.SetLore(loreIndex)
+
+	// Rate limits, RATE_LIMIT_STORE=postgres shares them between instances
+	limitConfig, err := ratelimit.LoadConfig("internal/config/limits.json")
+	if err != nil {
+		log.Fatalf("Cannot Load Limit Config: %v", err)
+	}
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+		limitStore = dbHandler
+	}
+	limiter := ratelimit.NewTokenBucketLimiter(limitStore, *limitConfig)
+
+	// Event descriptions, types without a template are described by the model
+	eventTemplates, err := events.LoadTemplates("internal/config/events.json")
+	if err != nil {
+		log.Fatalf("Cannot Load Event Templates: %v", err)
+	}
+	eventRegistry, err := events.NewRegistry(eventTemplates, aiHandler)
+	if err != nil {
+		log.Fatalf("Invalid Event Templates: %v", err)
+	}
+
+	// Gossip, NPCs only know what they saw or were told
+	gossipConfig, err := gossip.LoadConfig("internal/config/gossip.json")
+	if err != nil {
+		log.Fatalf("Cannot Load Gossip Config: %v", err)
+	}
+	if err := gossipConfig.Check(npcs); err != nil {
+		log.Fatalf("Invalid Gossip Config: %v", err)
+	}
+	gossipNetwork := gossip.NewNetwork(dbHandler, aiHandler, indexer, &npcs, gameClock, *gossipConfig)
+	aiHandler.SetKnowledgeStore(dbHandler)
+	gossipNetwork.Start()
+
+	// Group conversations, GROUP_DIRECTOR=llm lets a model decide who chimes in
+	var director scene.Director = scene.RuleDirector{}
+	if os.Getenv("GROUP_DIRECTOR") == "llm" {
+		director = scene.NewLLMDirector(aiHandler)
+	}
+	scenes := scene.NewOrchestrator(dbHandler, aiHandler, summarizer, indexer, &npcs, director, scene.DefaultMaxTurns)
 
 	// Websockets
-	wsHandler := ws.NewWebsocketHandler(dbHandler, aiHandler)
+	wsHandler := ws.NewWebsocketHandler(dbHandler, aiHandler, summarizer, indexer, limiter, eventRegistry, tracker, gossipNetwork, scenes, gameClock, questBoard)
 	router.GET("/ws", wsHandler.Handle)
 
-	//Texting TODO
-	textingHandler := api.NewTextingHandler(dbHandler, aiHandler)
-	//go textingHandler.SendSMSBasic()
+	// Texting, NPC_TEXTING=off stops NPCs from texting players first
+	textingHandler := api.NewTextingHandler(dbHandler, aiHandler, limiter)
+	textingConfig, err := texting.LoadConfig("internal/config/texting.json")
+	if err != nil {
+		log.Fatalf("Cannot Load Texting Config: %v", err)
+	}
+	switch {
+	case os.Getenv("NPC_TEXTING") == "off":
+	case !textingHandler.CanSend():
+		// Texts would be written, paid for and then fail to send
+		log.Printf("Twilio isn't configured, NPCs won't text players first")
+	default:
+		texting.NewScheduler(dbHandler, aiHandler, &npcs, gameClock, textingHandler, *textingConfig).Start()
+	}
 
 	// API
 	apiHandler := api.NewAPIHandler(dbHandler)
@@ -66,6 +243,32 @@ func main() {
 	router.POST("/sms/receive", textingHandler.ReceiveSMS)
 	//router.POST("/test-ai", apiHandler.TestAIMessage)
 
+	npcHandler := api.NewNPCHandler(&npcs, gameClock)
+	router.GET("/npcs/whereabouts", npcHandler.GetAllWhereabouts)
+	router.GET("/npcs/:npc_id/whereabouts", npcHandler.GetWhereabouts)
+
+	relationshipHandler := api.NewRelationshipHandler(tracker)
+	router.GET("/relationships/:unity_id", relationshipHandler.GetRelationships)
+	router.GET("/relationships/:unity_id/:npc_id", relationshipHandler.GetRelationship)
+
+	questHandler := api.NewQuestHandler(questBoard)
+	router.GET("/quests/:unity_id", questHandler.GetQuests)
+
+	// Admin, needs ADMIN_TOKEN in the X-Admin-Token header
+	admin := router.Group("/admin", api.RequireAdminToken(os.Getenv("ADMIN_TOKEN")))
+	admin.GET("/usage", apiHandler.GetUsage)
+	admin.GET("/usage/:unity_id", apiHandler.GetPlayerUsage)
+	admin.GET("/flags", apiHandler.GetFlagCounts)
+	admin.GET("/flags/:unity_id", apiHandler.GetPlayerFlagCounts)
+
+	promptHandler := api.NewPromptHandler(aiHandler, promptsDir)
+	admin.GET("/prompts", promptHandler.GetPrompts)
+	admin.POST("/prompts/preview", promptHandler.PreviewPrompt)
+	admin.POST("/prompts/reload", promptHandler.ReloadPrompts)
+
+	loreHandler := api.NewLoreHandler(loreIndex)
+	admin.GET("/lore/search", loreHandler.SearchLore)
+
 	fmt.Println("Server Running On Port " + port)
 	router.Run(":" + port)
 }
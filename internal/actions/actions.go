@@ -0,0 +1,106 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"rd-backend/internal/db"
+	"rd-backend/internal/quests"
+	"rd-backend/internal/relationships"
+	"rd-backend/internal/types"
+	"slices"
+	"strings"
+)
+
+// ActionHandler carries out the server-side part of NPC game actions.
+// Actions that only matter to the Unity client are acknowledged and forwarded as they are.
+type ActionHandler struct {
+	dbHandler *db.DBHandler
+	tracker   *relationships.Tracker
+	quests    *quests.Board
+}
+
+func NewActionHandler(dbHandler *db.DBHandler, tracker *relationships.Tracker, quests *quests.Board) *ActionHandler {
+	return &ActionHandler{
+		dbHandler: dbHandler,
+		tracker:   tracker,
+		quests:    quests,
+	}
+}
+
+func (h *ActionHandler) Execute(unityID string, npcID string, name string, arguments json.RawMessage) (string, error) {
+	switch name {
+	case "set_quest_flag":
+		var args struct {
+			Flag  string `json:"flag"`
+			Value string `json:"value"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return "", err
+		}
+
+		if err := h.dbHandler.SetPlayerFlag(unityID, args.Flag, args.Value); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Flag %s is now %s.", args.Flag, args.Value), nil
+
+	case "change_affinity":
+		var args struct {
+			Delta int `json:"delta"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return "", err
+		}
+
+		relationship, err := h.tracker.Change(unityID, npcID, args.Delta)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Your affinity with the player is now %d (%s).", relationship.Affinity, strings.ReplaceAll(relationship.Stage, "_", " ")), nil
+
+	case "offer_quest":
+		var args struct {
+			Idea string `json:"idea"`
+		}
+		if err := json.Unmarshal(arguments, &args); err != nil {
+			return "", err
+		}
+
+		quest, existing, err := h.quests.Offer(unityID, npcID, args.Idea)
+		if err != nil {
+			return "", err
+		}
+		if existing {
+			return fmt.Sprintf("You already gave the player a quest that isn't over: %s", describeQuest(quest)), nil
+		}
+		return fmt.Sprintf("You're offering the player this quest, tell them about it and ask if they're in: %s", describeQuest(quest)), nil
+
+	case "accept_quest":
+		quest, err := h.quests.Accept(unityID, npcID)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("The player is on it: %s", describeQuest(quest)), nil
+
+	default:
+		// give_item, move_to_location... the game takes care of these
+		return "Done.", nil
+	}
+}
+
+// describeQuest tells the NPC what their quest is about and what it pays
+func describeQuest(quest *types.DBQuest) string {
+	steps := make([]string, len(quest.Steps))
+	for i, step := range quest.Steps {
+		steps[i] = step.Description
+	}
+
+	description := fmt.Sprintf("%q, %s Steps: %s.", quest.Title, quest.Summary, strings.Join(steps, "; "))
+	if len(quest.Rewards.Items) > 0 || quest.Rewards.Coins > 0 {
+		rewards := slices.Clone(quest.Rewards.Items)
+		if quest.Rewards.Coins > 0 {
+			rewards = append(rewards, fmt.Sprintf("%d coins", quest.Rewards.Coins))
+		}
+		description += " Reward: " + strings.Join(rewards, ", ") + "."
+	}
+	return description
+}
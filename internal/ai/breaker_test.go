@@ -0,0 +1,77 @@
+package ai
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := &circuitBreaker{threshold: 2, cooldown: time.Minute}
+
+	if !b.allow() {
+		t.Fatal("a new breaker should be closed")
+	}
+	if b.failure() {
+		t.Fatal("one failure shouldn't open the breaker")
+	}
+	if !b.allow() {
+		t.Fatal("the breaker should stay closed below the threshold")
+	}
+	if !b.failure() {
+		t.Fatal("reaching the threshold should open the breaker")
+	}
+	if b.allow() {
+		t.Fatal("an open breaker shouldn't allow requests during the cooldown")
+	}
+
+	// Cooldown over: exactly one trial request
+	b.openUntil = time.Now().Add(-time.Second)
+	if !b.allow() {
+		t.Fatal("a trial request should be allowed after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("only one trial request should be allowed at a time")
+	}
+
+	// A failed trial re-opens it for another cooldown
+	if !b.failure() {
+		t.Fatal("a failed trial should re-open the breaker")
+	}
+	if b.allow() {
+		t.Fatal("the breaker should be open again after a failed trial")
+	}
+
+	// A successful trial closes it
+	b.openUntil = time.Now().Add(-time.Second)
+	if !b.allow() {
+		t.Fatal("a trial request should be allowed after the second cooldown")
+	}
+	b.success()
+	for range 3 {
+		if !b.allow() {
+			t.Fatal("a successful trial should close the breaker")
+		}
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	b := &circuitBreaker{threshold: 2, cooldown: time.Minute}
+
+	b.failure()
+	b.success()
+	if b.failure() {
+		t.Fatal("failures shouldn't add up across a success")
+	}
+}
+
+func TestBreakerSetPerModel(t *testing.T) {
+	s := newBreakerSet(1, time.Minute)
+
+	s.get("a").failure()
+	if s.get("a").allow() {
+		t.Error("model a's breaker should be open")
+	}
+	if !s.get("b").allow() {
+		t.Error("model b's breaker shouldn't be affected by model a")
+	}
+}
@@ -0,0 +1,259 @@
+package ai
+
+import (
+	"os"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/types"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tokenizer estimates how many tokens a piece of text costs
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// HeuristicTokenizer assumes roughly four characters per token, which is close enough
+// for English prose and costs nothing to compute
+type HeuristicTokenizer struct{}
+
+func (HeuristicTokenizer) CountTokens(text string) int {
+	estimate := (utf8.RuneCountInString(text) + 3) / 4
+	// Short words and punctuation heavy text are usually at least a token per word
+	if words := len(strings.Fields(text)); words > estimate {
+		return words
+	}
+	return estimate
+}
+
+// messageOverhead is what the chat format adds around every message (role, separators)
+const messageOverhead = 4
+
+// ModelContextLimits is the context window of every model we route to, in tokens
+var ModelContextLimits = map[string]int{
+	"mistralai/mistral-nemo": 128000,
+	"openai/gpt-4o-mini":     128000,
+}
+
+// defaultContextLimit is assumed for models missing from ModelContextLimits
+const defaultContextLimit = 8192
+
+// ContextBudget decides how much of the context window a chat prompt may use
+type ContextBudget struct {
+	// MaxPromptTokens caps the prompt regardless of the model's window, 0 means no cap
+	MaxPromptTokens int
+	// ResponseReserve is kept free for the reply when the model config sets no max_tokens
+	ResponseReserve int
+	// EventShare, MemoryShare and LoreShare are the most of the budget events, memory and
+	// lore may take, so they can't crowd out the conversation itself
+	EventShare  float64
+	MemoryShare float64
+	LoreShare   float64
+}
+
+var DefaultContextBudget = ContextBudget{
+	MaxPromptTokens: 4000,
+	ResponseReserve: 512,
+	EventShare:      0.2,
+	MemoryShare:     0.2,
+	LoreShare:       0.15,
+}
+
+// ContextBudgetFromEnv returns DefaultContextBudget with MaxPromptTokens taken from
+// AI_CONTEXT_BUDGET when it is set
+func ContextBudgetFromEnv() ContextBudget {
+	budget := DefaultContextBudget
+	if value, err := strconv.Atoi(os.Getenv("AI_CONTEXT_BUDGET")); err == nil && value >= 0 {
+		budget.MaxPromptTokens = value
+	}
+	return budget
+}
+
+// ChatContext is everything that could go into an in-game chat prompt
+type ChatContext struct {
+	NPC types.NPC
+	// Events, Knowledge and History are newest first, the way the database returns them
+	Events    []types.DBPlayerEvent
+	Knowledge []prompts.Knowledge
+	History   []types.DBChatMessage
+	// Summary is the rolling summary of older conversations with this NPC
+	Summary string
+	// Memory is long-term knowledge about the player, most important first
+	Memory  []string
+	Message string
+	// Lore is what the NPC knows about the world that relates to the message, best match first
+	Lore []string
+	// Relationship is always sent, it's one short line
+	Relationship *prompts.Relationship
+	// Scene is set for group conversations
+	Scene *prompts.Scene
+	Now   *prompts.Now
+	// Quests are always sent, there are only a few
+	Quests []prompts.Quest
+	// Guard is set when the message tries to take over the NPC
+	Guard bool
+}
+
+// ContextBuilder packs a ChatContext into as few messages as fit the model's context window
+type ContextBuilder struct {
+	tokenizer Tokenizer
+	budget    ContextBudget
+}
+
+func NewContextBuilder(tokenizer Tokenizer, budget ContextBudget) *ContextBuilder {
+	if tokenizer == nil {
+		tokenizer = HeuristicTokenizer{}
+	}
+
+	return &ContextBuilder{
+		tokenizer: tokenizer,
+		budget:    budget,
+	}
+}
+
+// promptBudget returns how many tokens the prompt may use with modelConfig. Every model of
+// the fallback chain has to fit, so the smallest window wins.
+func (b *ContextBuilder) promptBudget(modelConfig ModelConfig) int {
+	available := -1
+	for _, config := range modelChain(modelConfig) {
+		limit, exists := ModelContextLimits[config.ModelName]
+		if !exists {
+			limit = defaultContextLimit
+		}
+
+		reserve := b.budget.ResponseReserve
+		if config.Sampling.MaxTokens != nil {
+			reserve = *config.Sampling.MaxTokens
+		}
+
+		if limit-reserve < available || available < 0 {
+			available = limit - reserve
+		}
+	}
+
+	if b.budget.MaxPromptTokens > 0 && b.budget.MaxPromptTokens < available {
+		available = b.budget.MaxPromptTokens
+	}
+	return available
+}
+
+func (b *ContextBuilder) messageTokens(content string) int {
+	return b.tokenizer.CountTokens(content) + messageOverhead
+}
+
+// Build returns the system prompt rendered from the chat template of promptSet, the most recent
+// history that fits and the current message, in chronological order. The persona and the current
+// message are always sent; events and memory are added newest/most important first up to their
+// share of the budget, and the remaining space goes to history.
+func (b *ContextBuilder) Build(promptSet *prompts.Set, chat ChatContext, modelConfig ModelConfig) ([]types.OpenRouterMessage, error) {
+	available := b.promptBudget(modelConfig)
+
+	// Events
+	eventBudget := int(float64(available) * b.budget.EventShare)
+	events := make([]string, 0, len(chat.Events))
+	for _, event := range chat.Events {
+		cost := b.tokenizer.CountTokens(event.EventDetails) + 1
+		if cost > eventBudget {
+			break
+		}
+		eventBudget -= cost
+		events = append(events, event.EventDetails)
+	}
+
+	// Knowledge shares the events' budget, only one of them is used at a time
+	knowledge := make([]prompts.Knowledge, 0, len(chat.Knowledge))
+	for _, item := range chat.Knowledge {
+		cost := b.tokenizer.CountTokens(item.Content) + b.tokenizer.CountTokens(item.Source) + 3
+		if cost > eventBudget {
+			break
+		}
+		eventBudget -= cost
+		knowledge = append(knowledge, item)
+	}
+
+	// Memory, starting with the conversation summary
+	memoryBudget := int(float64(available) * b.budget.MemoryShare)
+	summary := chat.Summary
+	if cost := b.tokenizer.CountTokens(summary); cost > memoryBudget {
+		summary = ""
+	} else {
+		memoryBudget -= cost
+	}
+
+	memory := make([]string, 0, len(chat.Memory))
+	for _, item := range chat.Memory {
+		cost := b.tokenizer.CountTokens(item) + 1
+		if cost > memoryBudget {
+			break
+		}
+		memoryBudget -= cost
+		memory = append(memory, item)
+	}
+
+	// Lore, best match first
+	loreBudget := int(float64(available) * b.budget.LoreShare)
+	lore := make([]string, 0, len(chat.Lore))
+	for _, passage := range chat.Lore {
+		cost := b.tokenizer.CountTokens(passage) + 1
+		if cost > loreBudget {
+			break
+		}
+		loreBudget -= cost
+		lore = append(lore, passage)
+	}
+
+	systemPrompt, err := promptSet.Render(prompts.ChannelChat, prompts.Data{
+		NPC:          chat.NPC,
+		Events:       events,
+		Knowledge:    knowledge,
+		Summary:      summary,
+		Memory:       memory,
+		Lore:         lore,
+		Relationship: chat.Relationship,
+		Scene:        chat.Scene,
+		Now:          chat.Now,
+		Quests:       chat.Quests,
+		Guard:        chat.Guard,
+	})
+	if err != nil {
+		return nil, err
+	}
+	used := b.messageTokens(systemPrompt) + b.messageTokens(chat.Message)
+
+	// History, newest first until the budget runs out
+	history := make([]types.OpenRouterMessage, 0, len(chat.History))
+	for _, msg := range chat.History {
+		cost := b.messageTokens(msg.MessageText)
+		if used+cost > available {
+			break
+		}
+		used += cost
+
+		role := "assistant"
+		if msg.Sender == "player" {
+			role = "user"
+		}
+
+		history = append(history, types.OpenRouterMessage{
+			Role:    role,
+			Content: msg.MessageText,
+		})
+	}
+	slices.Reverse(history)
+
+	// Initialize with capacity for system message + history + current message
+	messages := make([]types.OpenRouterMessage, 0, len(history)+2)
+	messages = append(messages, types.OpenRouterMessage{
+		Role:    "system",
+		Content: systemPrompt,
+	})
+	messages = append(messages, history...)
+	messages = append(messages, types.OpenRouterMessage{
+		Role:    "user",
+		Content: chat.Message,
+	})
+
+	return messages, nil
+}
@@ -0,0 +1,192 @@
+package ai
+
+import (
+	"fmt"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/types"
+	"strings"
+	"testing"
+)
+
+// wordTokenizer counts a token per word, so costs in tests are easy to work out
+type wordTokenizer struct{}
+
+func (wordTokenizer) CountTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+// build runs Build, failing the test if it can't
+func build(t *testing.T, b *ContextBuilder, chat ChatContext, modelConfig ModelConfig) []types.OpenRouterMessage {
+	t.Helper()
+
+	messages, err := b.Build(prompts.Default(), chat, modelConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func TestHeuristicTokenizer(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"a b c d e f", 6},
+		{"héllo", 2},
+	}
+
+	for _, test := range tests {
+		if got := (HeuristicTokenizer{}).CountTokens(test.text); got != test.want {
+			t.Errorf("CountTokens(%q) = %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestPromptBudget(t *testing.T) {
+	maxTokens := 1000
+
+	tests := []struct {
+		name        string
+		budget      ContextBudget
+		modelConfig ModelConfig
+		want        int
+	}{
+		{
+			name:        "unknown model",
+			budget:      ContextBudget{ResponseReserve: 512},
+			modelConfig: ModelConfig{ModelName: "someone/unknown"},
+			want:        defaultContextLimit - 512,
+		},
+		{
+			name:        "known model",
+			budget:      ContextBudget{ResponseReserve: 512},
+			modelConfig: ModelConfig{ModelName: "openai/gpt-4o-mini"},
+			want:        128000 - 512,
+		},
+		{
+			name:        "max tokens replaces the reserve",
+			budget:      ContextBudget{ResponseReserve: 512},
+			modelConfig: ModelConfig{ModelName: "someone/unknown", Sampling: types.SamplingParams{MaxTokens: &maxTokens}},
+			want:        defaultContextLimit - maxTokens,
+		},
+		{
+			name:   "smallest window of the chain",
+			budget: ContextBudget{ResponseReserve: 512},
+			modelConfig: ModelConfig{
+				ModelName: "openai/gpt-4o-mini",
+				Fallbacks: []ModelConfig{{ModelName: "someone/unknown"}},
+			},
+			want: defaultContextLimit - 512,
+		},
+		{
+			name:        "capped",
+			budget:      ContextBudget{MaxPromptTokens: 4000, ResponseReserve: 512},
+			modelConfig: ModelConfig{ModelName: "openai/gpt-4o-mini"},
+			want:        4000,
+		},
+		{
+			name:        "cap above the window",
+			budget:      ContextBudget{MaxPromptTokens: 100000, ResponseReserve: 512},
+			modelConfig: ModelConfig{ModelName: "someone/unknown"},
+			want:        defaultContextLimit - 512,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewContextBuilder(wordTokenizer{}, test.budget)
+			if got := b.promptBudget(test.modelConfig); got != test.want {
+				t.Errorf("promptBudget = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildKeepsNewestHistory(t *testing.T) {
+	npcPersonality := types.NPC{ID: "baker", Name: "Bea"}
+	history := []types.DBChatMessage{
+		{Sender: "baker", MessageText: "fresh rolls today"},
+		{Sender: "player", MessageText: "any bread left"},
+		{Sender: "baker", MessageText: "hello there traveller"},
+		{Sender: "player", MessageText: "good morning"},
+	}
+	modelConfig := ModelConfig{ModelName: "someone/unknown"}
+
+	// What the system prompt and the message cost on their own
+	b := NewContextBuilder(wordTokenizer{}, ContextBudget{})
+	bare := build(t, b, ChatContext{NPC: npcPersonality, Message: "thanks"}, modelConfig)
+	base := b.messageTokens(bare[0].Content) + b.messageTokens("thanks")
+
+	tests := []struct {
+		name  string
+		space int
+		want  []string
+	}{
+		{"nothing fits", 0, nil},
+		{"newest fits", b.messageTokens("fresh rolls today"), []string{"assistant: fresh rolls today"}},
+		{"one token short of two", b.messageTokens("fresh rolls today") + b.messageTokens("any bread left") - 1, []string{"assistant: fresh rolls today"}},
+		{"two fit", b.messageTokens("fresh rolls today") + b.messageTokens("any bread left"), []string{"user: any bread left", "assistant: fresh rolls today"}},
+		{"everything fits", 1000, []string{"user: good morning", "assistant: hello there traveller", "user: any bread left", "assistant: fresh rolls today"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewContextBuilder(wordTokenizer{}, ContextBudget{MaxPromptTokens: base + test.space})
+			messages := build(t, b, ChatContext{NPC: npcPersonality, History: history, Message: "thanks"}, modelConfig)
+
+			last := messages[len(messages)-1]
+			if messages[0].Role != "system" || last.Role != "user" || last.Content != "thanks" {
+				t.Fatalf("messages should start with the system prompt and end with the message, got %+v", messages)
+			}
+
+			var got []string
+			for _, message := range messages[1 : len(messages)-1] {
+				got = append(got, message.Role+": "+message.Content)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("history = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildSharesOfTheBudget(t *testing.T) {
+	long := strings.Repeat("word ", 50)
+
+	// A budget of 100 tokens with a 10% share leaves 10 tokens, each item costs a token more than its words
+	b := NewContextBuilder(wordTokenizer{}, ContextBudget{MaxPromptTokens: 100, EventShare: 0.1, MemoryShare: 0.1})
+
+	messages := build(t, b, ChatContext{
+		NPC: types.NPC{ID: "baker", Name: "Bea"},
+		Events: []types.DBPlayerEvent{
+			{EventDetails: "bought apples"},
+			{EventDetails: "fed the ducks"},
+			{EventDetails: "lost their hat"},
+		},
+		Memory:  []string{"likes rye", long, "hates mornings"},
+		Message: "hi",
+	}, ModelConfig{ModelName: "someone/unknown"})
+	prompt := messages[0].Content
+
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"bought apples", true},
+		{"fed the ducks", true},
+		{"lost their hat", false},
+		{"likes rye", true},
+		{"word word", false},
+		// Items stop at the first one that doesn't fit, even if a later one would
+		{"hates mornings", false},
+	}
+
+	for _, test := range tests {
+		if got := strings.Contains(prompt, test.text); got != test.want {
+			t.Errorf("prompt contains %q = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
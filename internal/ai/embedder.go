@@ -0,0 +1,210 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"os"
+	"rd-backend/internal/types"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Embedder turns text into vectors whose cosine similarity reflects how related the texts are
+type Embedder interface {
+	Embed(texts []string) ([][]float32, error)
+}
+
+// CosineSimilarity of two vectors, 0 when either is empty or their lengths differ
+func CosineSimilarity(a []float32, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+const (
+	EmbedderHashing = "hashing"
+	EmbedderOpenAI  = "openai"
+
+	defaultHashingDimensions = 256
+	embeddingTimeout         = 15 * time.Second
+)
+
+// NewEmbedderFromEnv picks the embedder named by EMBEDDINGS_PROVIDER (hashing by default)
+//
+//	hashing: no settings, runs in-process
+//	openai:  EMBEDDINGS_URL, EMBEDDINGS_MODEL, EMBEDDINGS_API_KEY (optional)
+func NewEmbedderFromEnv() (Embedder, error) {
+	switch name := os.Getenv("EMBEDDINGS_PROVIDER"); name {
+	case "", EmbedderHashing:
+		return NewHashingEmbedder(defaultHashingDimensions), nil
+
+	case EmbedderOpenAI:
+		url := os.Getenv("EMBEDDINGS_URL")
+		model := os.Getenv("EMBEDDINGS_MODEL")
+		if url == "" || model == "" {
+			return nil, fmt.Errorf("EMBEDDINGS_URL and EMBEDDINGS_MODEL must be set")
+		}
+		return NewAPIEmbedder(url, os.Getenv("EMBEDDINGS_API_KEY"), model), nil
+
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDINGS_PROVIDER %q", name)
+	}
+}
+
+// HashingEmbedder is a deterministic bag-of-words embedder using the hashing trick.
+// It only catches shared words, not meaning, but needs no model and is stable across runs,
+// which makes it good enough for offline development and tests.
+type HashingEmbedder struct {
+	dimensions int
+}
+
+func NewHashingEmbedder(dimensions int) *HashingEmbedder {
+	return &HashingEmbedder{
+		dimensions: dimensions,
+	}
+}
+
+func (e *HashingEmbedder) Embed(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *HashingEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dimensions)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	add := func(feature string, weight float32) {
+		hash := fnv.New32a()
+		hash.Write([]byte(feature))
+		sum := hash.Sum32()
+
+		// The top bit picks the sign so collisions tend to cancel out instead of piling up
+		if sum&(1<<31) != 0 {
+			weight = -weight
+		}
+		vector[int(sum%uint32(e.dimensions))] += weight
+	}
+
+	for i, word := range words {
+		add(word, 1)
+		if i > 0 {
+			add(words[i-1]+" "+word, 0.5)
+		}
+	}
+
+	normalize(vector)
+	return vector
+}
+
+// APIEmbedder calls an OpenAI-compatible /embeddings endpoint
+type APIEmbedder struct {
+	client *http.Client
+	url    string
+	apiKey string
+	model  string
+}
+
+func NewAPIEmbedder(url string, apiKey string, model string) *APIEmbedder {
+	return &APIEmbedder{
+		client: &http.Client{},
+		url:    url,
+		apiKey: apiKey,
+		model:  model,
+	}
+}
+
+func (e *APIEmbedder) Embed(texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	jsonBody, err := json.Marshal(types.EmbeddingRequest{
+		Model: e.model,
+		Input: texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var response types.EmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(response.Data))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, data := range response.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+		}
+		normalize(data.Embedding)
+		vectors[data.Index] = data.Embedding
+	}
+
+	return vectors, nil
+}
+
+// normalize scales vector to unit length in place, so cosine similarity is a dot product
+func normalize(vector []float32) {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+}
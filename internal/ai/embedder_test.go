@@ -0,0 +1,29 @@
+package ai
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float32
+		want float64
+	}{
+		{"same direction", []float32{1, 2}, []float32{2, 4}, 1},
+		{"opposite", []float32{1, 0}, []float32{-1, 0}, -1},
+		{"orthogonal", []float32{1, 0}, []float32{0, 3}, 0},
+		{"empty", nil, nil, 0},
+		{"different lengths", []float32{1, 0}, []float32{1, 0, 0}, 0},
+		{"zero vector", []float32{0, 0}, []float32{1, 1}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CosineSimilarity(test.a, test.b); math.Abs(got-test.want) > 1e-9 {
+				t.Errorf("CosineSimilarity = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"fmt"
+	"log"
+	"rd-backend/internal/types"
+	"strings"
+)
+
+// Emotions and Gestures are the animation states Unity has for NPCs
+var (
+	Emotions = []string{"neutral", "happy", "excited", "flirty", "sad", "annoyed", "angry", "surprised", "embarrassed", "thoughtful"}
+	Gestures = []string{"none", "wave", "nod", "shake_head", "shrug", "laugh", "point", "cross_arms", "facepalm"}
+)
+
+// ExpressionTagger decides how an NPC delivers their reply
+type ExpressionTagger interface {
+	Tag(unityID string, npcPersonality types.NPC, message string, reply string) (types.Expression, error)
+}
+
+// LLMExpressionTagger classifies replies with a small structured request to a cheap model
+type LLMExpressionTagger struct {
+	aiHandler *AIHandler
+}
+
+func NewLLMExpressionTagger(aiHandler *AIHandler) *LLMExpressionTagger {
+	return &LLMExpressionTagger{
+		aiHandler: aiHandler,
+	}
+}
+
+// expressionTag is what LLMExpressionTagger asks the model for, the enums are filled in from
+// Emotions and Gestures
+type expressionTag struct {
+	Emotion   string  `json:"emotion"`
+	Intensity float64 `json:"intensity" jsonschema:"minimum=0,maximum=1"`
+	Gesture   string  `json:"gesture"`
+}
+
+func (t *LLMExpressionTagger) Tag(unityID string, npcPersonality types.NPC, message string, reply string) (types.Expression, error) {
+	request := JSONRequest{
+		Name: "expression",
+		Instructions: fmt.Sprintf(
+			"You direct the animations of %s, a game character. Given what the player said and %s's reply, "+
+				"pick the emotion %s shows while saying it, how strongly from 0 to 1, and a gesture if one fits. "+
+				"Judge by the reply and %s's personality: %s",
+			npcPersonality.Name, npcPersonality.Name, npcPersonality.Name, npcPersonality.Name, npcPersonality.SpeechStyle,
+		),
+		Input: fmt.Sprintf("Player: %s\n%s: %s", message, npcPersonality.Name, reply),
+	}
+
+	tag, err := CompleteJSONAs[expressionTag](t.aiHandler, UsageKey{UnityID: unityID, NpcID: npcPersonality.ID, CallType: CallExpression}, withExpressionEnums(request))
+	if err != nil {
+		return types.Expression{}, err
+	}
+
+	expression := types.Expression{
+		Emotion:   tag.Emotion,
+		Intensity: tag.Intensity,
+		Gesture:   tag.Gesture,
+	}
+	if expression.Gesture == "none" {
+		expression.Gesture = ""
+	}
+	return expression, nil
+}
+
+// withExpressionEnums sets the request's schema to expressionTag limited to the known animations
+func withExpressionEnums(request JSONRequest) JSONRequest {
+	s, err := schemaFor[expressionTag]()
+	if err != nil {
+		return request
+	}
+
+	for _, emotion := range Emotions {
+		s.Properties["emotion"].Enum = append(s.Properties["emotion"].Enum, emotion)
+	}
+	for _, gesture := range Gestures {
+		s.Properties["gesture"].Enum = append(s.Properties["gesture"].Enum, gesture)
+	}
+
+	request.Schema = s
+	return request
+}
+
+// SetExpressionTagger tags every chat reply with an emotion and gesture
+func (h *AIHandler) SetExpressionTagger(tagger ExpressionTagger) {
+	h.expressionTagger = tagger
+}
+
+// tagExpression fills in result.Expression. A failed tag leaves it empty rather than failing the reply.
+func (h *AIHandler) tagExpression(unityID string, npcPersonality types.NPC, message string, result *ChatResult) {
+	if h.expressionTagger == nil || result == nil || strings.TrimSpace(result.Completion) == "" {
+		return
+	}
+
+	expression, err := h.expressionTagger.Tag(unityID, npcPersonality, message, result.Completion)
+	if err != nil {
+		log.Printf("Could not tag expression for %s: %v", npcPersonality.ID, err)
+		return
+	}
+	result.Expression = &expression
+}
@@ -0,0 +1,130 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"rd-backend/internal/types"
+	"strings"
+	"sync"
+)
+
+// FakeProvider is a deterministic provider for offline development and tests.
+// It plays back its scripted replies in order, wrapping around at the end, and
+// echoes the last user message when it has no script.
+type FakeProvider struct {
+	mu       sync.Mutex
+	replies  []string
+	next     int
+	requests []types.OpenRouterRequest
+}
+
+func NewFakeProvider(replies ...string) *FakeProvider {
+	return &FakeProvider{
+		replies: replies,
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return ProviderFake
+}
+
+// Requests returns every request the provider has received, oldest first
+func (p *FakeProvider) Requests() []types.OpenRouterRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]types.OpenRouterRequest(nil), p.requests...)
+}
+
+func (p *FakeProvider) reply(request types.OpenRouterRequest) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, request)
+
+	if len(p.replies) > 0 {
+		reply := p.replies[p.next%len(p.replies)]
+		p.next++
+		return reply
+	}
+
+	lastUserMessage := ""
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role == "user" {
+			lastUserMessage = request.Messages[i].Content
+			break
+		}
+	}
+
+	return fmt.Sprintf("[%s] You said: %s", request.Model, lastUserMessage)
+}
+
+func (p *FakeProvider) Complete(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	reply := p.reply(request)
+
+	return &types.OpenRouterResponse{
+		Model: request.Model,
+		Choices: []types.OpenRouterChoice{
+			{Message: types.OpenRouterMessage{Role: "assistant", Content: reply}},
+		},
+		Usage: fakeUsage(request, reply),
+	}, nil
+}
+
+// fakeUsage estimates what the request would have cost in tokens, so usage accounting
+// has something to record offline
+func fakeUsage(request types.OpenRouterRequest, reply string) *types.Usage {
+	var tokenizer HeuristicTokenizer
+
+	prompt := 0
+	for _, message := range request.Messages {
+		prompt += tokenizer.CountTokens(message.Content) + messageOverhead
+	}
+	completion := tokenizer.CountTokens(reply)
+
+	return &types.Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		TotalTokens:      prompt + completion,
+	}
+}
+
+// Stream sends the reply one word at a time
+func (p *FakeProvider) Stream(ctx context.Context, request types.OpenRouterRequest, onDelta func(string) error) (*types.OpenRouterResponse, error) {
+	reply := p.reply(request)
+
+	var completion strings.Builder
+	var usage *types.Usage
+	response := func() *types.OpenRouterResponse {
+		return &types.OpenRouterResponse{
+			Model: request.Model,
+			Choices: []types.OpenRouterChoice{
+				{Message: types.OpenRouterMessage{Role: "assistant", Content: completion.String()}},
+			},
+			Usage: usage,
+		}
+	}
+
+	for i, word := range strings.SplitAfter(reply, " ") {
+		if word == "" {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return response(), err
+		}
+
+		completion.WriteString(word)
+		if err := onDelta(word); err != nil {
+			return response(), fmt.Errorf("%w after %d chunks: %w", ErrStreamAborted, i, err)
+		}
+	}
+
+	// Like a real stream, usage only comes with the end of the reply
+	usage = fakeUsage(request, reply)
+	return response(), nil
+}
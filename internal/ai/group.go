@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"fmt"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/types"
+)
+
+// ModerateInput screens a player message before it goes to several NPCs at once. It returns
+// the text to use, or the NPC's deflection and true when the message was blocked or tried to
+// take over the NPCs and the policy is to deflect.
+func (h *AIHandler) ModerateInput(unityID string, npcId string, message string) (string, bool) {
+	input := h.ScreenInput(unityID, npcId, message)
+	if input.Blocked() {
+		return input.Reply, true
+	}
+	return input.Text, false
+}
+
+// GetGroupChatCompletion gets npcId's next line in a group conversation. transcript is the
+// scene so far, oldest first, and must not end with one of npcId's own lines. The player's
+// lines are expected to be moderated already.
+func (h *AIHandler) GetGroupChatCompletion(unityID string, npcId string, scene types.DBScene, transcript []types.DBSceneLine, eventHistory []types.DBPlayerEvent, summary string) (*ChatResult, error) {
+	npcPersonality, exists := (*h.npcConfigs)[npcId]
+	if !exists {
+		return nil, fmt.Errorf("NPC with ID %s not found", npcId)
+	}
+	if len(transcript) == 0 || transcript[len(transcript)-1].Speaker == npcId {
+		return nil, fmt.Errorf("nothing for %s to reply to", npcId)
+	}
+
+	others := make([]string, 0, len(scene.Participants))
+	for _, id := range scene.Participants {
+		if id != npcId {
+			others = append(others, h.speakerName(id))
+		}
+	}
+
+	// The NPC's own lines are theirs, everyone else's come in as user messages with the speaker's name
+	history := make([]types.DBChatMessage, 0, len(transcript))
+	for i := len(transcript) - 2; i >= 0; i-- {
+		history = append(history, h.sceneMessage(npcId, transcript[i]))
+	}
+	last := transcript[len(transcript)-1]
+	message := h.sceneMessage(npcId, last).MessageText
+
+	// The attempt was recorded when the player's line was moderated, every NPC replying to it is on guard
+	guard := last.Speaker == types.SpeakerPlayer && h.detect(unityID, npcId, StageInput, last.Text).Found
+
+	modelConfig := modelConfigForNPC(RoleplayConfig, npcPersonality)
+
+	messages, err := h.buildChatMessages(unityID, message, history, eventHistory, summary, npcPersonality, &prompts.Scene{
+		Others:   others,
+		Location: scene.Location,
+	}, guard, modelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := h.chatWithTools(unityID, npcPersonality, messages, modelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	h.keepResultInCharacter(unityID, npcPersonality, messages, modelConfig, result)
+	h.moderateResult(unityID, npcPersonality, result)
+	h.tagExpression(unityID, npcPersonality, message, result)
+	return result, nil
+}
+
+// sceneMessage is a scene line as the chat history npcId sees
+func (h *AIHandler) sceneMessage(npcId string, line types.DBSceneLine) types.DBChatMessage {
+	if line.Speaker == npcId {
+		return types.DBChatMessage{MessageText: line.Text, Sender: npcId}
+	}
+	return types.DBChatMessage{
+		MessageText: h.speakerName(line.Speaker) + ": " + line.Text,
+		Sender:      "player",
+	}
+}
+
+// speakerName is how a scene speaker is called in prompts
+func (h *AIHandler) speakerName(speaker string) string {
+	if speaker == types.SpeakerPlayer {
+		return "Player"
+	}
+	if npcPersonality, exists := (*h.npcConfigs)[speaker]; exists {
+		return npcPersonality.Name
+	}
+	return speaker
+}
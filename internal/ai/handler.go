@@ -1,14 +1,15 @@
 package ai
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
 	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/ai/schema"
+	"rd-backend/internal/ai/tools"
 	"rd-backend/internal/types"
+	"sync/atomic"
 )
 
 // ModelConfig holds configuration for different model types
@@ -16,47 +17,77 @@ type ModelConfig struct {
 	ModelName      string
 	ProviderOrder  []string
 	AllowFallbacks bool
+	// Fallbacks are tried in order when this model fails or its circuit is open
+	Fallbacks []ModelConfig
+	Sampling  types.SamplingParams
+	// StructuredOutputs is set for models that accept a JSON Schema response_format
+	StructuredOutputs bool
 }
 
 var (
 	RoleplayConfig = ModelConfig{
 		ModelName:      "mistralai/mistral-nemo",
 		ProviderOrder:  []string{"Mistral", "DeepInfra"},
-		AllowFallbacks: false,
+		AllowFallbacks: true,
+		Fallbacks:      []ModelConfig{GPTConfig},
 	}
 
 	GPTConfig = ModelConfig{
-		ModelName:      "openai/gpt-4o-mini", // Restored to original model
-		ProviderOrder:  []string{"OpenAI"},
-		AllowFallbacks: false,
+		ModelName:         "openai/gpt-4o-mini", // Restored to original model
+		ProviderOrder:     []string{"OpenAI"},
+		AllowFallbacks:    false,
+		StructuredOutputs: true,
 	}
 )
 
 type AIHandler struct {
-	client          *http.Client
-	baseURL         string
-	apiKey          string
-	npcConfigs      *npc.NPCs
-	npcPhoneNumbers *npc.NPCNumbers
+	provider         Provider
+	retryPolicy      RetryPolicy
+	breakers         *breakerSet
+	contextBuilder   *ContextBuilder
+	promptSet        atomic.Pointer[prompts.Set]
+	embedder         Embedder
+	memoryStore      MemoryStore
+	relationships    RelationshipStore
+	knowledge        KnowledgeStore
+	lore             LoreRetriever
+	clock            GameClock
+	questStore       QuestStore
+	tools            *tools.Tools
+	toolExecutor     tools.Executor
+	moderator        Moderator
+	flagStore        FlagStore
+	injection        *injectionDefense
+	usageStore       UsageStore
+	expressionTagger ExpressionTagger
+	npcConfigs       *npc.NPCs
+	npcPhoneNumbers  *npc.NPCNumbers
 }
 
-func NewAIHandler(npcConfigs *npc.NPCs, npcPhoneNumbers *npc.NPCNumbers) *AIHandler {
+func NewAIHandler(provider Provider, npcConfigs *npc.NPCs, npcPhoneNumbers *npc.NPCNumbers) *AIHandler {
+	if provider == nil {
+		panic("provider must not be nil")
+	}
 	if npcConfigs == nil || npcPhoneNumbers == nil {
 		panic("npcConfigs and npcPhoneNumbers must not be nil")
 	}
 
-	apiKey := os.Getenv("OPENROUTER_API_KEY")
-	if apiKey == "" {
-		panic("OPENROUTER_API_KEY environment variable is not set")
-	}
-
-	return &AIHandler{
-		client:          &http.Client{},
-		baseURL:         "https://openrouter.ai/api/v1/chat/completions",
-		apiKey:          apiKey,
+	handler := &AIHandler{
+		provider:        provider,
+		retryPolicy:     DefaultRetryPolicy,
+		breakers:        newBreakerSet(DefaultRetryPolicy.BreakerThreshold, DefaultRetryPolicy.BreakerCooldown),
+		contextBuilder:  NewContextBuilder(HeuristicTokenizer{}, ContextBudgetFromEnv()),
 		npcConfigs:      npcConfigs,
 		npcPhoneNumbers: npcPhoneNumbers,
 	}
+	handler.promptSet.Store(prompts.Default())
+
+	return handler
+}
+
+// SetTokenizer replaces the heuristic token estimate used to fit chat prompts into the context window
+func (h *AIHandler) SetTokenizer(tokenizer Tokenizer) {
+	h.contextBuilder = NewContextBuilder(tokenizer, h.contextBuilder.budget)
 }
 
 // validateModelConfig ensures the model configuration is valid
@@ -70,8 +101,8 @@ func validateModelConfig(config ModelConfig) error {
 	return nil
 }
 
-// makeOpenRouterRequest handles the common logic for making requests to OpenRouter
-func (h *AIHandler) makeOpenRouterRequest(messages []types.OpenRouterMessage, modelConfig ModelConfig) (*string, error) {
+// newRequest builds the request for a single model of a fallback chain
+func newRequest(messages []types.OpenRouterMessage, modelConfig ModelConfig) (*types.OpenRouterRequest, error) {
 	if len(messages) == 0 {
 		return nil, fmt.Errorf("messages array cannot be empty")
 	}
@@ -80,98 +111,240 @@ func (h *AIHandler) makeOpenRouterRequest(messages []types.OpenRouterMessage, mo
 		return nil, fmt.Errorf("invalid model configuration: %w", err)
 	}
 
-	request := types.OpenRouterRequest{
+	return &types.OpenRouterRequest{
 		Model:    modelConfig.ModelName,
 		Messages: messages,
 		Provider: &types.Provider{
 			Order:          modelConfig.ProviderOrder,
 			AllowFallbacks: modelConfig.AllowFallbacks,
 		},
+		SamplingParams: modelConfig.Sampling,
+	}, nil
+}
+
+// modelConfigForNPC applies the NPC's model block from npc.json on top of base.
+// Sampling overrides carry over to the fallbacks so the NPC sounds the same on every model.
+func modelConfigForNPC(base ModelConfig, npcPersonality types.NPC) ModelConfig {
+	override := npcPersonality.Model
+	if override == nil {
+		return base
 	}
 
-	jsonBody, err := json.Marshal(request)
-	if err != nil {
-		return nil, fmt.Errorf("error marshaling request: %w", err)
+	config := base
+	if override.ModelName != "" {
+		config.ModelName = override.ModelName
+	}
+	if len(override.ProviderOrder) > 0 {
+		config.ProviderOrder = override.ProviderOrder
 	}
+	config.Sampling = mergeSampling(base.Sampling, override.SamplingParams)
 
-	req, err := http.NewRequest("POST", h.baseURL, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+	config.Fallbacks = make([]ModelConfig, len(base.Fallbacks))
+	for i, fallback := range base.Fallbacks {
+		fallback.Sampling = mergeSampling(fallback.Sampling, override.SamplingParams)
+		config.Fallbacks[i] = fallback
 	}
 
-	h.addHeaders(req)
-	//log.Println(req.Body)
+	return config
+}
 
-	resp, err := h.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error making request: %w", err)
+// mergeSampling returns base with every parameter set in override replaced
+func mergeSampling(base types.SamplingParams, override types.SamplingParams) types.SamplingParams {
+	if override.Temperature != nil {
+		base.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		base.TopP = override.TopP
+	}
+	if override.MaxTokens != nil {
+		base.MaxTokens = override.MaxTokens
 	}
-	defer resp.Body.Close()
+	if len(override.Stop) > 0 {
+		base.Stop = override.Stop
+	}
+	if override.PresencePenalty != nil {
+		base.PresencePenalty = override.PresencePenalty
+	}
+	if override.FrequencyPenalty != nil {
+		base.FrequencyPenalty = override.FrequencyPenalty
+	}
+	return base
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+// makeRequest handles the common logic for sending a request through the configured provider,
+// retrying and falling back to other models as needed
+func (h *AIHandler) makeRequest(key UsageKey, messages []types.OpenRouterMessage, modelConfig ModelConfig) (*string, error) {
+	reply, err := h.makeToolRequest(key, messages, modelConfig, nil, "")
+	if err != nil {
+		return nil, err
 	}
 
-	var response types.OpenRouterResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("error decoding response: %w", err)
+	return &reply.Content, nil
+}
+
+// makeToolRequest is makeRequest for replies that may call tools, it returns the whole
+// assistant message. toolChoice is ignored when there are no tools.
+func (h *AIHandler) makeToolRequest(key UsageKey, messages []types.OpenRouterMessage, modelConfig ModelConfig, tools []types.Tool, toolChoice string) (*types.OpenRouterMessage, error) {
+	response, err := h.callWithFallbacks(key, messages, modelConfig, h.retryPolicy.CallTimeout,
+		func() bool { return true },
+		func(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error) {
+			withTools(&request, tools, toolChoice)
+			return h.provider.Complete(ctx, request)
+		},
+	)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(response.Choices) == 0 {
 		return nil, fmt.Errorf("no choices in response")
 	}
 
-	return &response.Choices[0].Message.Content, nil
+	return &response.Choices[0].Message, nil
+}
+
+// makeStreamRequest streams a completion through the configured provider, calling onDelta
+// for every chunk of text. The accumulated text is returned even alongside an error.
+// Failures are only retried until the first chunk has been passed on.
+func (h *AIHandler) makeStreamRequest(key UsageKey, messages []types.OpenRouterMessage, modelConfig ModelConfig, onDelta func(string) error) (*string, error) {
+	reply, err := h.makeToolStreamRequest(key, messages, modelConfig, nil, "", onDelta)
+	return &reply.Content, err
 }
 
-func (h *AIHandler) GetChatCompletion(message string, history []types.DBChatMessage, eventHistory []types.DBPlayerEvent, sender string, npcId string) (*string, error) {
+// makeToolStreamRequest is makeStreamRequest for replies that may call tools. The returned
+// message is never nil and holds whatever was generated, even alongside an error.
+func (h *AIHandler) makeToolStreamRequest(key UsageKey, messages []types.OpenRouterMessage, modelConfig ModelConfig, tools []types.Tool, toolChoice string, onDelta func(string) error) (*types.OpenRouterMessage, error) {
+	started := false
+	response, err := h.callWithFallbacks(key, messages, modelConfig, h.retryPolicy.StreamTimeout,
+		func() bool { return !started },
+		func(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error) {
+			withTools(&request, tools, toolChoice)
+			return h.provider.Stream(ctx, request, func(delta string) error {
+				started = true
+				return onDelta(delta)
+			})
+		},
+	)
+
+	reply := types.OpenRouterMessage{Role: "assistant"}
+	if response != nil && len(response.Choices) > 0 {
+		reply = response.Choices[0].Message
+	}
+
+	return &reply, err
+}
+
+func withTools(request *types.OpenRouterRequest, tools []types.Tool, toolChoice string) {
+	if len(tools) == 0 {
+		return
+	}
+	request.Tools = tools
+	request.ToolChoice = toolChoice
+}
+
+// buildChatMessages packs the persona, events and as much history as fits into the model's context
+func (h *AIHandler) buildChatMessages(unityID string, message string, history []types.DBChatMessage, eventHistory []types.DBPlayerEvent, summary string, npcPersonality types.NPC, scene *prompts.Scene, guard bool, modelConfig ModelConfig) ([]types.OpenRouterMessage, error) {
 	if message == "" {
 		return nil, fmt.Errorf("message cannot be empty")
 	}
 
+	// NPCs who only know what they saw or heard don't get every event
+	knowledge := h.recallKnowledge(unityID, npcPersonality)
+	if h.knowledge != nil {
+		eventHistory = nil
+	}
+
+	return h.contextBuilder.Build(h.promptSet.Load(), ChatContext{
+		NPC:          npcPersonality,
+		Events:       eventHistory,
+		Knowledge:    knowledge,
+		History:      history,
+		Summary:      summary,
+		Memory:       h.recallMemories(unityID, npcPersonality.ID, message, history),
+		Lore:         h.recallLore(npcPersonality.ID, message),
+		Message:      message,
+		Relationship: h.relationship(unityID, npcPersonality),
+		Scene:        scene,
+		Now:          h.now(unityID, npcPersonality),
+		Quests:       h.quests(unityID, npcPersonality),
+		Guard:        guard,
+	}, modelConfig)
+}
+
+// GetChatCompletion gets the NPC's reply to input, which the caller screened with ScreenInput
+// before storing it. suggestions is how many replies to suggest for the player's next line, 0
+// for none.
+func (h *AIHandler) GetChatCompletion(unityID string, input ScreenedInput, history []types.DBChatMessage, eventHistory []types.DBPlayerEvent, summary string, sender string, npcId string, suggestions int) (*ChatResult, error) {
 	npcPersonality, exists := (*h.npcConfigs)[npcId]
 	if !exists {
 		return nil, fmt.Errorf("NPC with ID %s not found", npcId)
 	}
 
-	// Initialize with capacity for system message + history + current message
-	messages := make([]types.OpenRouterMessage, 0, len(history)+2)
+	if input.Blocked() {
+		return &ChatResult{Completion: input.Reply, Moderated: true}, nil
+	}
+	message := input.Text
 
-	messages = append(messages, types.OpenRouterMessage{
-		Role:    "system",
-		Content: npc.GenerateSystemPromptWithEvents(npcPersonality, eventHistory),
-	})
+	modelConfig := modelConfigForNPC(RoleplayConfig, npcPersonality)
 
-	// Add history messages if present
-	if len(history) > 0 {
-		for _, msg := range history {
-			role := "assistant"
-			if msg.Sender == "player" {
-				role = "user"
-			}
-
-			messages = append(messages, types.OpenRouterMessage{
-				Role:    role,
-				Content: msg.MessageText,
-			})
-		}
+	messages, err := h.buildChatMessages(unityID, message, history, eventHistory, summary, npcPersonality, nil, input.Guard, modelConfig)
+	if err != nil {
+		return nil, err
 	}
 
-	// Add current message
-	messages = append(messages, types.OpenRouterMessage{
-		Role:    "user",
-		Content: message,
-	})
+	result, err := h.chatWithTools(unityID, npcPersonality, messages, modelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Suggestions can't come from the same call as the tool-calling reply, so they start from
+	// the reply while it is checked, and only the part of their call that's left adds up
+	pending := h.startSuggestions(unityID, npcPersonality, message, history, result, suggestions)
 
-	return h.makeOpenRouterRequest(messages, RoleplayConfig)
+	h.keepResultInCharacter(unityID, npcPersonality, messages, modelConfig, result)
+	h.moderateResult(unityID, npcPersonality, result)
+	h.finishReply(unityID, npcPersonality, message, history, result, suggestions, pending)
+	return result, nil
 }
 
-func (h *AIHandler) GetTextCompletion(message string, history []types.DBTextMessage, aiNumber string, playerNumber string) (*string, error) {
-	if message == "" {
-		return nil, fmt.Errorf("message cannot be empty")
+// GetChatCompletionStream works like GetChatCompletion but streams the spoken line through onDelta.
+// The returned result is non-nil whenever any text was generated, even if err is set.
+func (h *AIHandler) GetChatCompletionStream(unityID string, input ScreenedInput, history []types.DBChatMessage, eventHistory []types.DBPlayerEvent, summary string, sender string, npcId string, suggestions int, onDelta func(string) error) (*ChatResult, error) {
+	npcPersonality, exists := (*h.npcConfigs)[npcId]
+	if !exists {
+		return nil, fmt.Errorf("NPC with ID %s not found", npcId)
+	}
+
+	if input.Blocked() {
+		return &ChatResult{Completion: input.Reply, Moderated: true}, onDelta(input.Reply)
 	}
+	message := input.Text
+
+	modelConfig := modelConfigForNPC(RoleplayConfig, npcPersonality)
 
+	messages, err := h.buildChatMessages(unityID, message, history, eventHistory, summary, npcPersonality, nil, input.Guard, modelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// The line has already been streamed by the time it can be checked, so a moderated
+	// result tells the client to replace what it showed
+	result, err := h.streamChatWithTools(unityID, npcPersonality, messages, modelConfig, onDelta)
+	if err == nil {
+		h.keepResultInCharacter(unityID, npcPersonality, messages, modelConfig, result)
+	}
+	h.moderateResult(unityID, npcPersonality, result)
+	if err != nil {
+		suggestions = 0
+	}
+	// The streamed line is already on screen, so waiting for suggestions here doesn't hold it up
+	h.finishReply(unityID, npcPersonality, message, history, result, suggestions, nil)
+	return result, err
+}
+
+// GetTextCompletion gets the NPC's reply to a text the caller screened with ScreenText. history
+// is the texts before it, newest first.
+func (h *AIHandler) GetTextCompletion(unityID string, input ScreenedInput, history []types.DBTextMessage, aiNumber string, playerNumber string) (*string, error) {
 	npcId, exists := (*h.npcPhoneNumbers)[aiNumber]
 	if !exists {
 		return nil, fmt.Errorf("no NPC found for number %s", aiNumber)
@@ -182,70 +355,115 @@ func (h *AIHandler) GetTextCompletion(message string, history []types.DBTextMess
 		return nil, fmt.Errorf("NPC with ID %s not found", npcId)
 	}
 
+	if input.Blocked() {
+		return &input.Reply, nil
+	}
+	message := input.Text
+	if message == "" {
+		return nil, fmt.Errorf("message cannot be empty")
+	}
+
+	messages, err := h.buildTextMessages(unityID, npcPersonality, history, playerNumber, "", input.Guard)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add current message
+	messages = append(messages, types.OpenRouterMessage{
+		Role:    "user",
+		Content: message,
+	})
+
+	key := UsageKey{UnityID: unityID, NpcID: npcId, CallType: CallText}
+	modelConfig := modelConfigForNPC(RoleplayConfig, npcPersonality)
+	completion, err := h.makeRequest(key, messages, modelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Texts go out over carrier networks, so they are checked like in-game replies
+	reply, _ := h.keepInCharacter(key, npcPersonality, messages, modelConfig, *completion)
+	reply, _ = h.moderate(unityID, npcPersonality, StageOutput, reply)
+	return &reply, nil
+}
+
+// buildTextMessages renders the SMS prompt followed by the texts so far. reason is set when
+// the NPC is the one starting the conversation, and guard when the player's text tries to
+// take over the NPC.
+func (h *AIHandler) buildTextMessages(unityID string, npcPersonality types.NPC, history []types.DBTextMessage, playerNumber string, reason string, guard bool) ([]types.OpenRouterMessage, error) {
+	systemPrompt, err := h.promptSet.Load().Render(prompts.ChannelSMS, prompts.Data{
+		NPC:          npcPersonality,
+		Knowledge:    h.recallKnowledge(unityID, npcPersonality),
+		Relationship: h.relationship(unityID, npcPersonality),
+		Now:          h.now(unityID, npcPersonality),
+		Quests:       h.quests(unityID, npcPersonality),
+		TextReason:   reason,
+		Guard:        guard,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize with capacity for system message + history + current message
 	messages := make([]types.OpenRouterMessage, 0, len(history)+2)
 
 	messages = append(messages, types.OpenRouterMessage{
 		Role:    "system",
-		Content: npc.GenerateSystemPrompt(npcPersonality) + ". The Player is texting you, so please respond as if you were texting with them, but keep your personality.",
+		Content: systemPrompt,
 	})
 
-	// Add history messages if present
-	if len(history) > 0 {
-		for _, msg := range history {
-			role := "assistant"
-			if msg.SenderNumber == playerNumber {
-				role = "user"
-			}
-
-			messages = append(messages, types.OpenRouterMessage{
-				Role:    role,
-				Content: msg.MessageText,
-			})
+	for _, msg := range history {
+		role := "assistant"
+		if msg.SenderNumber == playerNumber {
+			role = "user"
 		}
-	}
 
-	// Add current message
-	messages = append(messages, types.OpenRouterMessage{
-		Role:    "user",
-		Content: message,
-	})
+		messages = append(messages, types.OpenRouterMessage{
+			Role:    role,
+			Content: msg.MessageText,
+		})
+	}
 
-	return h.makeOpenRouterRequest(messages, RoleplayConfig)
+	return messages, nil
 }
 
-func (h *AIHandler) GetJSONCompletion(message string) (*string, error) {
+// GetJSONCompletion returns any JSON object the model produces for message.
+// Prefer CompleteJSON when the shape of the document is known.
+func (h *AIHandler) GetJSONCompletion(unityID string, message string) (*string, error) {
 	if message == "" {
 		return nil, fmt.Errorf("message cannot be empty")
 	}
 
-	messages := []types.OpenRouterMessage{
-		{
-			Role:    "system",
-			Content: "Return your response as a JSON object with no additional text or explanation: " + message,
-		},
+	var document json.RawMessage
+	err := h.CompleteJSON(UsageKey{UnityID: unityID, CallType: CallJSON}, JSONRequest{
+		Name:         "json_completion",
+		Instructions: message,
+		Schema:       &schema.Schema{Type: "object"},
+	}, &document)
+	if err != nil {
+		return nil, err
 	}
 
-	return h.makeOpenRouterRequest(messages, GPTConfig)
+	completion := string(document)
+	return &completion, nil
 }
 
-func (h *AIHandler) GetDescriptionCompletion(message string) (*string, error) {
+func (h *AIHandler) GetDescriptionCompletion(unityID string, message string) (*string, error) {
 	if message == "" {
 		return nil, fmt.Errorf("message cannot be empty")
 	}
 
+	prompt, err := h.promptSet.Load().Render(prompts.ChannelNarrator, prompts.Data{Details: message})
+	if err != nil {
+		return nil, err
+	}
+
 	messages := []types.OpenRouterMessage{
 		{
 			Role:    "system",
-			Content: "Please summarize the info in this JSON object as a short sentence, describing what the player did. E.G: The player.... " + message,
+			Content: prompt,
 		},
 	}
 
-	return h.makeOpenRouterRequest(messages, GPTConfig)
-}
-
-func (h *AIHandler) addHeaders(req *http.Request) {
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+h.apiKey)
-	req.Header.Set("X-Title", "Riviera Dreams")
+	return h.makeRequest(UsageKey{UnityID: unityID, CallType: CallDescription}, messages, GPTConfig)
 }
@@ -0,0 +1,210 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"rd-backend/internal/ai/schema"
+	"rd-backend/internal/types"
+	"strings"
+)
+
+// DefaultJSONRepairs is how many times a reply that doesn't match its schema is sent back
+// to the model with the problems, on top of the first try
+const DefaultJSONRepairs = 2
+
+// JSONRequest asks a model for a JSON document matching Schema
+type JSONRequest struct {
+	// Name identifies the kind of document in logs and to the provider, e.g. "event_summary"
+	Name string
+	// Instructions is the system prompt, the schema is appended to it
+	Instructions string
+	// Input is sent as the user message when set
+	Input string
+	// Schema is derived from the output type when nil
+	Schema *schema.Schema
+	// ModelConfig defaults to GPTConfig
+	ModelConfig ModelConfig
+	// Repairs defaults to DefaultJSONRepairs, a negative value disables repairs
+	Repairs int
+}
+
+// JSONError is returned when the model still hasn't produced a valid document after every repair
+type JSONError struct {
+	Name     string
+	Attempts int
+	Problems []string
+	Reply    string
+}
+
+func (e *JSONError) Error() string {
+	return fmt.Sprintf("no valid %s after %d attempts: %s", e.Name, e.Attempts, strings.Join(e.Problems, "; "))
+}
+
+// CompleteJSONAs is CompleteJSON decoding into a new T, deriving the schema from T if the request has none
+func CompleteJSONAs[T any](h *AIHandler, key UsageKey, request JSONRequest) (*T, error) {
+	if request.Schema == nil {
+		s, err := schemaFor[T]()
+		if err != nil {
+			return nil, fmt.Errorf("could not derive %s schema: %w", request.Name, err)
+		}
+		request.Schema = s
+	}
+
+	var out T
+	if err := h.CompleteJSON(key, request, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func schemaFor[T any]() (*schema.Schema, error) {
+	var zero T
+	return schema.For(zero)
+}
+
+// CompleteJSON gets a document matching request.Schema and decodes it into out. Replies that
+// don't validate are sent back with the problems found, up to request.Repairs times, before
+// giving up with a *JSONError. Models with structured outputs are also given the schema as
+// response_format.
+func (h *AIHandler) CompleteJSON(key UsageKey, request JSONRequest, out any) error {
+	if request.Schema == nil {
+		return fmt.Errorf("%s request has no schema", request.Name)
+	}
+
+	modelConfig := request.ModelConfig
+	if modelConfig.ModelName == "" {
+		modelConfig = GPTConfig
+	}
+
+	repairs := request.Repairs
+	if repairs == 0 {
+		repairs = DefaultJSONRepairs
+	} else if repairs < 0 {
+		repairs = 0
+	}
+
+	schemaJSON, err := json.Marshal(request.Schema)
+	if err != nil {
+		return fmt.Errorf("error marshaling schema: %w", err)
+	}
+
+	format := &types.ResponseFormat{
+		Type: "json_schema",
+		JSONSchema: &types.JSONSchemaFormat{
+			Name:   request.Name,
+			Schema: schemaJSON,
+		},
+	}
+
+	messages := []types.OpenRouterMessage{
+		{
+			Role: "system",
+			Content: request.Instructions + "\n\nReturn your response as a JSON object with no additional text or explanation, " +
+				"matching this JSON Schema:\n" + string(schemaJSON),
+		},
+	}
+	if request.Input != "" {
+		messages = append(messages, types.OpenRouterMessage{
+			Role:    "user",
+			Content: request.Input,
+		})
+	}
+
+	var reply string
+	var problems []string
+	for attempt := 1; attempt <= repairs+1; attempt++ {
+		completion, err := h.makeJSONRequest(key, messages, modelConfig, format)
+		if err != nil {
+			return err
+		}
+		reply = *completion
+
+		problems = decodeJSON(request.Schema, reply, out)
+		if len(problems) == 0 {
+			return nil
+		}
+
+		log.Printf("Invalid %s on attempt %d/%d: %s", request.Name, attempt, repairs+1, strings.Join(problems, "; "))
+
+		messages = append(messages,
+			types.OpenRouterMessage{
+				Role:    "assistant",
+				Content: reply,
+			},
+			types.OpenRouterMessage{
+				Role: "user",
+				Content: "That JSON doesn't match the schema:\n- " + strings.Join(problems, "\n- ") +
+					"\nReply with the corrected JSON object only.",
+			},
+		)
+	}
+
+	return &JSONError{
+		Name:     request.Name,
+		Attempts: repairs + 1,
+		Problems: problems,
+		Reply:    reply,
+	}
+}
+
+// decodeJSON validates reply against s and decodes it into out, returning what's wrong with it
+func decodeJSON(s *schema.Schema, reply string, out any) []string {
+	data := []byte(extractJSON(reply))
+
+	problems, err := s.Validate(data)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// makeJSONRequest is makeRequest asking for format from the models of the chain that support it
+func (h *AIHandler) makeJSONRequest(key UsageKey, messages []types.OpenRouterMessage, modelConfig ModelConfig, format *types.ResponseFormat) (*string, error) {
+	response, err := h.callWithFallbacks(key, messages, modelConfig, h.retryPolicy.CallTimeout,
+		func() bool { return true },
+		func(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error) {
+			if supportsStructuredOutputs(modelConfig, request.Model) {
+				request.ResponseFormat = format
+			}
+			return h.provider.Complete(ctx, request)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+
+	return &response.Choices[0].Message.Content, nil
+}
+
+// supportsStructuredOutputs looks up the model in the chain, since fallbacks may differ
+func supportsStructuredOutputs(modelConfig ModelConfig, model string) bool {
+	for _, config := range modelChain(modelConfig) {
+		if config.ModelName == model {
+			return config.StructuredOutputs
+		}
+	}
+	return false
+}
+
+// extractJSON trims anything a model wraps around a JSON object, like code fences
+func extractJSON(text string) string {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return text
+	}
+	return text[start : end+1]
+}
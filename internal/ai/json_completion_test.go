@@ -0,0 +1,109 @@
+package ai
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testVerdict struct {
+	Mood  string `json:"mood" jsonschema:"enum=happy|sad"`
+	Trust int    `json:"trust" jsonschema:"minimum=0,maximum=10"`
+}
+
+func TestCompleteJSONRepairs(t *testing.T) {
+	const valid = `{"mood": "happy", "trust": 4}`
+	const invalid = `{"mood": "furious", "trust": 4}`
+
+	tests := []struct {
+		name         string
+		replies      []string
+		repairs      int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"valid first time", []string{valid}, 0, 1, false},
+		{"fenced reply", []string{"```json\n" + valid + "\n```"}, 0, 1, false},
+		{"repaired", []string{invalid, valid}, 0, 2, false},
+		{"repaired on the last try", []string{invalid, "not json", valid}, 0, 3, false},
+		{"gives up after the default repairs", []string{invalid}, 0, 1 + DefaultJSONRepairs, true},
+		{"custom repairs", []string{invalid}, 4, 5, true},
+		{"repairs disabled", []string{invalid, valid}, -1, 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := NewFakeProvider(test.replies...)
+			h := newTestHandler(provider, testPolicy)
+
+			verdict, err := CompleteJSONAs[testVerdict](h, UsageKey{}, JSONRequest{
+				Name:         "verdict",
+				Instructions: "Judge the player",
+				Input:        "hello",
+				Repairs:      test.repairs,
+			})
+
+			if attempts := len(provider.Requests()); attempts != test.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, test.wantAttempts)
+			}
+
+			if test.wantErr {
+				var jsonErr *JSONError
+				if !errors.As(err, &jsonErr) {
+					t.Fatalf("err = %v, want a *JSONError", err)
+				}
+				if jsonErr.Attempts != test.wantAttempts || len(jsonErr.Problems) == 0 || jsonErr.Reply == "" {
+					t.Errorf("got %+v, want %d attempts with the last reply and its problems", jsonErr, test.wantAttempts)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *verdict != (testVerdict{Mood: "happy", Trust: 4}) {
+				t.Errorf("verdict = %+v", *verdict)
+			}
+		})
+	}
+}
+
+func TestCompleteJSONSendsProblemsBack(t *testing.T) {
+	provider := NewFakeProvider(`{"mood": "furious", "trust": 4}`, `{"mood": "sad", "trust": 1}`)
+	h := newTestHandler(provider, testPolicy)
+
+	if _, err := CompleteJSONAs[testVerdict](h, UsageKey{}, JSONRequest{Name: "verdict", Instructions: "Judge the player"}); err != nil {
+		t.Fatal(err)
+	}
+
+	repair := provider.Requests()[1].Messages
+	if len(repair) != 3 {
+		t.Fatalf("repair request has %d messages, want system, the bad reply and the problems", len(repair))
+	}
+	if repair[1].Role != "assistant" || !strings.Contains(repair[1].Content, "furious") {
+		t.Errorf("the bad reply wasn't sent back: %+v", repair[1])
+	}
+	if repair[2].Role != "user" || !strings.Contains(repair[2].Content, `$.mood: must be one of "happy", "sad"`) {
+		t.Errorf("the problems weren't sent back: %+v", repair[2])
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`{"a": 1}`, `{"a": 1}`},
+		{"```json\n{\"a\": 1}\n```", `{"a": 1}`},
+		{`Sure! {"a": {"b": 2}} Hope that helps.`, `{"a": {"b": 2}}`},
+		{`no json here`, `no json here`},
+		{`} backwards {`, `} backwards {`},
+		{``, ``},
+	}
+
+	for _, test := range tests {
+		if got := extractJSON(test.text); got != test.want {
+			t.Errorf("extractJSON(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
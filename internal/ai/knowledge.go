@@ -0,0 +1,49 @@
+package ai
+
+import (
+	"log"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/types"
+)
+
+// knowledgeCandidates is how much of what an NPC knows is looked up per prompt, the
+// context builder trims it down to what fits
+const knowledgeCandidates = 20
+
+// KnowledgeStore looks up what an NPC has seen or heard the player do
+type KnowledgeStore interface {
+	GetKnowledge(unityID string, npcID string, limit int) ([]types.DBKnowledge, error)
+}
+
+// SetKnowledgeStore gives every NPC only what they witnessed or heard through gossip,
+// in place of the player's recent events
+func (h *AIHandler) SetKnowledgeStore(store KnowledgeStore) {
+	h.knowledge = store
+}
+
+// recallKnowledge returns what the NPC knows about the player and from whom, for the prompt
+func (h *AIHandler) recallKnowledge(unityID string, npcPersonality types.NPC) []prompts.Knowledge {
+	if h.knowledge == nil || unityID == "" {
+		return nil
+	}
+
+	known, err := h.knowledge.GetKnowledge(unityID, npcPersonality.ID, knowledgeCandidates)
+	if err != nil {
+		log.Printf("Could not get knowledge of %s about %s: %v", npcPersonality.ID, unityID, err)
+		return nil
+	}
+
+	knowledge := make([]prompts.Knowledge, 0, len(known))
+	for _, item := range known {
+		source := item.SourceNpcID
+		if teller, exists := (*h.npcConfigs)[source]; exists {
+			source = teller.Name
+		}
+		knowledge = append(knowledge, prompts.Knowledge{
+			Content: item.Content,
+			Source:  source,
+		})
+	}
+
+	return knowledge
+}
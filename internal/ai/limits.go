@@ -0,0 +1,26 @@
+package ai
+
+import (
+	"math/rand/v2"
+	"rd-backend/internal/types"
+)
+
+const defaultBreakLine = "I need a little break. Talk to you later?"
+
+// GetBreakLine is what the NPC says, without calling a model, when the player has sent
+// too many messages
+func (h *AIHandler) GetBreakLine(npcId string) string {
+	return breakLine((*h.npcConfigs)[npcId])
+}
+
+// GetTextBreakLine is GetBreakLine for the NPC texting from aiNumber
+func (h *AIHandler) GetTextBreakLine(aiNumber string) string {
+	return h.GetBreakLine((*h.npcPhoneNumbers)[aiNumber])
+}
+
+func breakLine(npcPersonality types.NPC) string {
+	if len(npcPersonality.BreakLines) == 0 {
+		return defaultBreakLine
+	}
+	return npcPersonality.BreakLines[rand.IntN(len(npcPersonality.BreakLines))]
+}
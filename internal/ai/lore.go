@@ -0,0 +1,21 @@
+package ai
+
+// recalledLore is how many lore passages are looked up per message
+const recalledLore = 4
+
+// LoreRetriever finds the lore an NPC knows that relates to a message
+type LoreRetriever interface {
+	Retrieve(query string, npcID string, limit int) []string
+}
+
+// SetLore adds lore related to the player's message to chat prompts
+func (h *AIHandler) SetLore(retriever LoreRetriever) {
+	h.lore = retriever
+}
+
+func (h *AIHandler) recallLore(npcId string, message string) []string {
+	if h.lore == nil {
+		return nil
+	}
+	return h.lore.Retrieve(message, npcId, recalledLore)
+}
@@ -0,0 +1,71 @@
+package ai
+
+import (
+	"fmt"
+	"log"
+	"rd-backend/internal/types"
+)
+
+// MemoryStore finds the player's past messages and events that are related to a query
+type MemoryStore interface {
+	SearchMemories(unityID string, npcID string, embedding []float32, limit int) ([]types.DBMemory, error)
+}
+
+const (
+	// recalledMemories is how many related memories are looked up per message
+	recalledMemories = 5
+	// minMemorySimilarity filters out memories that only share a word or two with the message
+	minMemorySimilarity = 0.25
+)
+
+// SetMemoryStore turns on semantic recall: chat completions look up past moments related
+// to the player's message and add them to the prompt
+func (h *AIHandler) SetMemoryStore(embedder Embedder, store MemoryStore) {
+	h.embedder = embedder
+	h.memoryStore = store
+}
+
+// recallMemories returns the memories most related to message, formatted for the prompt.
+// Anything already in history, or the message itself, is skipped since the model sees it anyway.
+func (h *AIHandler) recallMemories(unityID string, npcId string, message string, history []types.DBChatMessage) []string {
+	if h.embedder == nil || h.memoryStore == nil || unityID == "" {
+		return nil
+	}
+
+	embeddings, err := h.embedder.Embed([]string{message})
+	if err != nil || len(embeddings) == 0 {
+		log.Printf("Could not embed message for recall: %v", err)
+		return nil
+	}
+
+	found, err := h.memoryStore.SearchMemories(unityID, npcId, embeddings[0], recalledMemories)
+	if err != nil {
+		log.Printf("Could not search memories: %v", err)
+		return nil
+	}
+
+	inHistory := make(map[string]bool, len(history)+1)
+	inHistory[message] = true
+	for _, msg := range history {
+		inHistory[msg.MessageText] = true
+	}
+
+	memories := make([]string, 0, len(found))
+	for _, memory := range found {
+		if memory.Similarity < minMemorySimilarity || inHistory[memory.Content] {
+			continue
+		}
+
+		when := memory.CreatedAt.Format("Jan 2")
+		switch memory.Kind {
+		case types.MemoryKindPlayer:
+			memories = append(memories, fmt.Sprintf("on %s the player told you \"%s\"", when, memory.Content))
+		case types.MemoryKindNPC:
+			memories = append(memories, fmt.Sprintf("on %s you told the player \"%s\"", when, memory.Content))
+		default:
+			memories = append(memories, fmt.Sprintf("on %s: %s", when, memory.Content))
+		}
+	}
+
+	return memories
+}
@@ -0,0 +1,354 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"rd-backend/internal/types"
+	"regexp"
+	"strings"
+)
+
+// Moderation stages
+const (
+	StageInput  = "input"
+	StageOutput = "output"
+)
+
+// Moderation actions
+const (
+	ModerationAllow   = "allow"
+	ModerationRewrite = "rewrite"
+	ModerationBlock   = "block"
+)
+
+// ModerationDecision says what to do with a piece of text. Text is the rewritten
+// version when Action is ModerationRewrite.
+type ModerationDecision struct {
+	Action   string
+	Text     string
+	Category string
+}
+
+// Moderator screens player messages (StageInput) and NPC replies (StageOutput) in the player's
+// conversation with the NPC
+type Moderator interface {
+	Moderate(unityID string, npcID string, stage string, text string) (ModerationDecision, error)
+}
+
+// FlagStore records content the moderators rewrote or blocked, for review
+type FlagStore interface {
+	AddFlaggedContent(unityID string, npcID string, stage string, action string, category string, content string) error
+}
+
+// ModerationRules are the word lists and patterns applied at one stage
+type ModerationRules struct {
+	// BlockWords and BlockPatterns (regular expressions) reject the whole text
+	BlockWords    []string `json:"block_words"`
+	BlockPatterns []string `json:"block_patterns"`
+	// MaskWords are starred out
+	MaskWords []string `json:"mask_words"`
+	// RedactPII replaces emails, phone, card and social security numbers
+	RedactPII bool `json:"redact_pii"`
+}
+
+type ModerationConfig struct {
+	Input  ModerationRules `json:"input"`
+	Output ModerationRules `json:"output"`
+}
+
+func LoadModerationConfig(path string) (*ModerationConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config ModerationConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+var piiPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.-]+`),
+	regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	regexp.MustCompile(`\b(?:\d[ -]?){13,16}\b`),
+	regexp.MustCompile(`(?:\+?\d{1,3}[\s.-]?)?(?:\(\d{3}\)|\d{3})[\s.-]?\d{3}[\s.-]?\d{4}\b`),
+}
+
+// compiledRules is ModerationRules ready to match
+type compiledRules struct {
+	block     []*regexp.Regexp
+	mask      *regexp.Regexp
+	redactPII bool
+}
+
+func compileRules(rules ModerationRules) (*compiledRules, error) {
+	compiled := &compiledRules{
+		redactPII: rules.RedactPII,
+	}
+
+	if len(rules.BlockWords) > 0 {
+		compiled.block = append(compiled.block, wordPattern(rules.BlockWords))
+	}
+
+	for _, pattern := range rules.BlockPatterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block pattern %q: %w", pattern, err)
+		}
+		compiled.block = append(compiled.block, re)
+	}
+
+	if len(rules.MaskWords) > 0 {
+		compiled.mask = wordPattern(rules.MaskWords)
+	}
+
+	return compiled, nil
+}
+
+// wordPattern matches any of words as whole words, ignoring case
+func wordPattern(words []string) *regexp.Regexp {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// RuleModerator applies word lists, regular expressions and PII patterns, with no model calls
+type RuleModerator struct {
+	input  *compiledRules
+	output *compiledRules
+}
+
+func NewRuleModerator(config *ModerationConfig) (*RuleModerator, error) {
+	input, err := compileRules(config.Input)
+	if err != nil {
+		return nil, fmt.Errorf("input rules: %w", err)
+	}
+
+	output, err := compileRules(config.Output)
+	if err != nil {
+		return nil, fmt.Errorf("output rules: %w", err)
+	}
+
+	return &RuleModerator{
+		input:  input,
+		output: output,
+	}, nil
+}
+
+func (m *RuleModerator) Moderate(unityID string, npcID string, stage string, text string) (ModerationDecision, error) {
+	rules := m.input
+	if stage == StageOutput {
+		rules = m.output
+	}
+
+	for _, re := range rules.block {
+		if re.MatchString(text) {
+			return ModerationDecision{Action: ModerationBlock, Category: "blocked_content"}, nil
+		}
+	}
+
+	decision := ModerationDecision{Action: ModerationAllow, Text: text}
+
+	if rules.mask != nil && rules.mask.MatchString(decision.Text) {
+		decision.Text = rules.mask.ReplaceAllStringFunc(decision.Text, func(word string) string {
+			return strings.Repeat("*", len(word))
+		})
+		decision.Action = ModerationRewrite
+		decision.Category = "profanity"
+	}
+
+	if rules.redactPII {
+		for _, re := range piiPatterns {
+			if re.MatchString(decision.Text) {
+				decision.Text = re.ReplaceAllString(decision.Text, "[redacted]")
+				decision.Action = ModerationRewrite
+				decision.Category = "pii"
+			}
+		}
+	}
+
+	return decision, nil
+}
+
+// LLMModerator asks a model whether the text is fit for a teen-rated game sent over SMS
+type LLMModerator struct {
+	aiHandler *AIHandler
+}
+
+func NewLLMModerator(aiHandler *AIHandler) *LLMModerator {
+	return &LLMModerator{
+		aiHandler: aiHandler,
+	}
+}
+
+// moderationVerdict is what LLMModerator asks the model for
+type moderationVerdict struct {
+	Allowed  bool   `json:"allowed"`
+	Category string `json:"category" jsonschema:"description=What kind of content was found, none if allowed"`
+}
+
+func (m *LLMModerator) Moderate(unityID string, npcID string, stage string, text string) (ModerationDecision, error) {
+	speaker := "a player's message to a game character"
+	if stage == StageOutput {
+		speaker = "a game character's reply to a player"
+	}
+
+	verdict, err := CompleteJSONAs[moderationVerdict](m.aiHandler, UsageKey{UnityID: unityID, NpcID: npcID, CallType: CallModeration}, JSONRequest{
+		Name: "moderation_verdict",
+		Instructions: fmt.Sprintf(
+			"You moderate %s in a teen-rated life-sim game whose messages are also sent by SMS. "+
+				"Flirting, mild language and playful teasing are fine. Harassment, hate, sexual content, "+
+				"self-harm encouragement, threats and illegal activity are not.",
+			speaker,
+		),
+		Input: text,
+	})
+	if err != nil {
+		return ModerationDecision{}, err
+	}
+
+	if !verdict.Allowed {
+		return ModerationDecision{Action: ModerationBlock, Category: verdict.Category}, nil
+	}
+	return ModerationDecision{Action: ModerationAllow, Text: text}, nil
+}
+
+// ChainModerator runs moderators in order. A block stops the chain, and rewrites
+// are passed on so later moderators see the rewritten text.
+type ChainModerator []Moderator
+
+func (c ChainModerator) Moderate(unityID string, npcID string, stage string, text string) (ModerationDecision, error) {
+	decision := ModerationDecision{Action: ModerationAllow, Text: text}
+
+	for _, moderator := range c {
+		next, err := moderator.Moderate(unityID, npcID, stage, decision.Text)
+		if err != nil {
+			// Fail open, a moderator being down shouldn't take the game down with it
+			log.Printf("Moderator failed on %s, skipping: %v", stage, err)
+			continue
+		}
+
+		switch next.Action {
+		case ModerationBlock:
+			return next, nil
+		case ModerationRewrite:
+			decision = next
+		}
+	}
+
+	return decision, nil
+}
+
+// SetModeration screens player messages and NPC replies. Blocked replies are swapped for
+// one of the NPC's deflections and everything that isn't allowed as-is goes to flags.
+func (h *AIHandler) SetModeration(moderator Moderator, flags FlagStore) {
+	h.moderator = moderator
+	h.flagStore = flags
+}
+
+const defaultDeflection = "Hmm, let's talk about something else."
+
+// deflection picks one of the NPC's in-character ways of changing the subject.
+// The choice depends on the text so the same message always gets the same answer.
+func deflection(npcPersonality types.NPC, text string) string {
+	if len(npcPersonality.Deflections) == 0 {
+		return defaultDeflection
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(text))
+	return npcPersonality.Deflections[hash.Sum32()%uint32(len(npcPersonality.Deflections))]
+}
+
+// moderate runs the moderator and records anything it didn't allow as-is. It returns the
+// text to use and whether it was blocked.
+func (h *AIHandler) moderate(unityID string, npcPersonality types.NPC, stage string, text string) (string, bool) {
+	if h.moderator == nil || text == "" {
+		return text, false
+	}
+
+	decision, err := h.moderator.Moderate(unityID, npcPersonality.ID, stage, text)
+	if err != nil {
+		log.Printf("Moderation failed on %s for %s: %v", stage, unityID, err)
+		return text, false
+	}
+
+	if decision.Action == ModerationAllow {
+		return text, false
+	}
+
+	log.Printf("Moderation %s %s for %s/%s (%s)", decision.Action, stage, unityID, npcPersonality.ID, decision.Category)
+	if h.flagStore != nil {
+		if err := h.flagStore.AddFlaggedContent(unityID, npcPersonality.ID, stage, decision.Action, decision.Category, text); err != nil {
+			log.Printf("Could not record flagged content: %v", err)
+		}
+	}
+
+	if decision.Action == ModerationBlock {
+		return deflection(npcPersonality, text), true
+	}
+	return decision.Text, false
+}
+
+// ScreenedInput is a player message after moderation and the injection checks
+type ScreenedInput struct {
+	// Text is the message with anything the moderators masked or redacted, the only version
+	// that should be stored or sent to a model
+	Text string
+	// Reply is the NPC's deflection when the message was blocked, it isn't answered then
+	Reply string
+	// Guard is set when the message tries to take over the NPC, who is told to stay in character
+	Guard bool
+}
+
+// Blocked is whether the message mustn't be stored or answered, Reply is all the player gets
+func (i ScreenedInput) Blocked() bool {
+	return i.Reply != ""
+}
+
+// ScreenInput moderates a player's message to npcId and checks it for attempts to take over
+// the NPC, recording anything found. Messages from the game itself don't need screening and
+// can be passed as ScreenedInput{Text: text}.
+func (h *AIHandler) ScreenInput(unityID string, npcId string, message string) ScreenedInput {
+	npcPersonality, exists := (*h.npcConfigs)[npcId]
+	if !exists {
+		return ScreenedInput{Text: message}
+	}
+
+	message, blocked := h.moderate(unityID, npcPersonality, StageInput, message)
+	if blocked {
+		return ScreenedInput{Reply: message}
+	}
+
+	guard, deflect := h.screenInput(unityID, npcPersonality, message)
+	if deflect {
+		return ScreenedInput{Reply: deflection(npcPersonality, message)}
+	}
+	return ScreenedInput{Text: message, Guard: guard}
+}
+
+// ScreenText is ScreenInput for a text to the NPC at aiNumber
+func (h *AIHandler) ScreenText(unityID string, aiNumber string, message string) ScreenedInput {
+	return h.ScreenInput(unityID, (*h.npcPhoneNumbers)[aiNumber], message)
+}
+
+// moderateResult checks the NPC's reply in place. Actions are kept even when the line is
+// blocked since their tools have already run.
+func (h *AIHandler) moderateResult(unityID string, npcPersonality types.NPC, result *ChatResult) {
+	if result == nil {
+		return
+	}
+
+	moderated, _ := h.moderate(unityID, npcPersonality, StageOutput, result.Completion)
+	if moderated != result.Completion {
+		result.Completion = moderated
+		result.Moderated = true
+	}
+}
@@ -0,0 +1,233 @@
+package ai
+
+import (
+	"errors"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/types"
+	"testing"
+)
+
+func TestRuleModerator(t *testing.T) {
+	moderator, err := NewRuleModerator(&ModerationConfig{
+		Input: ModerationRules{
+			BlockWords:    []string{"kill yourself"},
+			BlockPatterns: []string{`meet (me|up) irl`},
+			MaskWords:     []string{"darn", "heck"},
+			RedactPII:     true,
+		},
+		Output: ModerationRules{
+			MaskWords: []string{"darn"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		stage    string
+		text     string
+		action   string
+		want     string
+		category string
+	}{
+		{"clean", StageInput, "Lovely weather today", ModerationAllow, "Lovely weather today", ""},
+		{"block word ignoring case", StageInput, "just KILL YOURSELF", ModerationBlock, "", "blocked_content"},
+		{"block pattern", StageInput, "we should meet up IRL", ModerationBlock, "", "blocked_content"},
+		{"masked", StageInput, "darn it, Heck!", ModerationRewrite, "**** it, ****!", "profanity"},
+		{"whole words only", StageInput, "the heckler sat down", ModerationAllow, "the heckler sat down", ""},
+		{"email", StageInput, "write to me at bea@example.com", ModerationRewrite, "write to me at [redacted]", "pii"},
+		{"phone", StageInput, "call (555) 123-4567 tonight", ModerationRewrite, "call [redacted] tonight", "pii"},
+		{"social security number", StageInput, "mine is 123-45-6789", ModerationRewrite, "mine is [redacted]", "pii"},
+		{"mask and redact", StageInput, "darn, mail bea@example.com", ModerationRewrite, "****, mail [redacted]", "pii"},
+		{"output has its own rules", StageOutput, "darn, mail bea@example.com", ModerationRewrite, "****, mail bea@example.com", "profanity"},
+		{"output doesn't block input words", StageOutput, "kill yourself", ModerationAllow, "kill yourself", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision, err := moderator.Moderate("player", "bea", test.stage, test.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Action != test.action || decision.Text != test.want || decision.Category != test.category {
+				t.Errorf("got %+v, want %s %q (%s)", decision, test.action, test.want, test.category)
+			}
+		})
+	}
+}
+
+func TestRuleModeratorInvalidPattern(t *testing.T) {
+	_, err := NewRuleModerator(&ModerationConfig{Output: ModerationRules{BlockPatterns: []string{"("}}})
+	if err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
+
+// stubModerator always decides the same, or fails
+type stubModerator struct {
+	decision ModerationDecision
+	err      error
+	seen     []string
+}
+
+func (m *stubModerator) Moderate(unityID string, npcID string, stage string, text string) (ModerationDecision, error) {
+	m.seen = append(m.seen, text)
+	return m.decision, m.err
+}
+
+func TestChainModerator(t *testing.T) {
+	allow := ModerationDecision{Action: ModerationAllow}
+	rewrite := ModerationDecision{Action: ModerationRewrite, Text: "rewritten", Category: "pii"}
+	block := ModerationDecision{Action: ModerationBlock, Category: "threat"}
+
+	tests := []struct {
+		name      string
+		decisions []ModerationDecision
+		fails     int
+		want      ModerationDecision
+		wantSeen  []int
+		// passedOn is the text the second moderator should see
+		passedOn string
+	}{
+		{"all allow", []ModerationDecision{allow, allow}, -1, ModerationDecision{Action: ModerationAllow, Text: "text"}, []int{1, 1}, "text"},
+		{"rewrite is passed on", []ModerationDecision{rewrite, allow}, -1, rewrite, []int{1, 1}, "rewritten"},
+		{"block stops the chain", []ModerationDecision{block, allow}, -1, block, []int{1, 0}, ""},
+		{"block after a rewrite", []ModerationDecision{rewrite, block}, -1, block, []int{1, 1}, "rewritten"},
+		{"failures are skipped", []ModerationDecision{block, rewrite}, 0, rewrite, []int{1, 1}, "text"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var chain ChainModerator
+			var stubs []*stubModerator
+			for i, decision := range test.decisions {
+				stub := &stubModerator{decision: decision}
+				if i == test.fails {
+					stub.err = errors.New("moderator down")
+				}
+				stubs = append(stubs, stub)
+				chain = append(chain, stub)
+			}
+
+			decision, err := chain.Moderate("player", "bea", StageInput, "text")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision != test.want {
+				t.Errorf("decision = %+v, want %+v", decision, test.want)
+			}
+
+			for i, stub := range stubs {
+				if len(stub.seen) != test.wantSeen[i] {
+					t.Errorf("moderator %d ran %d times, want %d", i, len(stub.seen), test.wantSeen[i])
+				}
+			}
+			if test.passedOn != "" && stubs[1].seen[0] != test.passedOn {
+				t.Errorf("second moderator saw %q, want %q", stubs[1].seen[0], test.passedOn)
+			}
+		})
+	}
+}
+
+func TestDeflection(t *testing.T) {
+	npcPersonality := types.NPC{Deflections: []string{"Oh look, a bird!", "Anyway, how's the weather?"}}
+
+	if got := deflection(types.NPC{}, "anything"); got != defaultDeflection {
+		t.Errorf("deflection without any = %q, want the default", got)
+	}
+
+	first := deflection(npcPersonality, "some message")
+	if first != npcPersonality.Deflections[0] && first != npcPersonality.Deflections[1] {
+		t.Errorf("deflection = %q, want one of the NPC's", first)
+	}
+	if again := deflection(npcPersonality, "some message"); again != first {
+		t.Errorf("the same message got %q then %q", first, again)
+	}
+}
+
+func TestScreenInput(t *testing.T) {
+	moderator, err := NewRuleModerator(&ModerationConfig{
+		Input: ModerationRules{BlockWords: []string{"kill yourself"}, RedactPII: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	npcs := npc.NPCs{"bea": {ID: "bea", Deflections: []string{"Oh look, a bird!"}}}
+	h := NewAIHandler(NewFakeProvider(), &npcs, &npc.NPCNumbers{"+15550100": "bea"})
+	h.SetModeration(moderator, nil)
+
+	tests := []struct {
+		name    string
+		npcID   string
+		message string
+		want    ScreenedInput
+	}{
+		{"allowed", "bea", "hello", ScreenedInput{Text: "hello"}},
+		{"redacted", "bea", "mail me at bea@example.com", ScreenedInput{Text: "mail me at [redacted]"}},
+		{"blocked", "bea", "kill yourself", ScreenedInput{Reply: "Oh look, a bird!"}},
+		{"unknown NPC", "nobody", "kill yourself", ScreenedInput{Text: "kill yourself"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := h.ScreenInput("player", test.npcID, test.message); got != test.want {
+				t.Errorf("ScreenInput = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+
+	if got := h.ScreenText("player", "+15550100", "kill yourself"); !got.Blocked() {
+		t.Errorf("ScreenText = %+v, want it blocked", got)
+	}
+}
+
+// recordingFlags keeps what was flagged
+type recordingFlags struct {
+	flagged []string
+}
+
+func (f *recordingFlags) AddFlaggedContent(unityID string, npcID string, stage string, action string, category string, content string) error {
+	f.flagged = append(f.flagged, stage+": "+content)
+	return nil
+}
+
+func TestFilterSuggestion(t *testing.T) {
+	moderator, err := NewRuleModerator(&ModerationConfig{
+		Input:  ModerationRules{BlockWords: []string{"pie"}},
+		Output: ModerationRules{BlockWords: []string{"darn"}, RedactPII: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := &recordingFlags{}
+	h := NewAIHandler(NewFakeProvider(), &npc.NPCs{}, &npc.NPCNumbers{})
+	h.SetModeration(moderator, flags)
+
+	tests := []struct {
+		name string
+		text string
+		want string
+		ok   bool
+	}{
+		{"allowed", "Nice weather today.", "Nice weather today.", true},
+		{"output rules, not input ones", "Can I have some pie?", "Can I have some pie?", true},
+		{"blocked", "Oh darn it.", "", false},
+		{"redacted", "Write to me at me@example.com", "Write to me at [redacted]", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := h.filterSuggestion("player", "bea", test.text)
+			if got != test.want || ok != test.ok {
+				t.Errorf("filterSuggestion = %q, %v, want %q, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+
+	if len(flags.flagged) != 0 {
+		t.Errorf("suggestions were flagged against the player: %v", flags.flagged)
+	}
+}
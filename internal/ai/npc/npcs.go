@@ -3,9 +3,9 @@ package npc
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"rd-backend/internal/types"
-	"strings"
 )
 
 type NPCs map[string]types.NPC
@@ -18,70 +18,68 @@ func LoadNPCConfig(path string) (NPCs, error) {
 	}
 
 	var npcs NPCs
-	err = json.Unmarshal(data, &npcs)
-	return npcs, err
-}
+	if err := json.Unmarshal(data, &npcs); err != nil {
+		return nil, err
+	}
 
-func BuildPhoneIndex(npcs map[string]types.NPC) NPCNumbers {
-	index := make(NPCNumbers)
-	for _, npc := range npcs {
-		index[npc.PhoneNumber] = npc.ID
+	for id, npc := range npcs {
+		if err := validateNPCModel(npc.Model); err != nil {
+			return nil, fmt.Errorf("invalid model block for %s: %w", id, err)
+		}
+		if err := validateSchedule(npc.Schedule); err != nil {
+			return nil, fmt.Errorf("invalid schedule for %s: %w", id, err)
+		}
+		if err := validateTexting(npc.Texting); err != nil {
+			return nil, fmt.Errorf("invalid texting for %s: %w", id, err)
+		}
 	}
-	return index
-}
 
-func GenerateSystemPrompt(npc types.NPC) string {
-	return fmt.Sprintf(
-		"You're %s! You're working on %s in %s. Quick bio: %s "+
-			"Your friends would describe you as %s. "+
-			"People can't help but notice how you %s. "+
-			"These days, you're focused on %s. "+
-			"When chatting, %s. "+
-			"Remember to be natural and let your personality shine - no need to stick to formal speech patterns!",
-		npc.Name,
-		npc.Occupation,
-		npc.Location,
-		npc.Backstory,
-		strings.Join(npc.Traits, ", "),
-		strings.Join(npc.Quirks, " and "),
-		npc.Goals,
-		npc.SpeechStyle,
-	)
+	return npcs, nil
 }
 
-func GenerateSystemPromptWithEvents(npc types.NPC, events []types.DBPlayerEvent) string {
-	// Build the base prompt
-	basePrompt := fmt.Sprintf(
-		"You're %s! You're working on %s in %s. Quick bio: %s "+
-			"Your friends would describe you as %s. "+
-			"People can't help but notice how you %s. "+
-			"These days, you're focused on %s. "+
-			"When chatting, %s.",
-		npc.Name,
-		npc.Occupation,
-		npc.Location,
-		npc.Backstory,
-		strings.Join(npc.Traits, ", "),
-		strings.Join(npc.Quirks, " and "),
-		npc.Goals,
-		npc.SpeechStyle,
-	)
+// validateNPCModel checks the optional model block against the ranges providers accept
+func validateNPCModel(model *types.NPCModel) error {
+	if model == nil {
+		return nil
+	}
 
-	// If there are events, add them to the prompt
-	if len(events) > 0 {
-		eventDetails := make([]string, 0, len(events))
-		for _, event := range events {
-			eventDetails = append(eventDetails, event.EventDetails)
+	inRange := func(name string, value *float64, min float64, max float64) error {
+		if value != nil && (*value < min || *value > max) {
+			return fmt.Errorf("%s must be between %g and %g, got %g", name, min, max, *value)
 		}
+		return nil
+	}
 
-		basePrompt += fmt.Sprintf(
-			"\nThese are the things that the player has done recently, use these to inform your response: %s",
-			strings.Join(eventDetails, "; "),
-		)
+	if err := inRange("temperature", model.Temperature, 0, 2); err != nil {
+		return err
+	}
+	if err := inRange("top_p", model.TopP, 0, 1); err != nil {
+		return err
+	}
+	if err := inRange("presence_penalty", model.PresencePenalty, -2, 2); err != nil {
+		return err
+	}
+	if err := inRange("frequency_penalty", model.FrequencyPenalty, -2, 2); err != nil {
+		return err
+	}
+	if model.MaxTokens != nil && *model.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be positive, got %d", *model.MaxTokens)
+	}
+	if len(model.ProviderOrder) > 0 && model.ModelName == "" {
+		return fmt.Errorf("provider_order needs a model_name")
 	}
 
-	// Add the personality reminder
-	basePrompt += "\nRemember to be natural and let your personality shine - no need to stick to formal speech patterns!"
+	return nil
+}
 
-	return basePrompt
+func BuildPhoneIndex(npcs map[string]types.NPC) NPCNumbers {
+	index := make(NPCNumbers)
+	for _, npc := range npcs {
+		// Texts to a shared number reach only one of the NPCs
+		if other, exists := index[npc.PhoneNumber]; exists && npc.PhoneNumber != "" {
+			log.Printf("%s and %s share the phone number %s", other, npc.ID, npc.PhoneNumber)
+		}
+		index[npc.PhoneNumber] = npc.ID
+	}
+	return index
 }
@@ -0,0 +1,64 @@
+package npc
+
+import "rd-backend/internal/types"
+
+// Relationship stages, from worst to best
+const (
+	StageHostile     = "hostile"
+	StageWary        = "wary"
+	StageStranger    = "stranger"
+	StageAcquainted  = "acquaintance"
+	StageFriend      = "friend"
+	StageCloseFriend = "close_friend"
+)
+
+// stageThresholds is the lowest affinity of every stage, best first
+var stageThresholds = []struct {
+	stage    string
+	affinity int
+}{
+	{StageCloseFriend, 75},
+	{StageFriend, 40},
+	{StageAcquainted, 10},
+	{StageStranger, -10},
+	{StageWary, -40},
+	{StageHostile, -100},
+}
+
+// defaultTones is how NPCs without relationship_tones in npc.json act at each stage
+var defaultTones = map[string]string{
+	StageHostile:     "You really don't like the player. Be short with them and don't hide it.",
+	StageWary:        "You don't trust the player much. Be polite but guarded.",
+	StageStranger:    "You don't know the player yet. Be friendly in the way you'd be with anyone new.",
+	StageAcquainted:  "You know the player a little. Be relaxed and open with them.",
+	StageFriend:      "The player is a friend. Be warm, tease them a little and share more about yourself.",
+	StageCloseFriend: "The player is one of your closest friends. Be affectionate and completely yourself with them.",
+}
+
+// StageFor returns the relationship stage of an affinity score
+func StageFor(affinity int) string {
+	for _, threshold := range stageThresholds {
+		if affinity >= threshold.affinity {
+			return threshold.stage
+		}
+	}
+	return StageHostile
+}
+
+// StageRank orders the stages from hostile (0) up, -1 for unknown stages
+func StageRank(stage string) int {
+	for i, threshold := range stageThresholds {
+		if threshold.stage == stage {
+			return len(stageThresholds) - 1 - i
+		}
+	}
+	return -1
+}
+
+// Tone is how the NPC should act towards the player at a stage
+func Tone(npc types.NPC, stage string) string {
+	if tone, exists := npc.RelationshipTones[stage]; exists {
+		return tone
+	}
+	return defaultTones[stage]
+}
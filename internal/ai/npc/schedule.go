@@ -0,0 +1,72 @@
+package npc
+
+import (
+	"fmt"
+	"rd-backend/internal/types"
+)
+
+// MinutesPerDay is the length of a game day
+const MinutesPerDay = 24 * 60
+
+// ParseClock reads a game time of day like "21:30" as minutes since midnight
+func ParseClock(value string) (int, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &minutes); err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	if hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || hours == 24 && minutes != 0 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return (hours*60 + minutes) % MinutesPerDay, nil
+}
+
+// FormatClock writes minutes since midnight as "HH:MM"
+func FormatClock(minute int) string {
+	minute = ((minute % MinutesPerDay) + MinutesPerDay) % MinutesPerDay
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+// At returns the schedule entry the NPC is in at minute, false when the schedule doesn't cover it.
+// Entries are checked in order, so an earlier one wins where they overlap.
+func At(npc types.NPC, minute int) (types.ScheduleEntry, bool) {
+	for _, entry := range npc.Schedule {
+		if Between(entry.From, entry.To, minute) {
+			return entry, true
+		}
+	}
+	return types.ScheduleEntry{}, false
+}
+
+// Between is whether minute falls from from up to to ("HH:MM"), which may run past midnight.
+// It's false when either time doesn't parse.
+func Between(from string, to string, minute int) bool {
+	start, errFrom := ParseClock(from)
+	end, errTo := ParseClock(to)
+	if errFrom != nil || errTo != nil {
+		return false
+	}
+
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	// Runs past midnight
+	return minute >= start || minute < end
+}
+
+func validateSchedule(schedule []types.ScheduleEntry) error {
+	for i, entry := range schedule {
+		if _, err := ParseClock(entry.From); err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+		if _, err := ParseClock(entry.To); err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+		if entry.From == entry.To {
+			return fmt.Errorf("entry %d is empty, from and to are both %s", i, entry.From)
+		}
+		if entry.Location == "" {
+			return fmt.Errorf("entry %d has no location", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package npc
+
+import (
+	"rd-backend/internal/types"
+	"testing"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"00:00", 0, false},
+		{"07:30", 450, false},
+		{"7:05", 425, false},
+		{"23:59", 1439, false},
+		{"24:00", 0, false},
+		{"24:01", 0, true},
+		{"25:00", 0, true},
+		{"12:60", 0, true},
+		{"-1:00", 0, true},
+		{"noon", 0, true},
+		{"", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseClock(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseClock(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseClock(%q) = %d, want %d", test.value, got, test.want)
+		}
+	}
+}
+
+func TestFormatClock(t *testing.T) {
+	tests := []struct {
+		minute int
+		want   string
+	}{
+		{0, "00:00"},
+		{450, "07:30"},
+		{1439, "23:59"},
+		{1440, "00:00"},
+		{1500, "01:00"},
+		{-30, "23:30"},
+	}
+
+	for _, test := range tests {
+		if got := FormatClock(test.minute); got != test.want {
+			t.Errorf("FormatClock(%d) = %q, want %q", test.minute, got, test.want)
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	npcPersonality := types.NPC{Schedule: []types.ScheduleEntry{
+		{From: "08:00", To: "12:00", Location: "bakery"},
+		{From: "11:00", To: "14:00", Location: "market"},
+		{From: "22:00", To: "06:00", Location: "home"},
+		{From: "bad", To: "23:00", Location: "nowhere"},
+	}}
+
+	tests := []struct {
+		time string
+		want string
+	}{
+		{"08:00", "bakery"},
+		{"11:30", "bakery"},
+		{"12:00", "market"},
+		{"13:59", "market"},
+		{"14:00", ""},
+		{"21:59", ""},
+		{"22:00", "home"},
+		{"00:00", "home"},
+		{"05:59", "home"},
+		{"06:00", ""},
+	}
+
+	for _, test := range tests {
+		minute, _ := ParseClock(test.time)
+		entry, ok := At(npcPersonality, minute)
+		if ok != (test.want != "") || entry.Location != test.want {
+			t.Errorf("At(%s) = %q, %v, want %q", test.time, entry.Location, ok, test.want)
+		}
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		from, to string
+		time     string
+		want     bool
+	}{
+		{"09:00", "17:00", "09:00", true},
+		{"09:00", "17:00", "16:59", true},
+		{"09:00", "17:00", "17:00", false},
+		{"09:00", "17:00", "08:59", false},
+		{"22:00", "02:00", "22:00", true},
+		{"22:00", "02:00", "23:59", true},
+		{"22:00", "02:00", "00:00", true},
+		{"22:00", "02:00", "01:59", true},
+		{"22:00", "02:00", "02:00", false},
+		{"22:00", "02:00", "12:00", false},
+		{"later", "17:00", "12:00", false},
+		{"09:00", "", "12:00", false},
+	}
+
+	for _, test := range tests {
+		minute, _ := ParseClock(test.time)
+		if got := Between(test.from, test.to, minute); got != test.want {
+			t.Errorf("Between(%s, %s, %s) = %v, want %v", test.from, test.to, test.time, got, test.want)
+		}
+	}
+}
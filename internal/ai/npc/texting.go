@@ -0,0 +1,63 @@
+package npc
+
+import (
+	"fmt"
+	"rd-backend/internal/types"
+)
+
+func validateTexting(texting *types.Texting) error {
+	if texting == nil {
+		return nil
+	}
+	if texting.DailyCap < 0 {
+		return fmt.Errorf("daily_cap can't be negative")
+	}
+
+	ids := make(map[string]bool)
+	for i, trigger := range texting.Triggers {
+		if trigger.ID == "" {
+			return fmt.Errorf("trigger %d has no id", i)
+		}
+		if ids[trigger.ID] {
+			return fmt.Errorf("trigger id %s is used twice", trigger.ID)
+		}
+		ids[trigger.ID] = true
+
+		if trigger.Prompt == "" {
+			return fmt.Errorf("trigger %s has no prompt", trigger.ID)
+		}
+		if trigger.CooldownMinutes < 0 || trigger.MaxPerPlayer < 0 {
+			return fmt.Errorf("trigger %s can't have a negative cooldown_minutes or max_per_player", trigger.ID)
+		}
+
+		switch trigger.Kind {
+		case types.TriggerTime:
+			if _, err := ParseClock(trigger.From); err != nil {
+				return fmt.Errorf("trigger %s: %w", trigger.ID, err)
+			}
+			if _, err := ParseClock(trigger.To); err != nil {
+				return fmt.Errorf("trigger %s: %w", trigger.ID, err)
+			}
+			// Without one it would fire on every check while the player's clock is in the window
+			if trigger.CooldownMinutes == 0 {
+				return fmt.Errorf("trigger %s needs a cooldown_minutes", trigger.ID)
+			}
+		case types.TriggerInactivity:
+			if trigger.InactiveHours <= 0 {
+				return fmt.Errorf("trigger %s needs inactive_hours", trigger.ID)
+			}
+		case types.TriggerEvent:
+			if trigger.EventType == "" {
+				return fmt.Errorf("trigger %s needs an event_type", trigger.ID)
+			}
+		case types.TriggerAffinity:
+			if StageRank(trigger.Stage) < 0 {
+				return fmt.Errorf("trigger %s has unknown stage %q", trigger.ID, trigger.Stage)
+			}
+		default:
+			return fmt.Errorf("trigger %s has unknown kind %q", trigger.ID, trigger.Kind)
+		}
+	}
+
+	return nil
+}
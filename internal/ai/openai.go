@@ -0,0 +1,226 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rd-backend/internal/types"
+	"strings"
+)
+
+// chatClient does the HTTP and SSE work shared by every OpenAI-compatible provider
+type chatClient struct {
+	client  *http.Client
+	baseURL string
+	headers map[string]string
+}
+
+func (c *chatClient) newRequest(ctx context.Context, request types.OpenRouterRequest) (*http.Request, error) {
+	jsonBody, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	if request.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	return req, nil
+}
+
+func (c *chatClient) complete(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error) {
+	request.Stream = false
+
+	req, err := c.newRequest(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var response types.OpenRouterResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return &response, nil
+}
+
+func (c *chatClient) stream(ctx context.Context, request types.OpenRouterRequest, onDelta func(string) error) (*types.OpenRouterResponse, error) {
+	request.Stream = true
+
+	request.StreamOptions = &types.StreamOptions{IncludeUsage: true}
+
+	var completion strings.Builder
+	var toolCalls []types.ToolCall
+	var id, model string
+	var usage *types.Usage
+	response := func() *types.OpenRouterResponse {
+		return &types.OpenRouterResponse{
+			ID:    id,
+			Model: model,
+			Choices: []types.OpenRouterChoice{
+				{Message: types.OpenRouterMessage{Role: "assistant", Content: completion.String(), ToolCalls: toolCalls}},
+			},
+			Usage: usage,
+		}
+	}
+
+	req, err := c.newRequest(ctx, request)
+	if err != nil {
+		return response(), err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return response(), fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return response(), newAPIError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Blank lines separate events, lines starting with ':' are keep-alive comments
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+
+		if data == "[DONE]" {
+			return response(), nil
+		}
+
+		var chunk types.OpenRouterStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return response(), fmt.Errorf("error decoding stream chunk: %w", err)
+		}
+
+		if chunk.Error != nil {
+			return response(), &APIError{StatusCode: chunk.Error.Code, Body: chunk.Error.Message}
+		}
+
+		if chunk.ID != "" {
+			id = chunk.ID
+		}
+		if chunk.Model != "" {
+			model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+
+		for _, choice := range chunk.Choices {
+			// Tool calls arrive in fragments, the first one for each index carries the ID and name
+			for _, delta := range choice.Delta.ToolCalls {
+				if delta.Index < 0 {
+					continue
+				}
+				for len(toolCalls) <= delta.Index {
+					toolCalls = append(toolCalls, types.ToolCall{Type: "function"})
+				}
+				call := &toolCalls[delta.Index]
+				if delta.ID != "" {
+					call.ID = delta.ID
+				}
+				call.Function.Name += delta.Function.Name
+				call.Function.Arguments += delta.Function.Arguments
+			}
+
+			if choice.Delta.Content == "" {
+				continue
+			}
+
+			completion.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return response(), fmt.Errorf("%w: %w", ErrStreamAborted, err)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return response(), fmt.Errorf("error reading stream: %w", err)
+	}
+
+	// The connection closed without a [DONE] marker
+	return response(), fmt.Errorf("stream ended unexpectedly")
+}
+
+// OpenAIProvider talks to any server implementing the OpenAI chat completions API,
+// e.g. a llama.cpp or Ollama server running on a laptop
+type OpenAIProvider struct {
+	chatClient
+	model string
+}
+
+// NewOpenAIProvider creates a provider for baseURL. apiKey may be empty for local servers.
+// When model is set it replaces the model name of every request, since a local server
+// only serves whatever it has loaded.
+func NewOpenAIProvider(baseURL string, apiKey string, model string) *OpenAIProvider {
+	headers := map[string]string{}
+	if apiKey != "" {
+		headers["Authorization"] = "Bearer " + apiKey
+	}
+
+	return &OpenAIProvider{
+		chatClient: chatClient{
+			client:  &http.Client{},
+			baseURL: baseURL,
+			headers: headers,
+		},
+		model: model,
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return ProviderOpenAI
+}
+
+func (p *OpenAIProvider) prepare(request types.OpenRouterRequest) types.OpenRouterRequest {
+	// Provider routing and usage accounting are OpenRouter extensions
+	request.Provider = nil
+	request.Usage = nil
+	if p.model != "" {
+		request.Model = p.model
+	}
+	return request
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error) {
+	return p.complete(ctx, p.prepare(request))
+}
+
+func (p *OpenAIProvider) Stream(ctx context.Context, request types.OpenRouterRequest, onDelta func(string) error) (*types.OpenRouterResponse, error) {
+	return p.stream(ctx, p.prepare(request), onDelta)
+}
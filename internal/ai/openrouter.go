@@ -0,0 +1,41 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"rd-backend/internal/types"
+)
+
+const openRouterURL = "https://openrouter.ai/api/v1/chat/completions"
+
+// OpenRouterProvider sends requests to openrouter.ai, including its provider routing preferences
+type OpenRouterProvider struct {
+	chatClient
+}
+
+func NewOpenRouterProvider(apiKey string) *OpenRouterProvider {
+	return &OpenRouterProvider{
+		chatClient: chatClient{
+			client:  &http.Client{},
+			baseURL: openRouterURL,
+			headers: map[string]string{
+				"Authorization": "Bearer " + apiKey,
+				"X-Title":       "Riviera Dreams",
+			},
+		},
+	}
+}
+
+func (p *OpenRouterProvider) Name() string {
+	return ProviderOpenRouter
+}
+
+func (p *OpenRouterProvider) Complete(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error) {
+	request.Usage = &types.UsageOptions{Include: true}
+	return p.complete(ctx, request)
+}
+
+func (p *OpenRouterProvider) Stream(ctx context.Context, request types.OpenRouterRequest, onDelta func(string) error) (*types.OpenRouterResponse, error) {
+	request.Usage = &types.UsageOptions{Include: true}
+	return p.stream(ctx, request, onDelta)
+}
@@ -0,0 +1,45 @@
+package ai
+
+import (
+	"fmt"
+	"rd-backend/internal/ai/prompts"
+)
+
+// SetPrompts swaps the system prompt templates, requests already being built keep the old ones
+func (h *AIHandler) SetPrompts(promptSet *prompts.Set) {
+	h.promptSet.Store(promptSet)
+}
+
+func (h *AIHandler) Prompts() *prompts.Set {
+	return h.promptSet.Load()
+}
+
+// PreviewPrompt renders the channel's system prompt for an NPC without calling a model.
+// A non-empty text is used in place of the loaded template, so writers can try changes out.
+// It returns the prompt and its estimated token count.
+func (h *AIHandler) PreviewPrompt(channel string, npcId string, text string, data prompts.Data) (string, int, error) {
+	if npcId != "" {
+		npcPersonality, exists := (*h.npcConfigs)[npcId]
+		if !exists {
+			return "", 0, fmt.Errorf("NPC with ID %s not found", npcId)
+		}
+		data.NPC = npcPersonality
+	}
+
+	var prompt string
+	var err error
+	if text != "" {
+		tmpl, parseErr := prompts.Parse(channel, text)
+		if parseErr != nil {
+			return "", 0, parseErr
+		}
+		prompt, err = prompts.Execute(tmpl, data)
+	} else {
+		prompt, err = h.promptSet.Load().Render(channel, data)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	return prompt, h.contextBuilder.tokenizer.CountTokens(prompt), nil
+}
@@ -0,0 +1,200 @@
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"rd-backend/internal/types"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+// Channels have their own system prompt template
+const (
+	ChannelChat     = "chat"
+	ChannelSMS      = "sms"
+	ChannelNarrator = "narrator"
+)
+
+var Channels = []string{ChannelChat, ChannelSMS, ChannelNarrator}
+
+const DefaultVersion = "v1"
+
+// Data is what templates can use. Not every channel fills in every field: the narrator
+// only gets Details, the event it describes. With gossip on, Knowledge takes the place of Events.
+type Data struct {
+	NPC    types.NPC
+	Events []string
+	// Knowledge is what this NPC knows the player did, newest first
+	Knowledge []Knowledge
+	Summary   string
+	Memory    []string
+	Details   string
+	// Lore is background about the world related to the conversation
+	Lore []string
+	// Relationship is how the NPC feels about the player, nil before they've met
+	Relationship *Relationship
+	// Scene is set when the NPC is in a group conversation
+	Scene *Scene
+	// Now is where the NPC is at the player's game time, nil without a schedule or clock
+	Now *Now
+	// Quests are the ones this NPC gave the player, newest first
+	Quests []Quest
+	// TextReason is why the NPC is texting the player first, empty when replying
+	TextReason string
+	// Guard is set when the player's message tries to make the NPC drop the act
+	Guard bool
+}
+
+// Quest is a quest the NPC gave the player and where it stands
+type Quest struct {
+	Title  string
+	Status string
+}
+
+// Now is the game time and what the NPC's schedule has them doing
+type Now struct {
+	Time     string
+	Location string
+	Activity string
+}
+
+// Scene is a group conversation, Others are the names of the other NPCs in it
+type Scene struct {
+	Others   []string
+	Location string
+}
+
+// Knowledge is one thing the NPC knows, Source is who told them and empty if they saw it
+type Knowledge struct {
+	Content string
+	Source  string
+}
+
+// Relationship is the player's standing with the NPC
+type Relationship struct {
+	Stage    string
+	Affinity int
+	// Tone is how the NPC should act at this stage
+	Tone string
+}
+
+// Funcs are the helpers available in every template
+var Funcs = template.FuncMap{
+	// join .NPC.Traits ", "
+	"join": func(items []string, sep string) string {
+		return strings.Join(items, sep)
+	},
+	// list .NPC.Traits gives "friendly, simple and reliable"
+	"list": func(items []string) string {
+		if len(items) <= 1 {
+			return strings.Join(items, "")
+		}
+		return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+	},
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+}
+
+// Set is one version of the templates for every channel
+type Set struct {
+	version   string
+	source    string
+	templates map[string]*template.Template
+	texts     map[string]string
+}
+
+// Load reads templates/<version>/<channel>.tmpl from dir, or from the templates built
+// into the binary when dir is empty
+func Load(version string, dir string) (*Set, error) {
+	if version == "" {
+		version = DefaultVersion
+	}
+
+	var files fs.FS = embedded
+	source := "embedded"
+	if dir != "" {
+		files = os.DirFS(dir)
+		source = dir
+	}
+
+	set := &Set{
+		version:   version,
+		source:    source,
+		templates: make(map[string]*template.Template),
+		texts:     make(map[string]string),
+	}
+
+	for _, channel := range Channels {
+		data, err := fs.ReadFile(files, path.Join("templates", version, channel+".tmpl"))
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s prompt: %w", channel, err)
+		}
+
+		tmpl, err := Parse(channel, string(data))
+		if err != nil {
+			return nil, err
+		}
+
+		set.templates[channel] = tmpl
+		set.texts[channel] = string(data)
+	}
+
+	return set, nil
+}
+
+// Default is the built-in version of the templates
+func Default() *Set {
+	set, err := Load(DefaultVersion, "")
+	if err != nil {
+		panic("embedded prompt templates are broken: " + err.Error())
+	}
+	return set
+}
+
+// Parse compiles a template with Funcs. Unknown fields are errors, not empty strings.
+func Parse(name string, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(Funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s prompt template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Execute renders tmpl, trimming the whitespace template files tend to end with
+func Execute(tmpl *template.Template, data Data) (string, error) {
+	var prompt bytes.Buffer
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return "", fmt.Errorf("could not render %s prompt: %w", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(prompt.String()), nil
+}
+
+// Render fills in the channel's template
+func (s *Set) Render(channel string, data Data) (string, error) {
+	tmpl, exists := s.templates[channel]
+	if !exists {
+		return "", fmt.Errorf("no prompt template for channel %s", channel)
+	}
+	return Execute(tmpl, data)
+}
+
+func (s *Set) Version() string {
+	return s.version
+}
+
+// Source is where the templates were loaded from, a directory or "embedded"
+func (s *Set) Source() string {
+	return s.source
+}
+
+// Text returns the channel's template source
+func (s *Set) Text(channel string) string {
+	return s.texts[channel]
+}
@@ -0,0 +1,127 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"rd-backend/internal/types"
+	"strconv"
+	"time"
+)
+
+// Provider is an LLM backend that speaks the OpenAI chat completions format
+type Provider interface {
+	// Name identifies the provider in logs
+	Name() string
+
+	// Complete returns the whole completion once it has been generated
+	Complete(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error)
+
+	// Stream calls onDelta for every chunk of text as it arrives. The returned response holds
+	// the accumulated text and is non-nil even when an error is returned, so callers can keep
+	// whatever was generated before the stream was aborted. Returning an error from onDelta
+	// aborts the stream.
+	Stream(ctx context.Context, request types.OpenRouterRequest, onDelta func(string) error) (*types.OpenRouterResponse, error)
+}
+
+// ErrStreamAborted is wrapped by Stream when onDelta returns an error
+var ErrStreamAborted = errors.New("stream aborted")
+
+// APIError is returned by providers when the server answers with a non-200 status
+type APIError struct {
+	StatusCode int
+	// RetryAfter is how long the server asked us to wait, zero if it didn't say
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
+}
+
+// newAPIError reads the body and Retry-After header of a failed response
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(resp.Body)
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Body:       string(body),
+	}
+}
+
+// parseRetryAfter understands both forms of the header: delay in seconds and an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+
+	return 0
+}
+
+const (
+	ProviderOpenRouter = "openrouter"
+	ProviderOpenAI     = "openai"
+	ProviderFake       = "fake"
+
+	defaultLocalURL = "http://localhost:11434/v1/chat/completions"
+)
+
+// NewProviderFromEnv picks the provider named by AI_PROVIDER (openrouter by default)
+//
+//	openrouter: OPENROUTER_API_KEY
+//	openai:     AI_BASE_URL, AI_API_KEY (optional), AI_MODEL (optional, overrides every model name)
+//	fake:       AI_FAKE_SCRIPT (optional, path to a JSON array of replies)
+func NewProviderFromEnv() (Provider, error) {
+	switch name := os.Getenv("AI_PROVIDER"); name {
+	case "", ProviderOpenRouter:
+		apiKey := os.Getenv("OPENROUTER_API_KEY")
+		if apiKey == "" {
+			return nil, fmt.Errorf("OPENROUTER_API_KEY environment variable is not set")
+		}
+		return NewOpenRouterProvider(apiKey), nil
+
+	case ProviderOpenAI:
+		baseURL := os.Getenv("AI_BASE_URL")
+		if baseURL == "" {
+			baseURL = defaultLocalURL
+		}
+		return NewOpenAIProvider(baseURL, os.Getenv("AI_API_KEY"), os.Getenv("AI_MODEL")), nil
+
+	case ProviderFake:
+		path := os.Getenv("AI_FAKE_SCRIPT")
+		if path == "" {
+			return NewFakeProvider(), nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read fake provider script: %w", err)
+		}
+
+		var replies []string
+		if err := json.Unmarshal(data, &replies); err != nil {
+			return nil, fmt.Errorf("fake provider script must be a JSON array of strings: %w", err)
+		}
+		return NewFakeProvider(replies...), nil
+
+	default:
+		return nil, fmt.Errorf("unknown AI_PROVIDER %q", name)
+	}
+}
@@ -0,0 +1,65 @@
+package ai
+
+import (
+	"fmt"
+	"log"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/types"
+)
+
+// recentQuests is how many of the quests an NPC gave the player go in their prompt
+const recentQuests = 3
+
+// QuestStore looks up the quests NPCs gave players
+type QuestStore interface {
+	GetQuests(unityID string, npcID string, states []string, limit int) ([]types.DBQuest, error)
+}
+
+// SetQuestStore adds the quests an NPC gave the player to chat and SMS prompts, so NPCs
+// follow up on them
+func (h *AIHandler) SetQuestStore(store QuestStore) {
+	h.questStore = store
+}
+
+// quests returns where the NPC's latest quests for the player stand, newest first
+func (h *AIHandler) quests(unityID string, npcPersonality types.NPC) []prompts.Quest {
+	if h.questStore == nil || unityID == "" {
+		return nil
+	}
+
+	stored, err := h.questStore.GetQuests(unityID, npcPersonality.ID, nil, recentQuests)
+	if err != nil {
+		log.Printf("Could not get quests of %s from %s: %v", unityID, npcPersonality.ID, err)
+		return nil
+	}
+
+	quests := make([]prompts.Quest, 0, len(stored))
+	for _, quest := range stored {
+		quests = append(quests, prompts.Quest{
+			Title:  quest.Title,
+			Status: questStatus(quest),
+		})
+	}
+	return quests
+}
+
+func questStatus(quest types.DBQuest) string {
+	switch quest.State {
+	case types.QuestOffered:
+		return "you asked, they haven't said yes yet. " + quest.Summary
+	case types.QuestComplete:
+		return "they did it"
+	case types.QuestFailed:
+		return "it fell through"
+	}
+
+	if quest.Step >= len(quest.Steps) {
+		return "they're on it"
+	}
+	step := quest.Steps[quest.Step]
+	status := fmt.Sprintf("they're on it, %d of %d steps done. Next: %s", quest.Step, len(quest.Steps), step.Description)
+	if step.Count > 1 {
+		status += fmt.Sprintf(" (%d/%d)", quest.Progress, step.Count)
+	}
+	return status
+}
@@ -0,0 +1,42 @@
+package ai
+
+import (
+	"log"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/types"
+)
+
+// RelationshipStore looks up how NPCs feel about players
+type RelationshipStore interface {
+	GetRelationship(unityID string, npcID string) (*types.DBRelationship, error)
+}
+
+// SetRelationshipStore adds the player's relationship with the NPC to chat and SMS prompts,
+// so NPCs warm up to players they like and cool down on those they don't
+func (h *AIHandler) SetRelationshipStore(store RelationshipStore) {
+	h.relationships = store
+}
+
+// relationship returns the player's standing with the NPC for the prompt. Players the NPC
+// hasn't got an opinion on yet are strangers.
+func (h *AIHandler) relationship(unityID string, npcPersonality types.NPC) *prompts.Relationship {
+	if h.relationships == nil || unityID == "" {
+		return nil
+	}
+
+	stored, err := h.relationships.GetRelationship(unityID, npcPersonality.ID)
+	if err != nil {
+		log.Printf("Could not get relationship of %s with %s: %v", unityID, npcPersonality.ID, err)
+		return nil
+	}
+
+	relationship := &prompts.Relationship{Stage: npc.StageFor(0)}
+	if stored != nil {
+		relationship.Stage = npc.StageFor(stored.Affinity)
+		relationship.Affinity = stored.Affinity
+	}
+	relationship.Tone = npc.Tone(npcPersonality, relationship.Stage)
+
+	return relationship
+}
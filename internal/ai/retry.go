@@ -0,0 +1,172 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"rd-backend/internal/types"
+	"time"
+)
+
+// RetryPolicy controls deadlines and retries for every model in a fallback chain
+type RetryPolicy struct {
+	// MaxAttempts per model, including the first try
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// MaxRetryAfter is the longest Retry-After we'll sit through before moving to the next model
+	MaxRetryAfter time.Duration
+	// CallTimeout bounds a single blocking request, StreamTimeout a single streamed one
+	CallTimeout   time.Duration
+	StreamTimeout time.Duration
+	// BreakerThreshold consecutive failures open a model's breaker for BreakerCooldown
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:      3,
+	BaseDelay:        500 * time.Millisecond,
+	MaxDelay:         8 * time.Second,
+	MaxRetryAfter:    10 * time.Second,
+	CallTimeout:      30 * time.Second,
+	StreamTimeout:    90 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+// backoff returns how long to wait before the given retry (1 for the first retry),
+// exponential with equal jitter, never shorter than what the server asked for
+func (p RetryPolicy) backoff(retry int, retryAfter time.Duration) time.Duration {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	delay = delay/2 + rand.N(delay/2+1)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	return delay
+}
+
+// isRetryable reports whether err is a transient failure worth trying again
+func isRetryable(err error) bool {
+	// The player went away, the model did nothing wrong
+	if errors.Is(err, ErrStreamAborted) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode == http.StatusRequestTimeout ||
+			apiErr.StatusCode >= 500
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// Connection refused, reset, DNS failures...
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// modelChain returns the model followed by its fallbacks, in the order they should be tried
+func modelChain(modelConfig ModelConfig) []ModelConfig {
+	chain := make([]ModelConfig, 0, len(modelConfig.Fallbacks)+1)
+	chain = append(chain, modelConfig)
+	return append(chain, modelConfig.Fallbacks...)
+}
+
+// callWithFallbacks sends messages to each model of the chain in turn until one succeeds.
+// Transient failures are retried with backoff, and models whose breaker is open are skipped.
+// canRetry is checked before every retry or fallback: a stream can't start over once text
+// has already reached the player. The last response is returned alongside any error.
+// The usage of every attempt is recorded under key.
+func (h *AIHandler) callWithFallbacks(
+	key UsageKey,
+	messages []types.OpenRouterMessage,
+	modelConfig ModelConfig,
+	timeout time.Duration,
+	canRetry func() bool,
+	call func(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error),
+) (*types.OpenRouterResponse, error) {
+	policy := h.retryPolicy
+
+	var response *types.OpenRouterResponse
+	var lastErr error
+
+	for _, config := range modelChain(modelConfig) {
+		request, err := newRequest(messages, config)
+		if err != nil {
+			return nil, err
+		}
+
+		breaker := h.breakers.get(config.ModelName)
+
+		for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+			if !breaker.allow() {
+				log.Printf("AI %s %s: circuit open, skipping", h.provider.Name(), config.ModelName)
+				lastErr = fmt.Errorf("circuit open for %s", config.ModelName)
+				break
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			start := time.Now()
+			response, err = call(ctx, *request)
+			cancel()
+			h.recordUsage(key, config.ModelName, *request, response, err)
+
+			if err == nil {
+				breaker.success()
+				log.Printf("AI %s %s: attempt %d/%d succeeded in %s", h.provider.Name(), config.ModelName, attempt, policy.MaxAttempts, time.Since(start).Round(time.Millisecond))
+				return response, nil
+			}
+
+			lastErr = fmt.Errorf("%s %s: %w", h.provider.Name(), config.ModelName, err)
+			log.Printf("AI %s %s: attempt %d/%d failed after %s: %v", h.provider.Name(), config.ModelName, attempt, policy.MaxAttempts, time.Since(start).Round(time.Millisecond), err)
+
+			if !isRetryable(err) {
+				// The model answered, so it isn't down, but retrying the same request won't help
+				breaker.success()
+				break
+			}
+
+			if breaker.failure() {
+				log.Printf("AI %s %s: circuit opened for %s", h.provider.Name(), config.ModelName, policy.BreakerCooldown)
+			}
+
+			if !canRetry() {
+				return response, lastErr
+			}
+
+			if attempt == policy.MaxAttempts {
+				break
+			}
+
+			var retryAfter time.Duration
+			var apiErr *APIError
+			if errors.As(err, &apiErr) {
+				retryAfter = apiErr.RetryAfter
+			}
+			if retryAfter > policy.MaxRetryAfter {
+				log.Printf("AI %s %s: Retry-After %s is too long, moving on", h.provider.Name(), config.ModelName, retryAfter)
+				break
+			}
+
+			time.Sleep(policy.backoff(attempt, retryAfter))
+		}
+
+		if !canRetry() {
+			return response, lastErr
+		}
+	}
+
+	return response, fmt.Errorf("all models failed, last error: %w", lastErr)
+}
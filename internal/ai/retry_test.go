@@ -0,0 +1,226 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/types"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	tests := []struct {
+		name       string
+		retry      int
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{"first retry", 1, 0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{"doubles", 3, 0, 200 * time.Millisecond, 400 * time.Millisecond},
+		{"capped at max delay", 10, 0, 500 * time.Millisecond, time.Second},
+		{"shift overflow is capped", 80, 0, 500 * time.Millisecond, time.Second},
+		{"retry-after wins when longer", 1, 3 * time.Second, 3 * time.Second, 3 * time.Second},
+		{"retry-after ignored when shorter", 3, time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for range 50 {
+				delay := policy.backoff(test.retry, test.retryAfter)
+				if delay < test.min || delay > test.max {
+					t.Fatalf("backoff(%d, %s) = %s, want between %s and %s", test.retry, test.retryAfter, delay, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"request timeout", &APIError{StatusCode: http.StatusRequestTimeout}, true},
+		{"server error", &APIError{StatusCode: http.StatusBadGateway}, true},
+		{"bad request", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"unauthorized", &APIError{StatusCode: http.StatusUnauthorized}, false},
+		{"wrapped api error", fmt.Errorf("call: %w", &APIError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"deadline", context.DeadlineExceeded, true},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"stream aborted", fmt.Errorf("%w: player left", ErrStreamAborted), false},
+		{"anything else", errors.New("no choices in response"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isRetryable(test.err); got != test.want {
+				t.Errorf("isRetryable(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
+
+// scriptedProvider answers every Complete with the next error of its script, or a reply when
+// it's nil, and remembers which model each request was for
+type scriptedProvider struct {
+	errs   []error
+	models []string
+}
+
+func (p *scriptedProvider) Name() string {
+	return "scripted"
+}
+
+func (p *scriptedProvider) Complete(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error) {
+	p.models = append(p.models, request.Model)
+
+	var err error
+	if len(p.errs) > 0 {
+		err, p.errs = p.errs[0], p.errs[1:]
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &types.OpenRouterResponse{
+		Choices: []types.OpenRouterChoice{{Message: types.OpenRouterMessage{Content: "reply from " + request.Model}}},
+	}, nil
+}
+
+func (p *scriptedProvider) Stream(ctx context.Context, request types.OpenRouterRequest, onDelta func(string) error) (*types.OpenRouterResponse, error) {
+	return p.Complete(ctx, request)
+}
+
+func newTestHandler(provider Provider, policy RetryPolicy) *AIHandler {
+	h := NewAIHandler(provider, &npc.NPCs{}, &npc.NPCNumbers{})
+	h.retryPolicy = policy
+	h.breakers = newBreakerSet(policy.BreakerThreshold, policy.BreakerCooldown)
+	return h
+}
+
+var testPolicy = RetryPolicy{
+	MaxAttempts:      3,
+	BaseDelay:        time.Millisecond,
+	MaxDelay:         time.Millisecond,
+	MaxRetryAfter:    10 * time.Millisecond,
+	CallTimeout:      time.Second,
+	BreakerThreshold: 2,
+	BreakerCooldown:  time.Minute,
+}
+
+var testChain = ModelConfig{
+	ModelName:     "primary",
+	ProviderOrder: []string{"test"},
+	Fallbacks: []ModelConfig{
+		{ModelName: "fallback", ProviderOrder: []string{"test"}},
+	},
+}
+
+func TestCallWithFallbacks(t *testing.T) {
+	unavailable := &APIError{StatusCode: http.StatusServiceUnavailable}
+
+	tests := []struct {
+		name       string
+		errs       []error
+		wantModels []string
+		wantReply  string
+		wantErr    bool
+	}{
+		{
+			name:       "first try",
+			wantModels: []string{"primary"},
+			wantReply:  "reply from primary",
+		},
+		{
+			name:       "retries transient failures",
+			errs:       []error{unavailable, unavailable},
+			wantModels: []string{"primary", "primary", "primary"},
+			wantReply:  "reply from primary",
+		},
+		{
+			name:       "falls back without retrying a bad request",
+			errs:       []error{&APIError{StatusCode: http.StatusBadRequest}},
+			wantModels: []string{"primary", "fallback"},
+			wantReply:  "reply from fallback",
+		},
+		{
+			name:       "moves on when retry-after is too long",
+			errs:       []error{&APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute}},
+			wantModels: []string{"primary", "fallback"},
+			wantReply:  "reply from fallback",
+		},
+		{
+			name:       "fails when every model fails",
+			errs:       []error{errors.New("no"), errors.New("no")},
+			wantModels: []string{"primary", "fallback"},
+			wantErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &scriptedProvider{errs: test.errs}
+			policy := testPolicy
+			policy.BreakerThreshold = 10
+			h := newTestHandler(provider, policy)
+
+			reply, err := h.makeRequest(UsageKey{}, []types.OpenRouterMessage{{Role: "user", Content: "hi"}}, testChain)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("err = %v, want error %v", err, test.wantErr)
+			}
+			if err == nil && *reply != test.wantReply {
+				t.Errorf("reply = %q, want %q", *reply, test.wantReply)
+			}
+			if fmt.Sprint(provider.models) != fmt.Sprint(test.wantModels) {
+				t.Errorf("models tried = %v, want %v", provider.models, test.wantModels)
+			}
+		})
+	}
+}
+
+func TestCallWithFallbacksSkipsOpenBreaker(t *testing.T) {
+	unavailable := &APIError{StatusCode: http.StatusServiceUnavailable}
+	provider := &scriptedProvider{errs: []error{unavailable, unavailable}}
+	h := newTestHandler(provider, testPolicy)
+	messages := []types.OpenRouterMessage{{Role: "user", Content: "hi"}}
+
+	// Two failures open the primary's breaker, the fallback answers
+	reply, err := h.makeRequest(UsageKey{}, messages, testChain)
+	if err != nil || *reply != "reply from fallback" {
+		t.Fatalf("reply = %v, err = %v, want the fallback's reply", reply, err)
+	}
+
+	// While it's open the primary isn't even tried
+	provider.models = nil
+	if _, err := h.makeRequest(UsageKey{}, messages, testChain); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(provider.models) != "[fallback]" {
+		t.Errorf("models tried = %v, want only the fallback", provider.models)
+	}
+}
+
+func TestCallWithFallbacksStopsWhenRetryIsImpossible(t *testing.T) {
+	provider := &scriptedProvider{errs: []error{&APIError{StatusCode: http.StatusBadGateway}}}
+	h := newTestHandler(provider, testPolicy)
+
+	_, err := h.callWithFallbacks(UsageKey{}, []types.OpenRouterMessage{{Role: "user", Content: "hi"}}, testChain, time.Second,
+		func() bool { return false },
+		func(ctx context.Context, request types.OpenRouterRequest) (*types.OpenRouterResponse, error) {
+			return provider.Complete(ctx, request)
+		},
+	)
+	if err == nil {
+		t.Fatal("expected the first failure to be returned")
+	}
+	if len(provider.models) != 1 {
+		t.Errorf("models tried = %v, want a single attempt", provider.models)
+	}
+}
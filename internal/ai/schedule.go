@@ -0,0 +1,40 @@
+package ai
+
+import (
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/types"
+)
+
+// GameClock is the player's game time in minutes since midnight, false when it isn't known
+type GameClock interface {
+	Now(unityID string) (int, bool)
+}
+
+// SetClock tells NPCs with a schedule where they are and what they're doing in prompts
+func (h *AIHandler) SetClock(clock GameClock) {
+	h.clock = clock
+}
+
+// now returns the NPC's scheduled whereabouts at the player's game time
+func (h *AIHandler) now(unityID string, npcPersonality types.NPC) *prompts.Now {
+	if h.clock == nil || len(npcPersonality.Schedule) == 0 {
+		return nil
+	}
+
+	minute, known := h.clock.Now(unityID)
+	if !known {
+		return nil
+	}
+
+	entry, scheduled := npc.At(npcPersonality, minute)
+	if !scheduled {
+		return nil
+	}
+
+	return &prompts.Now{
+		Time:     npc.FormatClock(minute),
+		Location: entry.Location,
+		Activity: entry.Activity,
+	}
+}
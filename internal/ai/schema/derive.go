@@ -0,0 +1,170 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// For derives a schema from the Go type of v, following encoding/json's field names.
+// Fields are required unless they are pointers or tagged omitempty, and structs don't allow
+// properties they don't declare. A jsonschema tag adds constraints, e.g.
+//
+//	Mood string `json:"mood" jsonschema:"description=How the NPC feels,enum=happy|sad"`
+//
+// Supported keys are description, enum, minimum, maximum, minLength, maxLength, minItems and maxItems.
+func For(v any) (*Schema, error) {
+	return forType(reflect.TypeOf(v))
+}
+
+func forType(t reflect.Type) (*Schema, error) {
+	if t == nil {
+		return nil, fmt.Errorf("cannot derive a schema from nil")
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}, nil
+
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+
+	case reflect.Slice, reflect.Array:
+		items, err := forType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map keys must be strings, got %s", t.Key())
+		}
+		return &Schema{Type: "object"}, nil
+
+	case reflect.Interface:
+		return &Schema{}, nil
+
+	case reflect.Struct:
+		return forStruct(t)
+
+	default:
+		return nil, fmt.Errorf("cannot derive a schema for %s", t)
+	}
+}
+
+func forStruct(t reflect.Type) (*Schema, error) {
+	closed := false
+	s := &Schema{
+		Type:                 "object",
+		Properties:           make(map[string]*Schema),
+		AdditionalProperties: &closed,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property, err := forType(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if err := applyTag(property, field.Tag.Get("jsonschema")); err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+
+		s.Properties[name] = property
+		if field.Type.Kind() != reflect.Pointer && !strings.Contains(options, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+
+	return s, nil
+}
+
+func applyTag(s *Schema, tag string) error {
+	if tag == "" {
+		return nil
+	}
+
+	lastKey := ""
+	for _, part := range strings.Split(tag, ",") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			// Descriptions may have commas in them
+			if lastKey == "description" {
+				s.Description += "," + part
+				continue
+			}
+			return fmt.Errorf("invalid jsonschema tag %q", part)
+		}
+		lastKey = key
+
+		var err error
+		switch key {
+		case "description":
+			s.Description = value
+		case "enum":
+			for _, option := range strings.Split(value, "|") {
+				s.Enum = append(s.Enum, option)
+			}
+		case "minimum":
+			s.Minimum, err = parseFloat(value)
+		case "maximum":
+			s.Maximum, err = parseFloat(value)
+		case "minLength":
+			s.MinLength, err = parseInt(value)
+		case "maxLength":
+			s.MaxLength, err = parseInt(value)
+		case "minItems":
+			s.MinItems, err = parseInt(value)
+		case "maxItems":
+			s.MaxItems, err = parseInt(value)
+		default:
+			return fmt.Errorf("unknown jsonschema key %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func parseFloat(value string) (*float64, error) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &number, nil
+}
+
+func parseInt(value string) (*int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+	return &number, nil
+}
@@ -0,0 +1,115 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type derived struct {
+	Mood    string   `json:"mood" jsonschema:"description=How they feel, in a word or two,enum=happy|sad"`
+	Trust   int      `json:"trust" jsonschema:"minimum=-10,maximum=10"`
+	Summary string   `json:"summary,omitempty" jsonschema:"minLength=1,maxLength=200"`
+	Topics  []string `json:"topics" jsonschema:"minItems=1,maxItems=3"`
+	Note    *string  `json:"note"`
+	Weight  float64
+	Ignored string `json:"-"`
+	hidden  string
+}
+
+func TestFor(t *testing.T) {
+	s, err := For(derived{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Type != "object" || s.AdditionalProperties == nil || *s.AdditionalProperties {
+		t.Errorf("structs should be closed objects, got type %q additionalProperties %v", s.Type, s.AdditionalProperties)
+	}
+
+	wantRequired := []string{"mood", "trust", "topics", "Weight"}
+	if !reflect.DeepEqual(s.Required, wantRequired) {
+		t.Errorf("required = %q, want %q", s.Required, wantRequired)
+	}
+
+	var names []string
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	if len(names) != 6 {
+		t.Errorf("properties = %q, want the 6 exported, untagged-out fields", names)
+	}
+
+	tests := []struct {
+		property string
+		want     string
+	}{
+		{"mood", `{"type":"string","description":"How they feel, in a word or two","enum":["happy","sad"]}`},
+		{"trust", `{"type":"integer","minimum":-10,"maximum":10}`},
+		{"summary", `{"type":"string","minLength":1,"maxLength":200}`},
+		{"topics", `{"type":"array","items":{"type":"string"},"minItems":1,"maxItems":3}`},
+		{"note", `{"type":"string"}`},
+		{"Weight", `{"type":"number"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.property, func(t *testing.T) {
+			property, ok := s.Properties[test.property]
+			if !ok {
+				t.Fatalf("no %s property", test.property)
+			}
+			got, _ := json.Marshal(property)
+			if string(got) != test.want {
+				t.Errorf("%s = %s, want %s", test.property, got, test.want)
+			}
+		})
+	}
+}
+
+func TestForErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"nil", nil, "nil"},
+		{"unknown key", struct {
+			A string `jsonschema:"pattern=x"`
+		}{}, `unknown jsonschema key "pattern"`},
+		{"part without a value", struct {
+			A string `jsonschema:"minLength=1,required"`
+		}{}, `invalid jsonschema tag "required"`},
+		{"bad number", struct {
+			A int `jsonschema:"minimum=low"`
+		}{}, "invalid minimum"},
+		{"non-string map keys", map[int]string{}, "map keys must be strings"},
+		{"unsupported kind", struct{ C chan int }{}, "field C"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := For(test.value)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("err = %v, want it to mention %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestForValidatesItsOwnType(t *testing.T) {
+	s, err := For(derived{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	note := "met at the docks"
+	document, _ := json.Marshal(derived{Mood: "happy", Trust: 3, Topics: []string{"fishing"}, Note: &note, Weight: 1})
+	problems, err := s.Validate(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("problems = %q, want none", problems)
+	}
+}
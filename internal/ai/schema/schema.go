@@ -0,0 +1,181 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema we use to describe tool arguments and structured
+// completions: type, properties, required, additionalProperties (as a bool), enum, items
+// and the min/max keywords for numbers, strings and arrays
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// Parse reads a schema from its JSON form
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &s, nil
+}
+
+// Validate checks a JSON document against the schema. It returns one message per problem,
+// or an error if the document isn't JSON at all.
+func (s *Schema) Validate(data []byte) ([]string, error) {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	var problems []string
+	s.validate("$", value, &problems)
+	return problems, nil
+}
+
+func (s *Schema) validate(path string, value any, problems *[]string) {
+	report := func(format string, args ...any) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		report("must be one of %s", formatEnum(s.Enum))
+		return
+	}
+
+	switch s.Type {
+	case "":
+		// Any type is fine
+
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			report("must be an object")
+			return
+		}
+
+		for _, name := range s.Required {
+			if _, exists := object[name]; !exists {
+				report("missing required property %q", name)
+			}
+		}
+
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			property, known := s.Properties[name]
+			if !known {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					report("unexpected property %q", name)
+				}
+				continue
+			}
+			property.validate(path+"."+name, object[name], problems)
+		}
+
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			report("must be an array")
+			return
+		}
+
+		if s.MinItems != nil && len(array) < *s.MinItems {
+			report("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(array) > *s.MaxItems {
+			report("must have at most %d items", *s.MaxItems)
+		}
+
+		if s.Items != nil {
+			for i, item := range array {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			report("must be a string")
+			return
+		}
+
+		length := utf8.RuneCountInString(str)
+		if s.MinLength != nil && length < *s.MinLength {
+			report("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			report("must be at most %d characters", *s.MaxLength)
+		}
+
+	case "number", "integer":
+		number, ok := value.(float64)
+		if !ok {
+			report("must be a %s", s.Type)
+			return
+		}
+
+		if s.Type == "integer" && number != math.Trunc(number) {
+			report("must be an integer")
+		}
+		if s.Minimum != nil && number < *s.Minimum {
+			report("must be at least %g", *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			report("must be at most %g", *s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			report("must be a boolean")
+		}
+
+	case "null":
+		if value != nil {
+			report("must be null")
+		}
+
+	default:
+		report("schema has unsupported type %q", s.Type)
+	}
+}
+
+func inEnum(value any, enum []any) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []any) string {
+	parts := make([]string, len(enum))
+	for i, allowed := range enum {
+		encoded, _ := json.Marshal(allowed)
+		parts[i] = string(encoded)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,147 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 5},
+		"mood": {"type": "string", "enum": ["happy", "sad"]},
+		"age": {"type": "integer", "minimum": 0, "maximum": 120},
+		"score": {"type": "number"},
+		"friendly": {"type": "boolean"},
+		"tags": {"type": "array", "items": {"type": "string"}, "minItems": 1, "maxItems": 2},
+		"home": {
+			"type": "object",
+			"properties": {"town": {"type": "string"}},
+			"required": ["town"],
+			"additionalProperties": false
+		},
+		"extra": {}
+	},
+	"required": ["name", "mood"],
+	"additionalProperties": false
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		document string
+		want     []string
+	}{
+		{
+			name:     "valid",
+			document: `{"name": "Ada", "mood": "happy", "age": 30, "score": 1.5, "friendly": true, "tags": ["a"], "home": {"town": "Oak"}, "extra": [1]}`,
+		},
+		{
+			name:     "missing required",
+			document: `{"mood": "sad"}`,
+			want:     []string{`$: missing required property "name"`},
+		},
+		{
+			name:     "unexpected property",
+			document: `{"name": "Ada", "mood": "sad", "zzz": 1}`,
+			want:     []string{`$: unexpected property "zzz"`},
+		},
+		{
+			name:     "not in enum",
+			document: `{"name": "Ada", "mood": "angry"}`,
+			want:     []string{`$.mood: must be one of "happy", "sad"`},
+		},
+		{
+			name:     "string length",
+			document: `{"name": "", "mood": "sad", "home": {"town": "Oak"}}`,
+			want:     []string{`$.name: must be at least 1 characters`},
+		},
+		{
+			name:     "length counts characters not bytes",
+			document: `{"name": "Zoë", "mood": "sad"}`,
+		},
+		{
+			name:     "string too long",
+			document: `{"name": "Adelaide", "mood": "sad"}`,
+			want:     []string{`$.name: must be at most 5 characters`},
+		},
+		{
+			name:     "integer bounds",
+			document: `{"name": "Ada", "mood": "sad", "age": 121}`,
+			want:     []string{`$.age: must be at most 120`},
+		},
+		{
+			name:     "integer with a fraction",
+			document: `{"name": "Ada", "mood": "sad", "age": 1.5}`,
+			want:     []string{`$.age: must be an integer`},
+		},
+		{
+			name:     "wrong types",
+			document: `{"name": 1, "mood": "sad", "score": "high", "friendly": "yes"}`,
+			want:     []string{`$.friendly: must be a boolean`, `$.name: must be a string`, `$.score: must be a number`},
+		},
+		{
+			name:     "array bounds and items",
+			document: `{"name": "Ada", "mood": "sad", "tags": ["a", 2, "c"]}`,
+			want:     []string{`$.tags: must have at most 2 items`, `$.tags[1]: must be a string`},
+		},
+		{
+			name:     "empty array",
+			document: `{"name": "Ada", "mood": "sad", "tags": []}`,
+			want:     []string{`$.tags: must have at least 1 items`},
+		},
+		{
+			name:     "nested object",
+			document: `{"name": "Ada", "mood": "sad", "home": {"street": "Elm"}}`,
+			want:     []string{`$.home: missing required property "town"`, `$.home: unexpected property "street"`},
+		},
+		{
+			name:     "not an object",
+			document: `["Ada"]`,
+			want:     []string{`$: must be an object`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems, err := s.Validate([]byte(test.document))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(problems, test.want) {
+				t.Errorf("problems = %q, want %q", problems, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidJSON(t *testing.T) {
+	s, err := Parse([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Validate([]byte(`{"name": "Ada",`)); err == nil {
+		t.Error("expected an error for a truncated document")
+	}
+}
+
+func TestValidateAllowsAdditionalPropertiesByDefault(t *testing.T) {
+	s, err := Parse([]byte(`{"type": "object", "properties": {"a": {"type": "string"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := s.Validate([]byte(`{"a": "x", "b": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("problems = %q, want none", problems)
+	}
+}
@@ -0,0 +1,206 @@
+package ai
+
+import (
+	"fmt"
+	"log"
+	"rd-backend/internal/types"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SuggestionTones are the tone labels the dialogue wheel has icons for
+var SuggestionTones = []string{"friendly", "curious", "playful", "flirty", "serious", "annoyed"}
+
+// Suggestion counts, requests outside the range are clamped to it
+const (
+	MinSuggestions     = 2
+	MaxSuggestions     = 4
+	DefaultSuggestions = 3
+)
+
+// suggestionContext is how many earlier lines with the NPC the suggestions are based on
+const suggestionContext = 6
+
+// replySuggestions is what suggestReplies asks the model for, the tone enum is filled in
+// from SuggestionTones
+type replySuggestions struct {
+	Suggestions []replySuggestion `json:"suggestions"`
+}
+
+type replySuggestion struct {
+	Text string `json:"text" jsonschema:"minLength=1,maxLength=80"`
+	Tone string `json:"tone"`
+}
+
+// SuggestReplies writes what the player could say to the NPC next, from their last lines
+// together. history is newest first, the way the database returns it.
+func (h *AIHandler) SuggestReplies(unityID string, npcId string, history []types.DBChatMessage, count int) ([]types.Suggestion, error) {
+	npcPersonality, exists := (*h.npcConfigs)[npcId]
+	if !exists {
+		return nil, fmt.Errorf("NPC with ID %s not found", npcId)
+	}
+
+	return h.suggestReplies(unityID, npcPersonality, transcript(npcPersonality, history, suggestionContext), count)
+}
+
+// transcript is up to limit of the player's lines with the NPC from history, oldest first
+func transcript(npcPersonality types.NPC, history []types.DBChatMessage, limit int) []string {
+	var lines []string
+	for _, msg := range history {
+		if len(lines) == limit {
+			break
+		}
+
+		switch {
+		case msg.Sender == npcPersonality.ID:
+			lines = append(lines, npcPersonality.Name+": "+msg.MessageText)
+		case msg.Sender == "player" && msg.SentTo == npcPersonality.ID:
+			lines = append(lines, "Player: "+msg.MessageText)
+		}
+	}
+
+	slices.Reverse(lines)
+	return lines
+}
+
+// suggestReplies asks for count reply options with different tones. transcript is the
+// conversation so far, oldest first, and may be empty when the player hasn't said anything yet.
+func (h *AIHandler) suggestReplies(unityID string, npcPersonality types.NPC, transcript []string, count int) ([]types.Suggestion, error) {
+	count = min(max(count, MinSuggestions), MaxSuggestions)
+
+	input := strings.Join(transcript, "\n")
+	if input == "" {
+		input = fmt.Sprintf("The player is walking up to %s and hasn't said anything yet.", npcPersonality.Name)
+	}
+
+	s, err := schemaFor[replySuggestions]()
+	if err != nil {
+		return nil, err
+	}
+	list := s.Properties["suggestions"]
+	list.MinItems, list.MaxItems = &count, &count
+	for _, tone := range SuggestionTones {
+		list.Items.Properties["tone"].Enum = append(list.Items.Properties["tone"].Enum, tone)
+	}
+
+	result, err := CompleteJSONAs[replySuggestions](h, UsageKey{UnityID: unityID, NpcID: npcPersonality.ID, CallType: CallSuggestions}, JSONRequest{
+		Name: "reply_suggestions",
+		Instructions: fmt.Sprintf(
+			"You write the player's lines for a dialogue wheel in a life-sim game. The player is talking to %s, the %s. "+
+				"Give %d things the player could say next, each with a different tone. Keep them short, natural "+
+				"and in the first person, and make them lead the conversation somewhere different.",
+			npcPersonality.Name, npcPersonality.Occupation, count,
+		),
+		Input:  input,
+		Schema: s,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]types.Suggestion, 0, len(result.Suggestions))
+	for _, suggestion := range result.Suggestions {
+		// The model wrote these, not the player, so they're checked like replies and dropped
+		// without a flag against the player
+		text, ok := h.filterSuggestion(unityID, npcPersonality.ID, suggestion.Text)
+		if !ok {
+			continue
+		}
+		suggestions = append(suggestions, types.Suggestion{
+			Text: text,
+			Tone: suggestion.Tone,
+		})
+	}
+	return suggestions, nil
+}
+
+// filterSuggestion runs a line suggested to the player for npcID through the output checks,
+// reporting false when it's blocked
+func (h *AIHandler) filterSuggestion(unityID string, npcID string, text string) (string, bool) {
+	if h.moderator == nil {
+		return text, true
+	}
+
+	decision, err := h.moderator.Moderate(unityID, npcID, StageOutput, text)
+	if err != nil {
+		log.Printf("Moderation failed on a suggestion: %v", err)
+		return text, true
+	}
+
+	switch decision.Action {
+	case ModerationBlock:
+		return "", false
+	case ModerationRewrite:
+		return decision.Text, true
+	}
+	return text, true
+}
+
+// pendingSuggestions are suggestions being written from reply in the background
+type pendingSuggestions struct {
+	reply       string
+	done        chan struct{}
+	suggestions []types.Suggestion
+	err         error
+}
+
+// startSuggestions starts writing count suggestions as soon as there is a reply, so the call
+// overlaps the checks on the reply instead of waiting for them. It returns nil when there is
+// nothing to suggest for.
+func (h *AIHandler) startSuggestions(unityID string, npcPersonality types.NPC, message string, history []types.DBChatMessage, result *ChatResult, count int) *pendingSuggestions {
+	if count <= 0 || result == nil || strings.TrimSpace(result.Completion) == "" {
+		return nil
+	}
+
+	pending := &pendingSuggestions{
+		reply: result.Completion,
+		done:  make(chan struct{}),
+	}
+	go func() {
+		defer close(pending.done)
+		pending.suggestions, pending.err = h.suggestReplies(unityID, npcPersonality, suggestionLines(npcPersonality, history, message, pending.reply), count)
+	}()
+	return pending
+}
+
+// suggestionLines is the transcript suggestions are written from, ending with the exchange
+func suggestionLines(npcPersonality types.NPC, history []types.DBChatMessage, message string, reply string) []string {
+	return append(transcript(npcPersonality, history, suggestionContext-2), "Player: "+message, npcPersonality.Name+": "+reply)
+}
+
+// finishReply tags the reply's expression and, when suggestions is above 0, writes the
+// player's next lines. Both only need the reply, so they run side by side. Suggestions
+// started earlier with startSuggestions are used when the reply is still the one they were
+// written for; otherwise, or without them, the suggestion call adds to the reply's latency.
+func (h *AIHandler) finishReply(unityID string, npcPersonality types.NPC, message string, history []types.DBChatMessage, result *ChatResult, suggestions int, pending *pendingSuggestions) {
+	if suggestions <= 0 || result == nil || strings.TrimSpace(result.Completion) == "" {
+		h.tagExpression(unityID, npcPersonality, message, result)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h.tagExpression(unityID, npcPersonality, message, result)
+	}()
+
+	var suggested []types.Suggestion
+	var err error
+	if pending != nil {
+		<-pending.done
+	}
+	if pending != nil && pending.reply == result.Completion {
+		suggested, err = pending.suggestions, pending.err
+	} else {
+		// The checks replaced the reply, the suggestions have to follow what the NPC actually says
+		suggested, err = h.suggestReplies(unityID, npcPersonality, suggestionLines(npcPersonality, history, message, result.Completion), suggestions)
+	}
+	if err != nil {
+		log.Printf("Could not suggest replies to %s: %v", npcPersonality.ID, err)
+	}
+	result.Suggestions = suggested
+
+	wg.Wait()
+}
@@ -0,0 +1,40 @@
+package ai
+
+import (
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/types"
+	"testing"
+)
+
+func TestFinishReplyUsesStartedSuggestions(t *testing.T) {
+	bea := types.NPC{ID: "bea", Name: "Bea"}
+	suggested := `{"suggestions": [{"text": "Tell me more", "tone": "curious"}, {"text": "Sounds fun", "tone": "friendly"}]}`
+
+	tests := []struct {
+		name    string
+		checked string
+		calls   int
+	}{
+		{"reply unchanged", "Fresh bread today.", 1},
+		{"reply replaced by the checks", "Hmm, let's talk about something else.", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := NewFakeProvider(suggested)
+			h := NewAIHandler(provider, &npc.NPCs{"bea": bea}, &npc.NPCNumbers{})
+
+			result := &ChatResult{Completion: "Fresh bread today."}
+			pending := h.startSuggestions("player", bea, "Hi", nil, result, 2)
+			result.Completion = test.checked
+			h.finishReply("player", bea, "Hi", nil, result, 2, pending)
+
+			if len(result.Suggestions) != 2 {
+				t.Errorf("got %d suggestions, want 2", len(result.Suggestions))
+			}
+			if calls := len(provider.Requests()); calls != test.calls {
+				t.Errorf("model calls = %d, want %d", calls, test.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package ai
+
+import (
+	"fmt"
+	"rd-backend/internal/types"
+	"strings"
+)
+
+// SummarizeConversation folds messages into previousSummary, so a long relationship can be
+// summarized a batch at a time instead of re-reading the whole transcript.
+// messages must be oldest first.
+func (h *AIHandler) SummarizeConversation(unityID string, previousSummary string, messages []types.DBChatMessage, npcId string) (*string, error) {
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("messages cannot be empty")
+	}
+
+	npcPersonality, exists := (*h.npcConfigs)[npcId]
+	if !exists {
+		return nil, fmt.Errorf("NPC with ID %s not found", npcId)
+	}
+
+	var transcript strings.Builder
+	for _, msg := range messages {
+		speaker := npcPersonality.Name
+		if msg.Sender == "player" {
+			speaker = "Player"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", speaker, msg.MessageText)
+	}
+
+	if previousSummary == "" {
+		previousSummary = "(nothing yet, this is their first conversation)"
+	}
+
+	prompt := fmt.Sprintf(
+		"You keep %s's memory of their relationship with the player. "+
+			"Here is what %s remembers so far:\n%s\n\n"+
+			"Here is what was said since:\n%s\n"+
+			"Rewrite the memory so it also covers the new conversation. Keep facts the player shared "+
+			"(names, plans, likes, promises), how the relationship feels, and anything left unresolved. "+
+			"Drop small talk. Write it from %s's point of view in at most 150 words, with no additional text.",
+		npcPersonality.Name,
+		npcPersonality.Name,
+		previousSummary,
+		transcript.String(),
+		npcPersonality.Name,
+	)
+
+	messagesToSend := []types.OpenRouterMessage{
+		{
+			Role:    "system",
+			Content: prompt,
+		},
+	}
+
+	return h.makeRequest(UsageKey{UnityID: unityID, NpcID: npcId, CallType: CallSummary}, messagesToSend, GPTConfig)
+}
@@ -0,0 +1,43 @@
+package ai
+
+import (
+	"fmt"
+	"rd-backend/internal/types"
+	"strings"
+)
+
+// ComposeText writes a text the NPC sends the player unprompted, reason being what it's about.
+// history is the texts so far, oldest first. It returns false when the text failed moderation or
+// couldn't be kept in character, the NPC then shouldn't send anything rather than a deflection
+// out of nowhere.
+func (h *AIHandler) ComposeText(unityID string, npcId string, reason string, history []types.DBTextMessage, playerNumber string) (string, bool, error) {
+	npcPersonality, exists := (*h.npcConfigs)[npcId]
+	if !exists {
+		return "", false, fmt.Errorf("NPC with ID %s not found", npcId)
+	}
+
+	messages, err := h.buildTextMessages(unityID, npcPersonality, history, playerNumber, reason, false)
+	if err != nil {
+		return "", false, err
+	}
+
+	key := UsageKey{UnityID: unityID, NpcID: npcId, CallType: CallTextTrigger}
+	modelConfig := modelConfigForNPC(RoleplayConfig, npcPersonality)
+	completion, err := h.makeRequest(key, messages, modelConfig)
+	if err != nil {
+		return "", false, err
+	}
+
+	text := strings.TrimSpace(*completion)
+	if text == "" {
+		return "", false, fmt.Errorf("empty text from %s", npcId)
+	}
+
+	text, inCharacter := h.keepInCharacter(key, npcPersonality, messages, modelConfig, text)
+	if !inCharacter {
+		return "", false, nil
+	}
+
+	text, blocked := h.moderate(unityID, npcPersonality, StageOutput, text)
+	return text, !blocked, nil
+}
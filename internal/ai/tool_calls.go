@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"encoding/json"
+	"log"
+	"rd-backend/internal/ai/tools"
+	"rd-backend/internal/types"
+	"slices"
+	"strings"
+)
+
+// ChatResult is an NPC's reply: the line they speak and the game actions they take
+type ChatResult struct {
+	Completion string
+	Actions    []types.ActionResponse
+	// Moderated is set when moderation changed or replaced the line
+	Moderated bool
+	// Expression is how the line is delivered, nil when it wasn't tagged
+	Expression *types.Expression
+	// Suggestions are what the player could say next, when they were asked for
+	Suggestions []types.Suggestion
+}
+
+// SetTools lets NPCs call the tools listed for them in npc.json. Valid calls are executed
+// through executor and returned as actions for the Unity client.
+func (h *AIHandler) SetTools(definitions *tools.Tools, executor tools.Executor) {
+	h.tools = definitions
+	h.toolExecutor = executor
+}
+
+// runTools validates and executes every call, returning the tool messages to send back to the
+// model and the actions to forward to the client. Invalid calls are reported to the model only.
+func (h *AIHandler) runTools(unityID string, npcPersonality types.NPC, calls []types.ToolCall) ([]types.OpenRouterMessage, []types.ActionResponse) {
+	messages := make([]types.OpenRouterMessage, 0, len(calls))
+	actions := make([]types.ActionResponse, 0, len(calls))
+
+	for _, call := range calls {
+		name := call.Function.Name
+		var content string
+
+		if err := h.tools.Validate(npcPersonality, name, call.Function.Arguments); err != nil {
+			log.Printf("Rejected %s tool call %s(%s): %v", npcPersonality.ID, name, call.Function.Arguments, err)
+			content = "Error: " + err.Error()
+		} else if result, err := h.toolExecutor.Execute(unityID, npcPersonality.ID, name, json.RawMessage(call.Function.Arguments)); err != nil {
+			log.Printf("Could not execute %s tool call %s(%s): %v", npcPersonality.ID, name, call.Function.Arguments, err)
+			content = "Error: that didn't work, carry on without it."
+		} else {
+			log.Printf("%s called %s(%s) for %s", npcPersonality.ID, name, call.Function.Arguments, unityID)
+			content = result
+			actions = append(actions, types.ActionResponse{
+				NpcId:     npcPersonality.ID,
+				Name:      name,
+				Arguments: json.RawMessage(call.Function.Arguments),
+			})
+		}
+
+		messages = append(messages, types.OpenRouterMessage{
+			Role:       "tool",
+			ToolCallID: call.ID,
+			Content:    content,
+		})
+	}
+
+	return messages, actions
+}
+
+// declaredTools returns the tools to offer the NPC and the matching tool_choice
+func (h *AIHandler) declaredTools(npcPersonality types.NPC) ([]types.Tool, string) {
+	if h.toolExecutor == nil {
+		return nil, ""
+	}
+
+	declared := h.tools.ForNPC(npcPersonality)
+	if len(declared) == 0 {
+		return nil, ""
+	}
+	return declared, "auto"
+}
+
+// followUp returns the conversation with the NPC's tool calls and their results appended,
+// so the model can say the line that goes with the actions
+func followUp(messages []types.OpenRouterMessage, reply *types.OpenRouterMessage, toolMessages []types.OpenRouterMessage) []types.OpenRouterMessage {
+	return slices.Concat(messages, []types.OpenRouterMessage{*reply}, toolMessages)
+}
+
+// chatWithTools gets the NPC's reply, running any tools it calls. If the NPC only acted
+// without speaking, a second request with tools disabled asks for its line.
+func (h *AIHandler) chatWithTools(unityID string, npcPersonality types.NPC, messages []types.OpenRouterMessage, modelConfig ModelConfig) (*ChatResult, error) {
+	declared, toolChoice := h.declaredTools(npcPersonality)
+	key := UsageKey{UnityID: unityID, NpcID: npcPersonality.ID, CallType: CallChat}
+
+	reply, err := h.makeToolRequest(key, messages, modelConfig, declared, toolChoice)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ChatResult{Completion: reply.Content}
+	if len(reply.ToolCalls) == 0 {
+		return result, nil
+	}
+
+	toolMessages, actions := h.runTools(unityID, npcPersonality, reply.ToolCalls)
+	result.Actions = actions
+
+	if strings.TrimSpace(reply.Content) != "" {
+		return result, nil
+	}
+
+	spoken, err := h.makeToolRequest(key, followUp(messages, reply, toolMessages), modelConfig, declared, "none")
+	if err != nil {
+		return nil, err
+	}
+	result.Completion = spoken.Content
+
+	return result, nil
+}
+
+// streamChatWithTools is chatWithTools for streamed replies. The result is never nil and
+// holds whatever was generated, even alongside an error.
+func (h *AIHandler) streamChatWithTools(unityID string, npcPersonality types.NPC, messages []types.OpenRouterMessage, modelConfig ModelConfig, onDelta func(string) error) (*ChatResult, error) {
+	declared, toolChoice := h.declaredTools(npcPersonality)
+	key := UsageKey{UnityID: unityID, NpcID: npcPersonality.ID, CallType: CallChat}
+
+	reply, err := h.makeToolStreamRequest(key, messages, modelConfig, declared, toolChoice, onDelta)
+	result := &ChatResult{Completion: reply.Content}
+	if err != nil || len(reply.ToolCalls) == 0 {
+		return result, err
+	}
+
+	toolMessages, actions := h.runTools(unityID, npcPersonality, reply.ToolCalls)
+	result.Actions = actions
+
+	if strings.TrimSpace(reply.Content) != "" {
+		return result, nil
+	}
+
+	spoken, err := h.makeToolStreamRequest(key, followUp(messages, reply, toolMessages), modelConfig, declared, "none", onDelta)
+	result.Completion = spoken.Content
+
+	return result, err
+}
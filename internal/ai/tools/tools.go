@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"rd-backend/internal/ai/schema"
+	"rd-backend/internal/types"
+	"strings"
+)
+
+// Tools are the game actions NPCs can take, keyed by name
+type Tools struct {
+	definitions map[string]types.ToolDefinition
+	schemas     map[string]*schema.Schema
+}
+
+// Executor carries out an action's server-side effects, like saving a quest flag.
+// The returned text is handed back to the model as the result of the call.
+type Executor interface {
+	Execute(unityID string, npcID string, name string, arguments json.RawMessage) (string, error)
+}
+
+func LoadToolConfig(path string) (*Tools, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var definitions map[string]types.ToolDefinition
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return nil, err
+	}
+
+	tools := &Tools{
+		definitions: definitions,
+		schemas:     make(map[string]*schema.Schema, len(definitions)),
+	}
+
+	for name, definition := range definitions {
+		if definition.Name != name {
+			return nil, fmt.Errorf("tool %s is declared under the name %q", name, definition.Name)
+		}
+
+		parsed, err := schema.Parse(definition.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("tool %s: %w", name, err)
+		}
+		if parsed.Type != "object" {
+			return nil, fmt.Errorf("tool %s: parameters must be an object schema", name)
+		}
+		tools.schemas[name] = parsed
+	}
+
+	return tools, nil
+}
+
+// CheckNPCs makes sure every tool an NPC lists is defined
+func (t *Tools) CheckNPCs(npcs map[string]types.NPC) error {
+	for id, npc := range npcs {
+		for _, name := range npc.Tools {
+			if _, exists := t.definitions[name]; !exists {
+				return fmt.Errorf("NPC %s uses unknown tool %q", id, name)
+			}
+		}
+	}
+	return nil
+}
+
+// ForNPC returns the tool declarations to send along with the NPC's chat requests
+func (t *Tools) ForNPC(npc types.NPC) []types.Tool {
+	if t == nil || len(npc.Tools) == 0 {
+		return nil
+	}
+
+	declared := make([]types.Tool, 0, len(npc.Tools))
+	for _, name := range npc.Tools {
+		definition, exists := t.definitions[name]
+		if !exists {
+			continue
+		}
+
+		declared = append(declared, types.Tool{
+			Type: "function",
+			Function: types.ToolFunction{
+				Name:        definition.Name,
+				Description: definition.Description,
+				Parameters:  definition.Parameters,
+			},
+		})
+	}
+	return declared
+}
+
+// Validate checks that npc may use the tool and that the arguments match its schema
+func (t *Tools) Validate(npc types.NPC, name string, arguments string) error {
+	allowed := false
+	for _, tool := range npc.Tools {
+		if tool == name {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%s can't use tool %q", npc.Name, name)
+	}
+
+	problems, err := t.schemas[name].Validate([]byte(arguments))
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid arguments: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log"
+	"rd-backend/internal/types"
+	"strings"
+)
+
+// Call types usage is recorded under
+const (
+	CallChat         = "chat"
+	CallText         = "text"
+	CallJSON         = "json"
+	CallDescription  = "description"
+	CallSummary      = "summary"
+	CallModeration   = "moderation"
+	CallExpression   = "expression"
+	CallRelationship = "relationship"
+	CallGossip       = "gossip"
+	CallDirector     = "director"
+	CallTextTrigger  = "text_trigger"
+	CallQuest        = "quest"
+	CallSuggestions  = "suggestions"
+	CallEval         = "eval"
+	CallInjection    = "injection"
+)
+
+// UsageKey says who a model call was made for. UnityID and NpcID are empty for calls
+// that don't belong to a player or NPC.
+type UsageKey struct {
+	UnityID  string
+	NpcID    string
+	CallType string
+}
+
+// UsageStore keeps the token usage and cost of every model call
+type UsageStore interface {
+	AddUsage(usage types.DBUsage) error
+}
+
+// SetUsageStore records the usage every provider response reports
+func (h *AIHandler) SetUsageStore(store UsageStore) {
+	h.usageStore = store
+}
+
+// recordUsage saves the usage of a call, in the background so replies aren't held up. Calls the
+// provider may have charged for without reporting usage, like a stream cut short, a timeout or a
+// server that doesn't report it, are recorded with tokens estimated from the request and whatever
+// came back.
+func (h *AIHandler) recordUsage(key UsageKey, model string, request types.OpenRouterRequest, response *types.OpenRouterResponse, err error) {
+	if h.usageStore == nil {
+		return
+	}
+
+	usage := types.DBUsage{
+		UnityID:  key.UnityID,
+		NpcID:    key.NpcID,
+		Model:    model,
+		CallType: key.CallType,
+	}
+	if response != nil {
+		if response.Model != "" {
+			usage.Model = response.Model
+		}
+		usage.GenerationID = response.ID
+	}
+
+	switch {
+	case response != nil && response.Usage != nil:
+		usage.PromptTokens = response.Usage.PromptTokens
+		usage.CompletionTokens = response.Usage.CompletionTokens
+		usage.Cost = response.Usage.Cost
+
+	case mayBeBilled(response, err):
+		tokenizer := h.contextBuilder.tokenizer
+		for _, message := range request.Messages {
+			usage.PromptTokens += tokenizer.CountTokens(message.Content) + messageOverhead
+		}
+		usage.CompletionTokens = tokenizer.CountTokens(generatedText(response))
+		usage.Estimated = true
+
+	default:
+		return
+	}
+
+	go func() {
+		if err := h.usageStore.AddUsage(usage); err != nil {
+			log.Printf("Could not record usage for %s/%s: %v", key.UnityID, key.CallType, err)
+		}
+	}()
+}
+
+// mayBeBilled is whether the provider could have charged for a call that reported no usage: it
+// answered, started answering, or was cut off while it may have been working on the request.
+// Requests it turned down are free.
+func mayBeBilled(response *types.OpenRouterResponse, err error) bool {
+	if err == nil || errors.Is(err, ErrStreamAborted) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	return generatedText(response) != ""
+}
+
+// generatedText is everything the model wrote in response, tool call arguments included
+func generatedText(response *types.OpenRouterResponse) string {
+	if response == nil {
+		return ""
+	}
+
+	var text strings.Builder
+	for _, choice := range response.Choices {
+		text.WriteString(choice.Message.Content)
+		for _, call := range choice.Message.ToolCalls {
+			text.WriteString(call.Function.Name)
+			text.WriteString(call.Function.Arguments)
+		}
+	}
+	return text.String()
+}
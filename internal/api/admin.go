@@ -0,0 +1,127 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"rd-backend/internal/types"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultUsageDays = 7
+	maxUsageDays     = 90
+)
+
+// RequireAdminToken only lets through requests with token in the X-Admin-Token header.
+// With no token configured the admin routes are closed.
+func RequireAdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		given := c.GetHeader("X-Admin-Token")
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// usageSince reads the ?days= window, defaulting to the last week
+func usageSince(c *gin.Context) time.Time {
+	days, err := strconv.Atoi(c.Query("days"))
+	if err != nil || days <= 0 {
+		days = defaultUsageDays
+	}
+	if days > maxUsageDays {
+		days = maxUsageDays
+	}
+
+	today := time.Now().Truncate(24 * time.Hour)
+	return today.AddDate(0, 0, -(days - 1))
+}
+
+// GetUsage shows daily token usage and spend by NPC and by model
+func (h *APIHandler) GetUsage(c *gin.Context) {
+	since := usageSince(c)
+
+	byNPC, err := h.dbHandler.GetDailyUsageByNPC(since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	byModel, err := h.dbHandler.GetDailyUsageByModel(since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.UsageResponse{
+		Since:   since.Format(time.DateOnly),
+		ByNPC:   byNPC,
+		ByModel: byModel,
+	})
+}
+
+// GetPlayerUsage shows a single player's daily usage by NPC
+func (h *APIHandler) GetPlayerUsage(c *gin.Context) {
+	since := usageSince(c)
+
+	byNPC, err := h.dbHandler.GetPlayerUsage(c.Param("unity_id"), since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.UsageResponse{
+		Since: since.Format(time.DateOnly),
+		ByNPC: byNPC,
+	})
+}
+
+// GetFlagCounts shows which players were flagged most, for abuse review. ?category= narrows it
+// down, prompt_injection and break_character for attempts to take over the NPCs.
+func (h *APIHandler) GetFlagCounts(c *gin.Context) {
+	since := usageSince(c)
+
+	counts, err := h.dbHandler.CountFlaggedContent("", c.Query("category"), since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.FlagCountsResponse{
+		Since:  since.Format(time.DateOnly),
+		Counts: counts,
+	})
+}
+
+// GetPlayerFlagCounts shows how often a single player was flagged, by category
+func (h *APIHandler) GetPlayerFlagCounts(c *gin.Context) {
+	since := usageSince(c)
+
+	counts, err := h.dbHandler.CountFlaggedContent(c.Param("unity_id"), c.Query("category"), since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.FlagCountsResponse{
+		Since:  since.Format(time.DateOnly),
+		Counts: counts,
+	})
+}
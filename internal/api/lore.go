@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"rd-backend/internal/lore"
+	"rd-backend/internal/types"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultLoreResults = 5
+
+// LoreHandler lets writers check which lore a message would pull into an NPC's prompt
+type LoreHandler struct {
+	index *lore.Index
+}
+
+func NewLoreHandler(index *lore.Index) *LoreHandler {
+	return &LoreHandler{
+		index: index,
+	}
+}
+
+// SearchLore runs ?q= against the lore index as the NPC in ?npc_id=, without one only lore
+// everyone knows is searched
+func (h *LoreHandler) SearchLore(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "q is required",
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultLoreResults
+	}
+
+	npcID := c.Query("npc_id")
+	found := h.index.Search(query, npcID, limit)
+
+	results := make([]types.LoreResult, len(found))
+	for i, result := range found {
+		results[i] = types.LoreResult{
+			ID:      result.ID,
+			Title:   result.Title,
+			Text:    result.Text,
+			KnownBy: result.KnownBy,
+			Score:   result.Score,
+		}
+	}
+
+	c.JSON(http.StatusOK, types.LoreSearchResponse{
+		Query:   query,
+		NpcID:   npcID,
+		Chunks:  h.index.Size(),
+		Results: results,
+	})
+}
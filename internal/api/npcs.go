@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/clock"
+	"rd-backend/internal/types"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NPCHandler answers questions about NPCs, like where they are right now
+type NPCHandler struct {
+	npcs  *npc.NPCs
+	clock *clock.Clock
+}
+
+func NewNPCHandler(npcs *npc.NPCs, clock *clock.Clock) *NPCHandler {
+	return &NPCHandler{
+		npcs:  npcs,
+		clock: clock,
+	}
+}
+
+// gameTime reads ?time=HH:MM, or the game time ?unity_id= last reported
+func (h *NPCHandler) gameTime(c *gin.Context) (int, bool, error) {
+	if value := c.Query("time"); value != "" {
+		minute, err := npc.ParseClock(value)
+		return minute, err == nil, err
+	}
+
+	minute, known := h.clock.Now(c.Query("unity_id"))
+	return minute, known, nil
+}
+
+func whereabouts(npcPersonality types.NPC, minute int, known bool) types.WhereaboutsResponse {
+	response := types.WhereaboutsResponse{
+		NpcId:    npcPersonality.ID,
+		Location: npcPersonality.Location,
+	}
+	if !known {
+		return response
+	}
+
+	response.Time = npc.FormatClock(minute)
+	if entry, scheduled := npc.At(npcPersonality, minute); scheduled {
+		response.Location = entry.Location
+		response.Activity = entry.Activity
+		response.Scheduled = true
+	}
+	return response
+}
+
+// GetWhereabouts says where an NPC is at ?time=, or at the player's game time with ?unity_id=
+func (h *NPCHandler) GetWhereabouts(c *gin.Context) {
+	npcPersonality, exists := (*h.npcs)[c.Param("npc_id")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "NPC not found",
+		})
+		return
+	}
+
+	minute, known, err := h.gameTime(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, whereabouts(npcPersonality, minute, known))
+}
+
+// GetAllWhereabouts is GetWhereabouts for every NPC
+func (h *NPCHandler) GetAllWhereabouts(c *gin.Context) {
+	minute, known, err := h.gameTime(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	all := make([]types.WhereaboutsResponse, 0, len(*h.npcs))
+	for _, npcPersonality := range *h.npcs {
+		all = append(all, whereabouts(npcPersonality, minute, known))
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].NpcId < all[j].NpcId })
+
+	c.JSON(http.StatusOK, all)
+}
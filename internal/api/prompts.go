@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/prompts"
+	"rd-backend/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PromptHandler lets writers look at and try out the system prompt templates
+type PromptHandler struct {
+	aiHandler *ai.AIHandler
+	// dir is where templates are reloaded from, empty for the embedded ones
+	dir string
+}
+
+func NewPromptHandler(aiHandler *ai.AIHandler, dir string) *PromptHandler {
+	return &PromptHandler{
+		aiHandler: aiHandler,
+		dir:       dir,
+	}
+}
+
+func (h *PromptHandler) GetPrompts(c *gin.Context) {
+	c.JSON(http.StatusOK, promptsResponse(h.aiHandler.Prompts()))
+}
+
+func (h *PromptHandler) PreviewPrompt(c *gin.Context) {
+	var req types.PromptPreviewRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	prompt, tokens, err := h.aiHandler.PreviewPrompt(req.Channel, req.NpcID, req.Template, prompts.Data{
+		Events:  req.Events,
+		Summary: req.Summary,
+		Memory:  req.Memory,
+		Lore:    req.Lore,
+		Details: req.Details,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.PromptPreviewResponse{
+		Prompt: prompt,
+		Tokens: tokens,
+	})
+}
+
+// ReloadPrompts loads the templates again, optionally switching version, and uses them from
+// the next request on. The running templates are kept if the new ones don't parse.
+func (h *PromptHandler) ReloadPrompts(c *gin.Context) {
+	var req types.PromptReloadRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	version := req.Version
+	if version == "" {
+		version = h.aiHandler.Prompts().Version()
+	}
+
+	promptSet, err := prompts.Load(version, h.dir)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	h.aiHandler.SetPrompts(promptSet)
+
+	c.JSON(http.StatusOK, promptsResponse(promptSet))
+}
+
+func promptsResponse(promptSet *prompts.Set) types.PromptsResponse {
+	templates := make(map[string]string, len(prompts.Channels))
+	for _, channel := range prompts.Channels {
+		templates[channel] = promptSet.Text(channel)
+	}
+
+	return types.PromptsResponse{
+		Version:   promptSet.Version(),
+		Source:    promptSet.Source(),
+		Templates: templates,
+	}
+}
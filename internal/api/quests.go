@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"rd-backend/internal/quests"
+	"rd-backend/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// QuestHandler lets the game show the player's quest log
+type QuestHandler struct {
+	board *quests.Board
+}
+
+func NewQuestHandler(board *quests.Board) *QuestHandler {
+	return &QuestHandler{
+		board: board,
+	}
+}
+
+// GetQuests lists every quest NPCs gave the player, newest first
+func (h *QuestHandler) GetQuests(c *gin.Context) {
+	unityID := c.Param("unity_id")
+
+	quests, err := h.board.Quests(unityID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.QuestsResponse{
+		UnityID: unityID,
+		Quests:  quests,
+	})
+}
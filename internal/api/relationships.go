@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"rd-backend/internal/relationships"
+	"rd-backend/internal/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelationshipHandler lets the game show how NPCs feel about the player
+type RelationshipHandler struct {
+	tracker *relationships.Tracker
+}
+
+func NewRelationshipHandler(tracker *relationships.Tracker) *RelationshipHandler {
+	return &RelationshipHandler{
+		tracker: tracker,
+	}
+}
+
+// GetRelationships lists every NPC the player has a relationship with
+func (h *RelationshipHandler) GetRelationships(c *gin.Context) {
+	unityID := c.Param("unity_id")
+
+	relationships, err := h.tracker.Relationships(unityID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.RelationshipsResponse{
+		UnityID:       unityID,
+		Relationships: relationships,
+	})
+}
+
+// GetRelationship shows one NPC's relationship with the player, NPCs they haven't met are strangers
+func (h *RelationshipHandler) GetRelationship(c *gin.Context) {
+	relationship, err := h.tracker.Relationship(c.Param("unity_id"), c.Param("npc_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, relationship)
+}
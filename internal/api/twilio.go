@@ -2,8 +2,10 @@ package api
 
 import (
 	"fmt"
+	"os"
 	"rd-backend/internal/ai"
 	"rd-backend/internal/db"
+	"rd-backend/internal/ratelimit"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -15,16 +17,23 @@ type TextingHandler struct {
 	twilioClient *twilio.RestClient
 	dbHandler    *db.DBHandler
 	aiHandler    *ai.AIHandler
+	limiter      ratelimit.Limiter
 }
 
-func NewTextingHandler(dbHandler *db.DBHandler, aiHandler *ai.AIHandler) *TextingHandler {
+func NewTextingHandler(dbHandler *db.DBHandler, aiHandler *ai.AIHandler, limiter ratelimit.Limiter) *TextingHandler {
 	return &TextingHandler{
 		twilioClient: twilio.NewRestClient(),
 		dbHandler:    dbHandler,
 		aiHandler:    aiHandler,
+		limiter:      limiter,
 	}
 }
 
+// CanSend is whether Twilio credentials are set, without them every SMS fails
+func (h *TextingHandler) CanSend() bool {
+	return os.Getenv("TWILIO_ACCOUNT_SID") != "" && os.Getenv("TWILIO_AUTH_TOKEN") != ""
+}
+
 func (h *TextingHandler) SendSMS(from, to, message string) error {
 	params := &openapi.CreateMessageParams{
 		To:   &to,
@@ -40,24 +49,6 @@ func (h *TextingHandler) SendSMS(from, to, message string) error {
 	return nil
 }
 
-// get message
-// retrieve number
-// sql lookup in texts database, based on number received and current number
-// create response
-// send text message back from that number, based on previous text messages
-// therefore : find where rec# and send# are player/ai or ai/player.
-// how to get the number?
-// ai has it in json, each AI will have a different number
-
-func (h *TextingHandler) SendSMSBasic() {
-	err := h.SendSMS("+18885103459", "+16074221508", "Hello from your AI friend!")
-	if err != nil {
-		fmt.Printf("Failed to send SMS: %v\n", err)
-		return
-	}
-	fmt.Println("Message sent successfully!")
-}
-
 func (h *TextingHandler) ReceiveSMS(c *gin.Context) {
 	// Set content type to XML
 	c.Header("Content-Type", "text/xml")
@@ -97,16 +88,33 @@ func (h *TextingHandler) processMessage(from string, to string, message string)
 		fmt.Println("Could not find player by phone number: " + err.Error())
 		return "Sorry, your number isn't registered in our system."
 	}
-	if err := h.dbHandler.AddTextToDatabase(player.UnityID, message, from, to, from); err != nil {
-		fmt.Println("Could not add text to database.")
-		return "Could not add text to database."
+
+	// Texts are limited by phone number, the NPC takes a break instead of answering
+	decision, err := h.limiter.Allow(from, ratelimit.ChannelSMS, player.Tier)
+	if err != nil {
+		fmt.Println("Rate limiter failed: " + err.Error())
+	} else if !decision.Allowed {
+		fmt.Printf("Limited %s (%s)\n", from, decision.Reason)
+		return h.aiHandler.GetTextBreakLine(to)
+	}
+
+	// Only the moderated text is kept, and a blocked one isn't kept at all
+	input := h.aiHandler.ScreenText(player.UnityID, to, message)
+	if input.Blocked() {
+		return input.Reply
 	}
+
+	// The history is read before the text is added, it's sent on its own as the message to answer
 	textMessage, err := h.dbHandler.GetLastTextsFromDB(player.UnityID, to, 4)
 	if err != nil {
 		fmt.Println("Could not get last texts from DB")
 		return "Could not get last texts from DB."
 	}
-	completion, err := h.aiHandler.GetTextCompletion(message, textMessage, to, from)
+	if err := h.dbHandler.AddTextToDatabase(player.UnityID, input.Text, from, to, from); err != nil {
+		fmt.Println("Could not add text to database.")
+		return "Could not add text to database."
+	}
+	completion, err := h.aiHandler.GetTextCompletion(player.UnityID, input, textMessage, to, from)
 	if err != nil {
 		fmt.Println("Could not get text completion")
 		return "Couldn't process completion."
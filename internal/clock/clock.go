@@ -0,0 +1,66 @@
+package clock
+
+import (
+	"math"
+	"rd-backend/internal/ai/npc"
+	"sync"
+	"time"
+)
+
+// MaxScale is the fastest a clock can run, a game day every real minute
+const MaxScale = npc.MinutesPerDay
+
+// Clock keeps each player's game time as their client last reported it. Between reports
+// the time runs on at the rate the client gave, so it doesn't need reporting every minute.
+type Clock struct {
+	mu      sync.Mutex
+	players map[string]reading
+}
+
+type reading struct {
+	minute float64
+	// scale is game minutes per real minute, 0 stops the clock until the next report
+	scale float64
+	at    time.Time
+}
+
+func New() *Clock {
+	return &Clock{
+		players: make(map[string]reading),
+	}
+}
+
+// Set records the player's game time in minutes since midnight
+func (c *Clock) Set(unityID string, minute int, scale float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.players[unityID] = reading{
+		minute: float64(minute),
+		scale:  scale,
+		at:     time.Now(),
+	}
+}
+
+// Forget drops the player's game time, for when they disconnect
+func (c *Clock) Forget(unityID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.players, unityID)
+}
+
+// Now returns the player's game time in minutes since midnight, false if they never reported it
+func (c *Clock) Now(unityID string) (int, bool) {
+	c.mu.Lock()
+	last, exists := c.players[unityID]
+	c.mu.Unlock()
+
+	if !exists {
+		return 0, false
+	}
+
+	// Wrapped before converting so a clock left running for long can't overflow
+	elapsed := time.Since(last.at).Minutes() * last.scale
+	return int(math.Mod(last.minute+elapsed, npc.MinutesPerDay)), true
+}
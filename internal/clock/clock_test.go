@@ -0,0 +1,47 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNow(t *testing.T) {
+	tests := []struct {
+		name   string
+		minute float64
+		scale  float64
+		ago    time.Duration
+		want   int
+	}{
+		{"stopped", 600, 0, time.Hour, 600},
+		{"real time", 600, 1, 30 * time.Minute, 630},
+		{"wraps at midnight", 1430, 1, 20 * time.Minute, 10},
+		{"fastest for a long time", 0, MaxScale, 24 * 365 * time.Hour, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := New()
+			c.players["player"] = reading{minute: test.minute, scale: test.scale, at: time.Now().Add(-test.ago)}
+
+			got, ok := c.Now("player")
+			if !ok {
+				t.Fatal("expected the player's time to be known")
+			}
+			// A little slack for the time the test itself takes
+			if got < test.want || got > test.want+1 {
+				t.Errorf("Now = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestForget(t *testing.T) {
+	c := New()
+	c.Set("player", 600, 1)
+	c.Forget("player")
+
+	if _, ok := c.Now("player"); ok {
+		t.Error("expected the player's time to be forgotten")
+	}
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"rd-backend/internal/types"
+)
+
+// Affinity is kept between these bounds
+const (
+	MinAffinity = -100
+	MaxAffinity = 100
+)
+
+// AffinityChange is a relationship after ChangeAffinity
+type AffinityChange struct {
+	Affinity     int
+	Stage        string
+	StageChanged bool
+}
+
+// ChangeAffinity adds delta to how much the NPC likes the player and moves the relationship to
+// stageFor the new score. Both happen in one transaction, and the row stays locked until it
+// commits, so concurrent changes can't leave a stage that doesn't match the affinity.
+func (h *DBHandler) ChangeAffinity(unityID string, npcID string, delta int, stageFor func(affinity int) string) (*AffinityChange, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("could not change affinity: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The upsert returns the stage from before the change, new rows start with the default one
+	var change AffinityChange
+	var previous string
+
+	err = tx.QueryRow(`
+		INSERT INTO npc_affinity (unity_id, npc_id, affinity)
+		VALUES ($1, $2, GREATEST($4, LEAST($5, $3)))
+		ON CONFLICT (unity_id, npc_id)
+		DO UPDATE SET affinity = GREATEST($4, LEAST($5, npc_affinity.affinity + $3)), updated_at = CURRENT_TIMESTAMP
+		RETURNING affinity, stage
+	`, unityID, npcID, delta, MinAffinity, MaxAffinity).Scan(&change.Affinity, &previous)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not change affinity: %w", err)
+	}
+
+	change.Stage = stageFor(change.Affinity)
+	change.StageChanged = previous != change.Stage
+	if change.StageChanged {
+		_, err = tx.Exec(`
+			UPDATE npc_affinity
+			SET stage = $3
+			WHERE unity_id = $1 AND npc_id = $2
+		`, unityID, npcID, change.Stage)
+
+		if err != nil {
+			return nil, fmt.Errorf("could not set relationship stage: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("could not change affinity: %w", err)
+	}
+
+	return &change, nil
+}
+
+// GetRelationship returns how the NPC feels about the player, nil if they haven't met
+func (h *DBHandler) GetRelationship(unityID string, npcID string) (*types.DBRelationship, error) {
+	relationship := types.DBRelationship{
+		UnityID: unityID,
+		NpcID:   npcID,
+	}
+
+	err := h.db.QueryRow(`
+		SELECT affinity, stage, updated_at
+		FROM npc_affinity
+		WHERE unity_id = $1 AND npc_id = $2
+	`, unityID, npcID).Scan(&relationship.Affinity, &relationship.Stage, &relationship.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &relationship, nil
+}
+
+// GetRelationships returns every NPC's relationship with the player
+func (h *DBHandler) GetRelationships(unityID string) ([]types.DBRelationship, error) {
+	rows, err := h.db.Query(`
+		SELECT unity_id, npc_id, affinity, stage, updated_at
+		FROM npc_affinity
+		WHERE unity_id = $1
+		ORDER BY npc_id
+	`, unityID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get relationships: %w", err)
+	}
+
+	defer rows.Close()
+
+	relationships := []types.DBRelationship{}
+	for rows.Next() {
+		var relationship types.DBRelationship
+		if err := rows.Scan(&relationship.UnityID, &relationship.NpcID, &relationship.Affinity, &relationship.Stage, &relationship.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		relationships = append(relationships, relationship)
+	}
+
+	return relationships, nil
+}
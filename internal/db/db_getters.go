@@ -11,10 +11,10 @@ func (h *DBHandler) GetPlayerByUnityId(unityID string) (*types.Player, error) {
 	var player types.Player
 
 	err := h.db.QueryRow(`
-        SELECT id, unity_id, phone_number
+        SELECT id, unity_id, phone_number, tier
         FROM players 
         WHERE unity_id = $1
-    `, unityID).Scan(&player.ID, &player.UnityID, &player.PhoneNumber)
+    `, unityID).Scan(&player.ID, &player.UnityID, &player.PhoneNumber, &player.Tier)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -31,9 +31,9 @@ func (h *DBHandler) GetPlayerByPhoneNumber(phoneNumber string) (*types.Player, e
 
 	//fmt.Println(phoneNumber)
 	err := h.db.QueryRow(`
-	SELECT id, unity_id, phone_number 
+	SELECT id, unity_id, phone_number, tier
 	FROM players 
-	WHERE phone_number = $1`, phoneNumber).Scan(&player.ID, &player.UnityID, &player.PhoneNumber)
+	WHERE phone_number = $1`, phoneNumber).Scan(&player.ID, &player.UnityID, &player.PhoneNumber, &player.Tier)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -45,14 +45,17 @@ func (h *DBHandler) GetPlayerByPhoneNumber(phoneNumber string) (*types.Player, e
 	return &player, nil
 }
 
-func (h *DBHandler) GetLastMessagesFromDB(unityID string, numberBack int) ([]types.DBChatMessage, error) {
+// GetLastMessagesWithNPC returns the latest lines between the player and one NPC, newest first.
+// Lines to and from other NPCs are left out so they don't end up in this NPC's mouth.
+func (h *DBHandler) GetLastMessagesWithNPC(unityID string, npcID string, numberBack int) ([]types.DBChatMessage, error) {
 	rows, err := h.db.Query(`
-    SELECT message, sender, sent_to, created_at 
-    	FROM messages 
-    	WHERE unity_id = $1 
-    	ORDER BY created_at DESC 
-    	LIMIT $2
-	`, unityID, numberBack)
+		SELECT message, sender, sent_to, created_at
+		FROM messages
+		WHERE unity_id = $1
+		AND (sender = $2 OR (sender = 'player' AND sent_to = $2))
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, unityID, npcID, numberBack)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
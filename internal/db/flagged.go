@@ -0,0 +1,52 @@
+package db
+
+import (
+	"fmt"
+	"rd-backend/internal/types"
+	"time"
+)
+
+// AddFlaggedContent records a message or reply that moderation rewrote or blocked
+func (h *DBHandler) AddFlaggedContent(unityID string, npcID string, stage string, action string, category string, content string) error {
+	_, err := h.db.Exec(`
+		INSERT INTO flagged_content (unity_id, npc_id, stage, action, category, content)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, unityID, npcID, stage, action, category, content)
+
+	if err != nil {
+		return fmt.Errorf("could not add flagged content: %w", err)
+	}
+
+	return nil
+}
+
+// CountFlaggedContent counts flagged content per player and category since the given time, most
+// flagged first. An empty unityID or category counts every player or category.
+func (h *DBHandler) CountFlaggedContent(unityID string, category string, since time.Time) ([]types.FlagCount, error) {
+	rows, err := h.db.Query(`
+		SELECT unity_id, category, COUNT(*), MAX(created_at)
+		FROM flagged_content
+		WHERE created_at >= $1
+			AND ($2 = '' OR unity_id = $2)
+			AND ($3 = '' OR category = $3)
+		GROUP BY unity_id, category
+		ORDER BY 3 DESC, 4 DESC
+	`, since, unityID, category)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to count flagged content: %w", err)
+	}
+
+	defer rows.Close()
+
+	counts := []types.FlagCount{}
+	for rows.Next() {
+		var count types.FlagCount
+		if err := rows.Scan(&count.UnityID, &count.Category, &count.Count, &count.Last); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, nil
+}
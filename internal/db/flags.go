@@ -0,0 +1,47 @@
+package db
+
+import (
+	"fmt"
+	"rd-backend/internal/types"
+)
+
+func (h *DBHandler) SetPlayerFlag(unityID string, flag string, value string) error {
+	_, err := h.db.Exec(`
+		INSERT INTO player_flags (unity_id, flag, value)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (unity_id, flag)
+		DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+	`, unityID, flag, value)
+
+	if err != nil {
+		return fmt.Errorf("could not set player flag: %w", err)
+	}
+
+	return nil
+}
+
+func (h *DBHandler) GetPlayerFlags(unityID string) ([]types.DBPlayerFlag, error) {
+	rows, err := h.db.Query(`
+		SELECT unity_id, flag, value, updated_at
+		FROM player_flags
+		WHERE unity_id = $1
+		ORDER BY flag
+	`, unityID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get player flags: %w", err)
+	}
+
+	defer rows.Close()
+
+	var flags []types.DBPlayerFlag
+	for rows.Next() {
+		var flag types.DBPlayerFlag
+		if err := rows.Scan(&flag.UnityID, &flag.Flag, &flag.Value, &flag.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		flags = append(flags, flag)
+	}
+
+	return flags, nil
+}
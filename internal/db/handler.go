@@ -11,6 +11,8 @@ import (
 
 type DBHandler struct {
 	db *sql.DB
+	// vectorSearch is set when pgvector backs the memories table
+	vectorSearch bool
 }
 
 func NewDBHandler() (*DBHandler, error) {
@@ -26,9 +28,12 @@ func NewDBHandler() (*DBHandler, error) {
 	}
 	fmt.Printf("Postgres Connected!\n")
 
-	return &DBHandler{
+	handler := &DBHandler{
 		db: db,
-	}, nil
+	}
+	handler.detectVectorSupport()
+
+	return handler, nil
 }
 
 func (h *DBHandler) Disconnect() error {
@@ -86,6 +91,24 @@ func (h *DBHandler) AddMessageToDatabase(unityID string, messageText string, sen
 	return nil
 }
 
+// AddReplyToDatabase is AddMessageToDatabase for NPC replies, keeping how the line was delivered
+func (h *DBHandler) AddReplyToDatabase(unityID string, messageText string, sender string, sentTo string, expression *types.Expression) error {
+	if expression == nil {
+		return h.AddMessageToDatabase(unityID, messageText, sender, sentTo)
+	}
+
+	_, err := h.db.Exec(`
+        INSERT INTO messages (unity_id, message, sender, sent_to, emotion, emotion_intensity, gesture)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, unityID, messageText, sender, sentTo, expression.Emotion, expression.Intensity, expression.Gesture)
+
+	if err != nil {
+		return fmt.Errorf("failed to add reply: %w", err)
+	}
+
+	return nil
+}
+
 func (h *DBHandler) AddTextToDatabase(unityID string, messageText string, senderNumber string, receiverNumber string, playerNumber string) error {
 	_, err := h.db.Exec(`
         INSERT INTO texts (unity_id, message, sender_number, receiver_number, player_number)
@@ -100,15 +123,19 @@ func (h *DBHandler) AddTextToDatabase(unityID string, messageText string, sender
 	return nil
 }
 
-func (h *DBHandler) AddEventToDatabase(unityID string, eventType string, eventDetails string) error {
-	_, err := h.db.Exec(`
+// AddEventToDatabase stores the event and returns its ID
+func (h *DBHandler) AddEventToDatabase(unityID string, eventType string, eventDetails string) (int, error) {
+	var id int
+
+	err := h.db.QueryRow(`
 		INSERT INTO events (unity_id, event_type, event_details)
 		VALUES ($1, $2, $3)
-	`, unityID, eventType, eventDetails)
+		RETURNING id
+	`, unityID, eventType, eventDetails).Scan(&id)
 
 	if err != nil {
-		return fmt.Errorf("could not add event into database: %w", err)
+		return 0, fmt.Errorf("could not add event into database: %w", err)
 	}
 
-	return nil
+	return id, nil
 }
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"rd-backend/internal/types"
+	"time"
+)
+
+// AddKnowledge records that an NPC knows about an event. It returns false when the NPC
+// already knew, the first way they found out is kept.
+func (h *DBHandler) AddKnowledge(knowledge types.DBKnowledge) (bool, error) {
+	result, err := h.db.Exec(`
+		INSERT INTO npc_knowledge (unity_id, npc_id, event_id, content, source_npc_id, hops)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (unity_id, npc_id, event_id) DO NOTHING
+	`, knowledge.UnityID, knowledge.NpcID, knowledge.EventID, knowledge.Content, knowledge.SourceNpcID, knowledge.Hops)
+
+	if err != nil {
+		return false, fmt.Errorf("could not add knowledge: %w", err)
+	}
+
+	added, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not add knowledge: %w", err)
+	}
+
+	return added > 0, nil
+}
+
+// GetKnowledge returns what the NPC knows about the player, newest first
+func (h *DBHandler) GetKnowledge(unityID string, npcID string, limit int) ([]types.DBKnowledge, error) {
+	rows, err := h.db.Query(`
+		SELECT id, unity_id, npc_id, event_id, content, source_npc_id, hops, created_at
+		FROM npc_knowledge
+		WHERE unity_id = $1 AND npc_id = $2
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, unityID, npcID, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get knowledge: %w", err)
+	}
+
+	return scanKnowledge(rows)
+}
+
+// GetGossip returns what teller learned before learnedBefore and could pass on to listener:
+// things listener doesn't know yet, didn't tell teller, and that haven't gone maxHops already.
+// Oldest first, across all players.
+func (h *DBHandler) GetGossip(tellerID string, listenerID string, learnedBefore time.Time, maxHops int, limit int) ([]types.DBKnowledge, error) {
+	rows, err := h.db.Query(`
+		SELECT k.id, k.unity_id, k.npc_id, k.event_id, k.content, k.source_npc_id, k.hops, k.created_at
+		FROM npc_knowledge k
+		WHERE k.npc_id = $1
+			AND k.source_npc_id <> $2
+			AND k.created_at <= $3
+			AND k.hops < $4
+			AND NOT EXISTS (
+				SELECT 1 FROM npc_knowledge l
+				WHERE l.unity_id = k.unity_id AND l.npc_id = $2 AND l.event_id = k.event_id
+			)
+		ORDER BY k.created_at
+		LIMIT $5
+	`, tellerID, listenerID, learnedBefore, maxHops, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gossip: %w", err)
+	}
+
+	return scanKnowledge(rows)
+}
+
+func scanKnowledge(rows *sql.Rows) ([]types.DBKnowledge, error) {
+	defer rows.Close()
+
+	var knowledge []types.DBKnowledge
+	for rows.Next() {
+		var item types.DBKnowledge
+		if err := rows.Scan(&item.ID, &item.UnityID, &item.NpcID, &item.EventID, &item.Content, &item.SourceNpcID, &item.Hops, &item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		knowledge = append(knowledge, item)
+	}
+
+	return knowledge, nil
+}
+
+// SetPlayerLocation remembers where the player was last seen
+func (h *DBHandler) SetPlayerLocation(unityID string, location string) error {
+	_, err := h.db.Exec(`
+		UPDATE players SET last_location = $2 WHERE unity_id = $1
+	`, unityID, location)
+
+	if err != nil {
+		return fmt.Errorf("could not set player location: %w", err)
+	}
+
+	return nil
+}
+
+// GetPlayerLocation returns where the player was last seen, empty if unknown
+func (h *DBHandler) GetPlayerLocation(unityID string) (string, error) {
+	var location string
+
+	err := h.db.QueryRow(`
+		SELECT last_location FROM players WHERE unity_id = $1
+	`, unityID).Scan(&location)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", fmt.Errorf("database error: %w", err)
+	}
+
+	return location, nil
+}
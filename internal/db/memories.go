@@ -0,0 +1,144 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// maxScannedMemories bounds the in-process search when pgvector isn't available
+const maxScannedMemories = 2000
+
+// detectVectorSupport checks whether memories.embedding is a pgvector column
+func (h *DBHandler) detectVectorSupport() {
+	var udtName string
+	err := h.db.QueryRow(`
+		SELECT udt_name
+		FROM information_schema.columns
+		WHERE table_name = 'memories' AND column_name = 'embedding'
+	`).Scan(&udtName)
+
+	if err != nil {
+		log.Printf("Could not check memories.embedding column, using in-process search: %v", err)
+		return
+	}
+
+	h.vectorSearch = udtName == "vector"
+	if h.vectorSearch {
+		fmt.Printf("pgvector found, searching memories in Postgres\n")
+	}
+}
+
+// vectorLiteral formats an embedding the way pgvector parses it
+func vectorLiteral(embedding []float32) string {
+	parts := make([]string, len(embedding))
+	for i, v := range embedding {
+		parts[i] = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// AddMemory stores a piece of text and its embedding. Use an empty npcID for
+// memories every NPC shares.
+func (h *DBHandler) AddMemory(unityID string, npcID string, kind string, content string, embedding []float32) error {
+	var err error
+	if h.vectorSearch {
+		_, err = h.db.Exec(`
+			INSERT INTO memories (unity_id, npc_id, kind, content, embedding)
+			VALUES ($1, $2, $3, $4, $5::vector)
+		`, unityID, npcID, kind, content, vectorLiteral(embedding))
+	} else {
+		_, err = h.db.Exec(`
+			INSERT INTO memories (unity_id, npc_id, kind, content, embedding)
+			VALUES ($1, $2, $3, $4, $5)
+		`, unityID, npcID, kind, content, pq.Float32Array(embedding))
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not add memory: %w", err)
+	}
+
+	return nil
+}
+
+// SearchMemories returns the player's memories closest to embedding that this NPC knows about,
+// most similar first. Events are only known to the NPCs that saw or heard about them, shared
+// event memories from before are left out.
+func (h *DBHandler) SearchMemories(unityID string, npcID string, embedding []float32, limit int) ([]types.DBMemory, error) {
+	if h.vectorSearch {
+		return h.searchMemoriesVector(unityID, npcID, embedding, limit)
+	}
+	return h.searchMemoriesInProcess(unityID, npcID, embedding, limit)
+}
+
+func (h *DBHandler) searchMemoriesVector(unityID string, npcID string, embedding []float32, limit int) ([]types.DBMemory, error) {
+	rows, err := h.db.Query(`
+		SELECT id, npc_id, kind, content, created_at, 1 - (embedding <=> $3::vector)
+		FROM memories
+		WHERE unity_id = $1
+		AND (npc_id = $2 OR (npc_id = '' AND kind <> 'event'))
+		ORDER BY embedding <=> $3::vector
+		LIMIT $4
+	`, unityID, npcID, vectorLiteral(embedding), limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to search memories: %w", err)
+	}
+
+	defer rows.Close()
+
+	var memories []types.DBMemory
+	for rows.Next() {
+		memory := types.DBMemory{UnityID: unityID}
+		if err := rows.Scan(&memory.ID, &memory.NpcID, &memory.Kind, &memory.Content, &memory.CreatedAt, &memory.Similarity); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		memories = append(memories, memory)
+	}
+
+	return memories, nil
+}
+
+func (h *DBHandler) searchMemoriesInProcess(unityID string, npcID string, embedding []float32, limit int) ([]types.DBMemory, error) {
+	rows, err := h.db.Query(`
+		SELECT id, npc_id, kind, content, embedding, created_at
+		FROM memories
+		WHERE unity_id = $1
+		AND (npc_id = $2 OR (npc_id = '' AND kind <> 'event'))
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, unityID, npcID, maxScannedMemories)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to search memories: %w", err)
+	}
+
+	defer rows.Close()
+
+	var memories []types.DBMemory
+	for rows.Next() {
+		memory := types.DBMemory{UnityID: unityID}
+		var stored pq.Float32Array
+		if err := rows.Scan(&memory.ID, &memory.NpcID, &memory.Kind, &memory.Content, &stored, &memory.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		memory.Similarity = ai.CosineSimilarity(embedding, stored)
+		memories = append(memories, memory)
+	}
+
+	sort.SliceStable(memories, func(i, j int) bool {
+		return memories[i].Similarity > memories[j].Similarity
+	})
+
+	if len(memories) > limit {
+		memories = memories[:limit]
+	}
+
+	return memories, nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"rd-backend/internal/types"
+
+	"github.com/lib/pq"
+)
+
+const questColumns = `id, unity_id, npc_id, title, summary, steps, rewards, fail_event_type, state, step, progress, created_at, updated_at`
+
+// CreateQuest stores a new quest and returns its ID
+func (h *DBHandler) CreateQuest(quest types.DBQuest) (int, error) {
+	steps, err := json.Marshal(quest.Steps)
+	if err != nil {
+		return 0, fmt.Errorf("could not encode quest steps: %w", err)
+	}
+	rewards, err := json.Marshal(quest.Rewards)
+	if err != nil {
+		return 0, fmt.Errorf("could not encode quest rewards: %w", err)
+	}
+
+	var id int
+	err = h.db.QueryRow(`
+		INSERT INTO quests (unity_id, npc_id, title, summary, steps, rewards, fail_event_type, state)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`, quest.UnityID, quest.NpcID, quest.Title, quest.Summary, string(steps), string(rewards), quest.FailEventType, quest.State).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("could not create quest: %w", err)
+	}
+
+	return id, nil
+}
+
+// UpdateQuest saves the quest's state and progress
+func (h *DBHandler) UpdateQuest(quest types.DBQuest) error {
+	_, err := h.db.Exec(`
+		UPDATE quests
+		SET state = $1, step = $2, progress = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4
+	`, quest.State, quest.Step, quest.Progress, quest.ID)
+
+	if err != nil {
+		return fmt.Errorf("could not update quest: %w", err)
+	}
+
+	return nil
+}
+
+// GetQuests returns the player's quests, newest first. npcID limits them to one NPC's and
+// states to quests in one of them, both are ignored when empty.
+func (h *DBHandler) GetQuests(unityID string, npcID string, states []string, limit int) ([]types.DBQuest, error) {
+	rows, err := h.db.Query(`
+		SELECT `+questColumns+`
+		FROM quests
+		WHERE unity_id = $1
+			AND ($2 = '' OR npc_id = $2)
+			AND (COALESCE(cardinality($3::text[]), 0) = 0 OR state = ANY($3))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, unityID, npcID, pq.StringArray(states), limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quests: %w", err)
+	}
+
+	defer rows.Close()
+
+	var quests []types.DBQuest
+	for rows.Next() {
+		quest, err := scanQuest(rows)
+		if err != nil {
+			return nil, err
+		}
+		quests = append(quests, *quest)
+	}
+
+	return quests, nil
+}
+
+func scanQuest(rows *sql.Rows) (*types.DBQuest, error) {
+	var quest types.DBQuest
+	var steps, rewards string
+
+	err := rows.Scan(&quest.ID, &quest.UnityID, &quest.NpcID, &quest.Title, &quest.Summary, &steps, &rewards,
+		&quest.FailEventType, &quest.State, &quest.Step, &quest.Progress, &quest.CreatedAt, &quest.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("scan failed: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(steps), &quest.Steps); err != nil {
+		return nil, fmt.Errorf("invalid steps in quest %d: %w", quest.ID, err)
+	}
+	if err := json.Unmarshal([]byte(rewards), &quest.Rewards); err != nil {
+		return nil, fmt.Errorf("invalid rewards in quest %d: %w", quest.ID, err)
+	}
+
+	return &quest, nil
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+// TakeToken takes a token from a rate limit bucket in one statement, so several backend
+// instances can share the bucket
+func (h *DBHandler) TakeToken(key string, capacity float64, perSecond float64) (bool, time.Duration, error) {
+	var tokens float64
+	var allowed bool
+
+	err := h.db.QueryRow(`
+		INSERT INTO rate_limit_buckets (key, tokens, allowed, updated_at)
+		VALUES ($1, $2 - 1, TRUE, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE SET
+			allowed = LEAST($2, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - rate_limit_buckets.updated_at) * $3) >= 1,
+			tokens = LEAST($2, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - rate_limit_buckets.updated_at) * $3)
+				- CASE WHEN LEAST($2, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - rate_limit_buckets.updated_at) * $3) >= 1 THEN 1 ELSE 0 END,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING tokens, allowed
+	`, key, capacity, perSecond).Scan(&tokens, &allowed)
+
+	if err != nil {
+		return false, 0, fmt.Errorf("could not take rate limit token: %w", err)
+	}
+
+	if !allowed {
+		return false, time.Duration((1 - tokens) / perSecond * float64(time.Second)), nil
+	}
+
+	return true, 0, nil
+}
+
+func (h *DBHandler) IncrementDailyCount(key string, day string) (int, error) {
+	var count int
+
+	err := h.db.QueryRow(`
+		INSERT INTO daily_message_counts (key, day, count)
+		VALUES ($1, $2, 1)
+		ON CONFLICT (key, day)
+		DO UPDATE SET count = daily_message_counts.count + 1
+		RETURNING count
+	`, key, day).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("could not count daily message: %w", err)
+	}
+
+	return count, nil
+}
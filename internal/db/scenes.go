@@ -0,0 +1,92 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"rd-backend/internal/types"
+	"strings"
+)
+
+// CreateScene starts a group conversation and returns its ID
+func (h *DBHandler) CreateScene(unityID string, participants []string, location string) (int, error) {
+	var id int
+
+	err := h.db.QueryRow(`
+		INSERT INTO scenes (unity_id, participants, location)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`, unityID, strings.Join(participants, ","), location).Scan(&id)
+
+	if err != nil {
+		return 0, fmt.Errorf("could not create scene: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetScene returns the scene, nil if there is none with that ID
+func (h *DBHandler) GetScene(id int) (*types.DBScene, error) {
+	var scene types.DBScene
+	var participants string
+
+	err := h.db.QueryRow(`
+		SELECT id, unity_id, participants, location, created_at
+		FROM scenes
+		WHERE id = $1
+	`, id).Scan(&scene.ID, &scene.UnityID, &participants, &scene.Location, &scene.CreatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	scene.Participants = strings.Split(participants, ",")
+	return &scene, nil
+}
+
+func (h *DBHandler) AddSceneLine(sceneID int, speaker string, text string) error {
+	_, err := h.db.Exec(`
+		INSERT INTO scene_lines (scene_id, speaker, text)
+		VALUES ($1, $2, $3)
+	`, sceneID, speaker, text)
+
+	if err != nil {
+		return fmt.Errorf("could not add scene line: %w", err)
+	}
+
+	return nil
+}
+
+// GetSceneLines returns the last lines of the scene, oldest first
+func (h *DBHandler) GetSceneLines(sceneID int, limit int) ([]types.DBSceneLine, error) {
+	rows, err := h.db.Query(`
+		SELECT id, scene_id, speaker, text, created_at
+		FROM (
+			SELECT id, scene_id, speaker, text, created_at
+			FROM scene_lines
+			WHERE scene_id = $1
+			ORDER BY id DESC
+			LIMIT $2
+		) recent
+		ORDER BY id
+	`, sceneID, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scene lines: %w", err)
+	}
+
+	defer rows.Close()
+
+	var lines []types.DBSceneLine
+	for rows.Next() {
+		var line types.DBSceneLine
+		if err := rows.Scan(&line.ID, &line.SceneID, &line.Speaker, &line.Text, &line.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
@@ -29,4 +29,163 @@ CREATE TABLE events (
     event_type TEXT NOT NULL,
     event_details TEXT NOT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-)
\ No newline at end of file
+)
+CREATE TABLE conversation_summaries (
+    id SERIAL PRIMARY KEY,
+    unity_id TEXT NOT NULL,
+    npc_id TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    last_message_id INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (unity_id, npc_id)
+)
+
+-- With pgvector installed, declare embedding as vector(<dimensions>) instead and add an index.
+-- The backend checks the column type on startup and searches in Postgres when it can.
+CREATE TABLE memories (
+    id SERIAL PRIMARY KEY,
+    unity_id TEXT NOT NULL,
+    npc_id TEXT NOT NULL DEFAULT '',
+    kind VARCHAR(16) NOT NULL,
+    content TEXT NOT NULL,
+    embedding REAL[] NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+
+CREATE TABLE player_flags (
+    id SERIAL PRIMARY KEY,
+    unity_id TEXT NOT NULL,
+    flag VARCHAR(64) NOT NULL,
+    value VARCHAR(64) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (unity_id, flag)
+)
+
+CREATE TABLE npc_affinity (
+    id SERIAL PRIMARY KEY,
+    unity_id TEXT NOT NULL,
+    npc_id TEXT NOT NULL,
+    affinity INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (unity_id, npc_id)
+)
+
+CREATE TABLE flagged_content (
+    id SERIAL PRIMARY KEY,
+    unity_id TEXT NOT NULL,
+    npc_id TEXT NOT NULL,
+    stage VARCHAR(16) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    category VARCHAR(64) NOT NULL DEFAULT '',
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+
+CREATE INDEX flagged_content_unity_id_created_at ON flagged_content (unity_id, created_at)
+
+-- One row per model call. cost is in USD and NULL when the provider doesn't report it.
+CREATE TABLE ai_usage (
+    id SERIAL PRIMARY KEY,
+    unity_id TEXT NOT NULL DEFAULT '',
+    npc_id TEXT NOT NULL DEFAULT '',
+    model TEXT NOT NULL,
+    call_type VARCHAR(16) NOT NULL,
+    generation_id TEXT NOT NULL DEFAULT '',
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    cost NUMERIC(12, 6),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+
+CREATE INDEX ai_usage_created_at ON ai_usage (created_at)
+
+ALTER TABLE players ADD COLUMN tier VARCHAR(16) NOT NULL DEFAULT 'free'
+
+-- Rate limit state shared by every backend instance, see internal/config/limits.json
+CREATE TABLE rate_limit_buckets (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL DEFAULT TRUE,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+
+CREATE TABLE daily_message_counts (
+    key TEXT NOT NULL,
+    day DATE NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (key, day)
+)
+
+-- How NPC replies were delivered, NULL for player messages
+ALTER TABLE messages ADD COLUMN emotion VARCHAR(16)
+ALTER TABLE messages ADD COLUMN emotion_intensity REAL
+ALTER TABLE messages ADD COLUMN gesture VARCHAR(32)
+
+ALTER TABLE npc_affinity ADD COLUMN stage VARCHAR(16) NOT NULL DEFAULT 'stranger'
+
+CREATE TABLE npc_knowledge (
+    id SERIAL PRIMARY KEY,
+    unity_id TEXT NOT NULL,
+    npc_id TEXT NOT NULL,
+    event_id INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    source_npc_id TEXT NOT NULL DEFAULT '',
+    hops INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (unity_id, npc_id, event_id)
+)
+
+CREATE INDEX npc_knowledge_npc_id_created_at ON npc_knowledge (npc_id, created_at)
+
+ALTER TABLE players ADD COLUMN last_location TEXT NOT NULL DEFAULT ''
+
+CREATE TABLE scenes (
+    id SERIAL PRIMARY KEY,
+    unity_id TEXT NOT NULL,
+    participants TEXT NOT NULL,
+    location TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+
+CREATE TABLE scene_lines (
+    id SERIAL PRIMARY KEY,
+    scene_id INTEGER NOT NULL REFERENCES scenes (id),
+    speaker TEXT NOT NULL,
+    text TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+
+CREATE INDEX scene_lines_scene_id ON scene_lines (scene_id)
+
+-- Texts NPCs started, one row per trigger that fired
+CREATE TABLE text_triggers (
+    id SERIAL PRIMARY KEY,
+    unity_id TEXT NOT NULL,
+    npc_id TEXT NOT NULL,
+    trigger_id VARCHAR(64) NOT NULL,
+    sent_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+
+CREATE INDEX text_triggers_unity_id_npc_id ON text_triggers (unity_id, npc_id, sent_at)
+
+-- steps and rewards are JSON
+CREATE TABLE quests (
+    id SERIAL PRIMARY KEY,
+    unity_id TEXT NOT NULL,
+    npc_id TEXT NOT NULL,
+    title TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    steps TEXT NOT NULL,
+    rewards TEXT NOT NULL,
+    fail_event_type TEXT NOT NULL DEFAULT '',
+    state VARCHAR(16) NOT NULL,
+    step INTEGER NOT NULL DEFAULT 0,
+    progress INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
+
+CREATE INDEX quests_unity_id_state ON quests (unity_id, state)
+
+-- Usage counted here when the provider didn't report any, like a stream cut short
+ALTER TABLE ai_usage ADD COLUMN estimated BOOLEAN NOT NULL DEFAULT FALSE
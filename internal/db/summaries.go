@@ -0,0 +1,97 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"rd-backend/internal/types"
+)
+
+// GetConversationSummary returns the stored summary for a player/NPC pair.
+// A pair that hasn't been summarized yet gets an empty summary, not an error.
+func (h *DBHandler) GetConversationSummary(unityID string, npcID string) (*types.DBConversationSummary, error) {
+	summary := types.DBConversationSummary{
+		UnityID: unityID,
+		NpcID:   npcID,
+	}
+
+	err := h.db.QueryRow(`
+		SELECT id, summary, last_message_id, updated_at
+		FROM conversation_summaries
+		WHERE unity_id = $1 AND npc_id = $2
+	`, unityID, npcID).Scan(&summary.ID, &summary.Summary, &summary.LastMessageID, &summary.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &summary, nil
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &summary, nil
+}
+
+// SaveConversationSummary stores the summary of every message up to and including lastMessageID
+func (h *DBHandler) SaveConversationSummary(unityID string, npcID string, summary string, lastMessageID int) error {
+	_, err := h.db.Exec(`
+		INSERT INTO conversation_summaries (unity_id, npc_id, summary, last_message_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (unity_id, npc_id)
+		DO UPDATE SET summary = EXCLUDED.summary, last_message_id = EXCLUDED.last_message_id, updated_at = CURRENT_TIMESTAMP
+	`, unityID, npcID, summary, lastMessageID)
+
+	if err != nil {
+		return fmt.Errorf("could not save conversation summary: %w", err)
+	}
+
+	return nil
+}
+
+// GetMessagesWithNPCAfter returns the oldest messages between a player and an NPC with an ID
+// greater than afterID, oldest first
+func (h *DBHandler) GetMessagesWithNPCAfter(unityID string, npcID string, afterID int, limit int) ([]types.DBChatMessage, error) {
+	rows, err := h.db.Query(`
+		SELECT id, message, sender, sent_to, created_at
+		FROM messages
+		WHERE unity_id = $1
+		AND (sender = $2 OR sent_to = $2)
+		AND id > $3
+		ORDER BY id ASC
+		LIMIT $4
+	`, unityID, npcID, afterID, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	defer rows.Close()
+
+	var messages []types.DBChatMessage
+	for rows.Next() {
+		var msg types.DBChatMessage
+		if err := rows.Scan(&msg.ID, &msg.MessageText, &msg.Sender, &msg.SentTo, &msg.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+// CountMessagesWithNPCAfter counts the messages between a player and an NPC with an ID greater than afterID
+func (h *DBHandler) CountMessagesWithNPCAfter(unityID string, npcID string, afterID int) (int, error) {
+	var count int
+
+	err := h.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM messages
+		WHERE unity_id = $1
+		AND (sender = $2 OR sent_to = $2)
+		AND id > $3
+	`, unityID, npcID, afterID).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"rd-backend/internal/types"
+	"time"
+)
+
+// GetTextablePlayers returns every player with a phone number
+func (h *DBHandler) GetTextablePlayers() ([]types.Player, error) {
+	rows, err := h.db.Query(`
+		SELECT id, unity_id, phone_number, tier
+		FROM players
+		WHERE phone_number IS NOT NULL AND phone_number <> ''
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get players: %w", err)
+	}
+
+	defer rows.Close()
+
+	var players []types.Player
+	for rows.Next() {
+		var player types.Player
+		if err := rows.Scan(&player.ID, &player.UnityID, &player.PhoneNumber, &player.Tier); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		players = append(players, player)
+	}
+
+	return players, nil
+}
+
+// AddTextTrigger records that the NPC texted the player because of a trigger
+func (h *DBHandler) AddTextTrigger(unityID string, npcID string, triggerID string) error {
+	_, err := h.db.Exec(`
+		INSERT INTO text_triggers (unity_id, npc_id, trigger_id)
+		VALUES ($1, $2, $3)
+	`, unityID, npcID, triggerID)
+
+	if err != nil {
+		return fmt.Errorf("could not add text trigger: %w", err)
+	}
+
+	return nil
+}
+
+// GetTextTrigger returns how many times the trigger fired for the player and when it last did,
+// the zero time if it never has
+func (h *DBHandler) GetTextTrigger(unityID string, npcID string, triggerID string) (int, time.Time, error) {
+	var count int
+	var last sql.NullTime
+
+	err := h.db.QueryRow(`
+		SELECT COUNT(*), MAX(sent_at)
+		FROM text_triggers
+		WHERE unity_id = $1 AND npc_id = $2 AND trigger_id = $3
+	`, unityID, npcID, triggerID).Scan(&count, &last)
+
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to get text trigger: %w", err)
+	}
+
+	return count, last.Time, nil
+}
+
+// CountTextTriggers returns how many texts the NPC started with the player since since,
+// every NPC's when npcID is empty
+func (h *DBHandler) CountTextTriggers(unityID string, npcID string, since time.Time) (int, error) {
+	var count int
+
+	err := h.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM text_triggers
+		WHERE unity_id = $1 AND ($2 = '' OR npc_id = $2) AND sent_at >= $3
+	`, unityID, npcID, since).Scan(&count)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count text triggers: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetLastActivity returns when the player last chatted, texted an NPC or had an event,
+// the zero time if they never have
+func (h *DBHandler) GetLastActivity(unityID string) (time.Time, error) {
+	var last sql.NullTime
+
+	err := h.db.QueryRow(`
+		SELECT GREATEST(
+			(SELECT MAX(created_at) FROM messages WHERE unity_id = $1),
+			(SELECT MAX(created_at) FROM texts WHERE unity_id = $1 AND sender_number = player_number),
+			(SELECT MAX(created_at) FROM events WHERE unity_id = $1)
+		)
+	`, unityID).Scan(&last)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get last activity: %w", err)
+	}
+
+	return last.Time, nil
+}
+
+// GetLatestEvent returns the player's most recent event of eventType, nil if there isn't one
+func (h *DBHandler) GetLatestEvent(unityID string, eventType string) (*types.DBPlayerEvent, error) {
+	var event types.DBPlayerEvent
+
+	err := h.db.QueryRow(`
+		SELECT unity_id, event_type, event_details, created_at
+		FROM events
+		WHERE unity_id = $1 AND event_type = $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, unityID, eventType).Scan(&event.UnityID, &event.EventType, &event.EventDetails, &event.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+
+	return &event, nil
+}
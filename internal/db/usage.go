@@ -0,0 +1,65 @@
+package db
+
+import (
+	"fmt"
+	"rd-backend/internal/types"
+	"time"
+)
+
+func (h *DBHandler) AddUsage(usage types.DBUsage) error {
+	_, err := h.db.Exec(`
+		INSERT INTO ai_usage (unity_id, npc_id, model, call_type, generation_id, prompt_tokens, completion_tokens, cost, estimated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, usage.UnityID, usage.NpcID, usage.Model, usage.CallType, usage.GenerationID, usage.PromptTokens, usage.CompletionTokens, usage.Cost, usage.Estimated)
+
+	if err != nil {
+		return fmt.Errorf("could not add usage: %w", err)
+	}
+
+	return nil
+}
+
+// GetDailyUsageByNPC totals usage per day and NPC since the given time, newest day first.
+// Calls that don't belong to an NPC are under an empty key.
+func (h *DBHandler) GetDailyUsageByNPC(since time.Time) ([]types.UsageTotal, error) {
+	return h.getDailyUsage("npc_id", `created_at >= $1`, since)
+}
+
+// GetDailyUsageByModel totals usage per day and model since the given time, newest day first
+func (h *DBHandler) GetDailyUsageByModel(since time.Time) ([]types.UsageTotal, error) {
+	return h.getDailyUsage("model", `created_at >= $1`, since)
+}
+
+// GetPlayerUsage totals a player's usage per day and NPC since the given time, newest day first
+func (h *DBHandler) GetPlayerUsage(unityID string, since time.Time) ([]types.UsageTotal, error) {
+	return h.getDailyUsage("npc_id", `created_at >= $1 AND unity_id = $2`, since, unityID)
+}
+
+// getDailyUsage groups by column, which must be one of our own column names, never user input
+func (h *DBHandler) getDailyUsage(column string, where string, args ...any) ([]types.UsageTotal, error) {
+	rows, err := h.db.Query(`
+		SELECT TO_CHAR(DATE(created_at), 'YYYY-MM-DD') AS day, `+column+`, COUNT(*),
+			SUM(prompt_tokens), SUM(completion_tokens), COALESCE(SUM(cost), 0), COUNT(*) FILTER (WHERE estimated)
+		FROM ai_usage
+		WHERE `+where+`
+		GROUP BY day, `+column+`
+		ORDER BY day DESC, 6 DESC
+	`, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	defer rows.Close()
+
+	totals := []types.UsageTotal{}
+	for rows.Next() {
+		var total types.UsageTotal
+		if err := rows.Scan(&total.Day, &total.Key, &total.Calls, &total.PromptTokens, &total.CompletionTokens, &total.Cost, &total.EstimatedCalls); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		totals = append(totals, total)
+	}
+
+	return totals, nil
+}
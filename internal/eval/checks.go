@@ -0,0 +1,59 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// mentions is whether text has one of words, each matched at the start of a word so
+// "rain" also finds "raining"
+func mentions(text string, words []string) (string, bool) {
+	for _, word := range words {
+		pattern := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(strings.TrimSpace(word)))
+		if pattern.MatchString(text) {
+			return word, true
+		}
+	}
+	return "", false
+}
+
+// apply runs the checks on a reply, returning how many there were and what failed
+func (c Checks) apply(reply string) (int, []string) {
+	var total int
+	var failures []string
+
+	if len(c.Banned) > 0 {
+		total++
+		lower := strings.ToLower(reply)
+		for _, phrase := range c.Banned {
+			if strings.Contains(lower, strings.ToLower(phrase)) {
+				failures = append(failures, fmt.Sprintf("says banned phrase %q", phrase))
+				break
+			}
+		}
+	}
+
+	words := len(strings.Fields(reply))
+	if c.MinWords > 0 {
+		total++
+		if words < c.MinWords {
+			failures = append(failures, fmt.Sprintf("%d words, expected at least %d", words, c.MinWords))
+		}
+	}
+	if c.MaxWords > 0 {
+		total++
+		if words > c.MaxWords {
+			failures = append(failures, fmt.Sprintf("%d words, expected at most %d", words, c.MaxWords))
+		}
+	}
+
+	if len(c.MentionAny) > 0 {
+		total++
+		if _, found := mentions(reply, c.MentionAny); !found {
+			failures = append(failures, fmt.Sprintf("mentions none of %s", strings.Join(c.MentionAny, ", ")))
+		}
+	}
+
+	return total, failures
+}
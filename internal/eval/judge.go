@@ -0,0 +1,39 @@
+package eval
+
+import (
+	"fmt"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/types"
+	"strings"
+)
+
+// Judgement is how in character a model found an NPC's replies, from 1 to 5
+type Judgement struct {
+	Score  int    `json:"score" jsonschema:"minimum=1,maximum=5,description=5 when every reply sounds exactly like the character"`
+	Reason string `json:"reason" jsonschema:"maxLength=300"`
+}
+
+// Judge rates conversations for how well the NPC stayed in character
+type Judge struct {
+	aiHandler *ai.AIHandler
+}
+
+func NewJudge(aiHandler *ai.AIHandler) *Judge {
+	return &Judge{
+		aiHandler: aiHandler,
+	}
+}
+
+func (j *Judge) Rate(npcPersonality types.NPC, transcript []string) (*Judgement, error) {
+	return ai.CompleteJSONAs[Judgement](j.aiHandler, ai.UsageKey{NpcID: npcPersonality.ID, CallType: ai.CallEval}, ai.JSONRequest{
+		Name: "persona_judgement",
+		Instructions: fmt.Sprintf(
+			"You review dialogue for a life-sim game. Rate how consistently %s stays in character in this conversation "+
+				"with the player, from 1 (could be anyone, or breaks character) to 5 (unmistakably them). "+
+				"%s is a %s. Traits: %s. Quirks: %s. Speech style: %s",
+			npcPersonality.Name, npcPersonality.Name, npcPersonality.Occupation,
+			strings.Join(npcPersonality.Traits, ", "), strings.Join(npcPersonality.Quirks, "; "), npcPersonality.SpeechStyle,
+		),
+		Input: strings.Join(transcript, "\n"),
+	})
+}
@@ -0,0 +1,245 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"time"
+)
+
+// Report is the outcome of one run of a suite. Reports are saved as JSON so later runs can
+// be compared against them.
+type Report struct {
+	Suite         string    `json:"suite"`
+	StartedAt     time.Time `json:"started_at"`
+	Provider      string    `json:"provider"`
+	PromptVersion string    `json:"prompt_version"`
+	Judged        bool      `json:"judged"`
+	Summary       Summary   `json:"summary"`
+	// NPCs is the summary of each NPC's conversations
+	NPCs          map[string]Summary   `json:"npcs"`
+	Conversations []ConversationResult `json:"conversations"`
+	// Baseline is set when the run was compared against an earlier one
+	Baseline *Comparison `json:"baseline,omitempty"`
+}
+
+// Summary adds up checks. Score is the share of checks passed and JudgeScore the average
+// judgement, 0 when nothing was judged.
+type Summary struct {
+	Checks     int     `json:"checks"`
+	Passed     int     `json:"passed"`
+	Score      float64 `json:"score"`
+	JudgeScore float64 `json:"judge_score,omitempty"`
+	judged     int
+}
+
+type ConversationResult struct {
+	ID            string       `json:"id"`
+	NPC           string       `json:"npc"`
+	Turns         []TurnResult `json:"turns"`
+	QuirkFailures []string     `json:"quirk_failures,omitempty"`
+	Checks        int          `json:"checks"`
+	Passed        int          `json:"passed"`
+	Judgement     *Judgement   `json:"judgement,omitempty"`
+	// Error is set when the NPC didn't reply and the conversation stopped early
+	Error string `json:"error,omitempty"`
+}
+
+type TurnResult struct {
+	Player   string   `json:"player"`
+	Reply    string   `json:"reply"`
+	Checks   int      `json:"checks"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+// Comparison is how a run did against the baseline run. Regressions are turns that passed
+// before and fail now, Fixes the other way around.
+type Comparison struct {
+	StartedAt   time.Time          `json:"started_at"`
+	ScoreDelta  float64            `json:"score_delta"`
+	JudgeDelta  float64            `json:"judge_delta,omitempty"`
+	NPCDeltas   map[string]float64 `json:"npc_deltas"`
+	Regressions []string           `json:"regressions,omitempty"`
+	Fixes       []string           `json:"fixes,omitempty"`
+}
+
+func (s *Summary) add(result ConversationResult) {
+	s.Checks += result.Checks
+	s.Passed += result.Passed
+	if s.Checks > 0 {
+		s.Score = float64(s.Passed) / float64(s.Checks)
+	}
+
+	if result.Judgement != nil {
+		s.JudgeScore = (s.JudgeScore*float64(s.judged) + float64(result.Judgement.Score)) / float64(s.judged+1)
+		s.judged++
+	}
+}
+
+func (r *Report) summarize() {
+	r.Summary = Summary{}
+	r.NPCs = make(map[string]Summary)
+
+	for _, result := range r.Conversations {
+		r.Summary.add(result)
+
+		npcSummary := r.NPCs[result.NPC]
+		npcSummary.add(result)
+		r.NPCs[result.NPC] = npcSummary
+	}
+}
+
+// Compare records how the run did against baseline
+func (r *Report) Compare(baseline *Report) {
+	comparison := &Comparison{
+		StartedAt:  baseline.StartedAt,
+		ScoreDelta: r.Summary.Score - baseline.Summary.Score,
+		NPCDeltas:  make(map[string]float64),
+	}
+	if r.Judged && baseline.Judged {
+		comparison.JudgeDelta = r.Summary.JudgeScore - baseline.Summary.JudgeScore
+	}
+	for id, summary := range r.NPCs {
+		if before, exists := baseline.NPCs[id]; exists {
+			comparison.NPCDeltas[id] = summary.Score - before.Score
+		}
+	}
+
+	before := make(map[string]bool)
+	for _, result := range baseline.Conversations {
+		for i, turn := range result.Turns {
+			before[turnKey(result.ID, i)] = len(turn.Failures) == 0
+		}
+	}
+	for _, result := range r.Conversations {
+		for i, turn := range result.Turns {
+			key := turnKey(result.ID, i)
+			passedBefore, exists := before[key]
+			if !exists {
+				continue
+			}
+
+			passed := len(turn.Failures) == 0
+			if passedBefore && !passed {
+				comparison.Regressions = append(comparison.Regressions, key)
+			}
+			if !passedBefore && passed {
+				comparison.Fixes = append(comparison.Fixes, key)
+			}
+		}
+	}
+
+	r.Baseline = comparison
+}
+
+func turnKey(conversationID string, turn int) string {
+	return fmt.Sprintf("%s#%d", conversationID, turn+1)
+}
+
+// LoadReport reads a report saved by WriteJSON
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+func (r *Report) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (r *Report) WriteHTML(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ids := make([]string, 0, len(r.NPCs))
+	for id := range r.NPCs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return reportTemplate.Execute(file, struct {
+		*Report
+		NPCIds []string
+	}{r, ids})
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(score float64) string { return fmt.Sprintf("%.1f%%", score*100) },
+	"delta":   func(delta float64) string { return fmt.Sprintf("%+.1f", delta*100) },
+	"inc":     func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Suite}} eval, {{.StartedAt.Format "2006-01-02 15:04"}}</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 4px 10px; text-align: left; vertical-align: top; }
+.fail { color: #b00020; }
+.pass { color: #1b7f3b; }
+.reply { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.Suite}}</h1>
+<p>Run {{.StartedAt.Format "2006-01-02 15:04:05"}} with {{.Provider}}, prompts {{.PromptVersion}}.
+{{with .Baseline}}Compared against the run of {{.StartedAt.Format "2006-01-02 15:04:05"}}.{{end}}</p>
+
+<table>
+<tr><th>NPC</th><th>Checks passed</th><th>Score</th>{{if .Judged}}<th>Judge</th>{{end}}{{if .Baseline}}<th>Change</th>{{end}}</tr>
+{{- range .NPCIds}}
+{{- $id := .}}
+{{- $summary := index $.NPCs $id}}
+<tr><td>{{$id}}</td><td>{{$summary.Passed}} / {{$summary.Checks}}</td><td>{{percent $summary.Score}}</td>
+{{- if $.Judged}}<td>{{printf "%.2f" $summary.JudgeScore}}</td>{{end}}
+{{- with $.Baseline}}<td>{{delta (index .NPCDeltas $id)}}</td>{{end}}</tr>
+{{- end}}
+<tr><th>All</th><th>{{.Summary.Passed}} / {{.Summary.Checks}}</th><th>{{percent .Summary.Score}}</th>
+{{- if .Judged}}<th>{{printf "%.2f" .Summary.JudgeScore}}</th>{{end}}
+{{- with .Baseline}}<th>{{delta .ScoreDelta}}</th>{{end}}</tr>
+</table>
+
+{{- with .Baseline}}
+{{- if .Regressions}}
+<h2 class="fail">Regressions</h2>
+<ul>{{range .Regressions}}<li>{{.}}</li>{{end}}</ul>
+{{- end}}
+{{- if .Fixes}}
+<h2 class="pass">Fixed</h2>
+<ul>{{range .Fixes}}<li>{{.}}</li>{{end}}</ul>
+{{- end}}
+{{- end}}
+
+{{- range .Conversations}}
+<h2>{{.ID}} <small>with {{.NPC}}, {{.Passed}} / {{.Checks}}</small></h2>
+{{- with .Error}}<p class="fail">{{.}}</p>{{end}}
+{{- with .Judgement}}<p>Judge: {{.Score}} / 5. {{.Reason}}</p>{{end}}
+<table>
+<tr><th>#</th><th>Player</th><th>Reply</th><th>Checks</th></tr>
+{{- range $i, $turn := .Turns}}
+<tr><td>{{inc $i}}</td><td>{{$turn.Player}}</td><td class="reply">{{$turn.Reply}}</td>
+<td>{{if $turn.Failures}}{{range $turn.Failures}}<div class="fail">{{.}}</div>{{end}}{{else}}<span class="pass">{{$turn.Checks}} passed</span>{{end}}</td></tr>
+{{- end}}
+</table>
+{{- range .QuirkFailures}}<p class="fail">{{.}}</p>{{end}}
+{{- end}}
+</body>
+</html>
+`))
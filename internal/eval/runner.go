@@ -0,0 +1,114 @@
+package eval
+
+import (
+	"fmt"
+	"log"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/types"
+	"time"
+)
+
+// Runner plays a suite's conversations through the AI handler and scores the replies
+type Runner struct {
+	aiHandler *ai.AIHandler
+	npcs      *npc.NPCs
+	// judge is nil when only the rule checks are used
+	judge *Judge
+}
+
+func NewRunner(aiHandler *ai.AIHandler, npcs *npc.NPCs, judge *Judge) *Runner {
+	return &Runner{
+		aiHandler: aiHandler,
+		npcs:      npcs,
+		judge:     judge,
+	}
+}
+
+// Run plays every conversation in order, each from a blank history
+func (r *Runner) Run(suite *Suite) *Report {
+	report := &Report{
+		Suite:     suite.Name,
+		StartedAt: time.Now(),
+		Judged:    r.judge != nil,
+	}
+
+	for _, conversation := range suite.Conversations {
+		log.Printf("Running %s with %s", conversation.ID, conversation.NPC)
+		report.Conversations = append(report.Conversations, r.play(suite, conversation))
+	}
+
+	report.summarize()
+	return report
+}
+
+func (r *Runner) play(suite *Suite, conversation Conversation) ConversationResult {
+	npcPersonality := (*r.npcs)[conversation.NPC]
+	npcChecks := suite.NPCs[conversation.NPC]
+	result := ConversationResult{
+		ID:  conversation.ID,
+		NPC: conversation.NPC,
+	}
+
+	unityID := "eval-" + conversation.ID
+	var history []types.DBChatMessage
+	var transcript []string
+
+	for _, turn := range conversation.Turns {
+		input := r.aiHandler.ScreenInput(unityID, conversation.NPC, turn.Player)
+		completion, err := r.aiHandler.GetChatCompletion(unityID, input, history, nil, "", "user", conversation.NPC, 0)
+		if err != nil {
+			result.Error = fmt.Sprintf("no reply to %q: %v", turn.Player, err)
+			result.Checks++
+			break
+		}
+
+		checks := suite.Defaults.merge(npcChecks.Checks).merge(turn.Expect)
+		total, failures := checks.apply(completion.Completion)
+		result.Turns = append(result.Turns, TurnResult{
+			Player:   turn.Player,
+			Reply:    completion.Completion,
+			Checks:   total,
+			Failures: failures,
+		})
+		result.Checks += total
+		result.Passed += total - len(failures)
+
+		// Newest first, the way the database would return it, which doesn't keep blocked messages
+		if !input.Blocked() {
+			history = append([]types.DBChatMessage{
+				{MessageText: completion.Completion, Sender: conversation.NPC, SentTo: "player"},
+				{MessageText: input.Text, Sender: "player", SentTo: conversation.NPC},
+			}, history...)
+		}
+		transcript = append(transcript, "Player: "+turn.Player, npcPersonality.Name+": "+completion.Completion)
+	}
+
+	for _, name := range npcChecks.quirkNames() {
+		result.Checks++
+		if r.mentionedAnywhere(result.Turns, npcChecks.Quirks[name]) {
+			result.Passed++
+		} else {
+			result.QuirkFailures = append(result.QuirkFailures, fmt.Sprintf("never showed quirk %q", name))
+		}
+	}
+
+	if r.judge != nil && len(transcript) > 0 {
+		judgement, err := r.judge.Rate(npcPersonality, transcript)
+		if err != nil {
+			log.Printf("Could not judge %s: %v", conversation.ID, err)
+		}
+		result.Judgement = judgement
+	}
+
+	return result
+}
+
+func (r *Runner) mentionedAnywhere(turns []TurnResult, words []string) bool {
+	for _, turn := range turns {
+		if _, found := mentions(turn.Reply, words); found {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package eval
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"rd-backend/internal/ai/npc"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Checks are rules a reply has to follow. Words are matched ignoring case.
+type Checks struct {
+	// Banned phrases must not appear, like the NPC admitting to be an AI
+	Banned   []string `yaml:"banned"`
+	MinWords int      `yaml:"min_words"`
+	MaxWords int      `yaml:"max_words"`
+	// MentionAny has the reply say at least one of the words
+	MentionAny []string `yaml:"mention_any"`
+}
+
+// merge adds other's rules to c. Banned phrases add up, other's limits win where set.
+func (c Checks) merge(other Checks) Checks {
+	merged := Checks{
+		Banned:     append(append([]string(nil), c.Banned...), other.Banned...),
+		MinWords:   c.MinWords,
+		MaxWords:   c.MaxWords,
+		MentionAny: c.MentionAny,
+	}
+	if other.MinWords > 0 {
+		merged.MinWords = other.MinWords
+	}
+	if other.MaxWords > 0 {
+		merged.MaxWords = other.MaxWords
+	}
+	if len(other.MentionAny) > 0 {
+		merged.MentionAny = other.MentionAny
+	}
+	return merged
+}
+
+// NPCChecks apply to every reply of one NPC. Quirks are what makes the NPC themselves, each
+// has to come up in every conversation with them, through any of its words.
+type NPCChecks struct {
+	Checks `yaml:",inline"`
+	Quirks map[string][]string `yaml:"quirks"`
+}
+
+// Turn is one line the player says. Fake is the reply the fake provider plays back for it.
+type Turn struct {
+	Player string `yaml:"player"`
+	Expect Checks `yaml:"expect"`
+	Fake   string `yaml:"fake"`
+}
+
+// Conversation is a scripted conversation with one NPC, starting from nothing
+type Conversation struct {
+	ID    string `yaml:"id"`
+	NPC   string `yaml:"npc"`
+	Turns []Turn `yaml:"turns"`
+}
+
+// Suite is a set of conversations and the checks their replies are scored with
+type Suite struct {
+	Name string `yaml:"name"`
+	// Defaults apply to every reply
+	Defaults      Checks               `yaml:"defaults"`
+	NPCs          map[string]NPCChecks `yaml:"npcs"`
+	Conversations []Conversation       `yaml:"conversations"`
+}
+
+// Load reads a suite from a YAML file, or every .yaml and .yml file in a directory as one suite
+func Load(path string) (*Suite, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return loadFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	suite := &Suite{
+		Name: filepath.Base(path),
+		NPCs: make(map[string]NPCChecks),
+	}
+	var names []string
+	for _, entry := range entries {
+		extension := filepath.Ext(entry.Name())
+		if entry.IsDir() || (extension != ".yaml" && extension != ".yml") {
+			continue
+		}
+
+		file, err := loadFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, file.Name)
+
+		suite.Defaults = suite.Defaults.merge(file.Defaults)
+		for id, checks := range file.NPCs {
+			if _, exists := suite.NPCs[id]; exists {
+				return nil, fmt.Errorf("%s: checks for %s are already set in another file", entry.Name(), id)
+			}
+			suite.NPCs[id] = checks
+		}
+		suite.Conversations = append(suite.Conversations, file.Conversations...)
+	}
+	if len(names) == 1 {
+		suite.Name = names[0]
+	}
+
+	return suite, nil
+}
+
+func loadFile(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var suite Suite
+	if err := yaml.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if suite.Name == "" {
+		suite.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return &suite, nil
+}
+
+// Check makes sure every conversation has an ID of its own, an NPC that exists and something
+// to say
+func (s *Suite) Check(npcs npc.NPCs) error {
+	ids := make(map[string]bool)
+	for i, conversation := range s.Conversations {
+		if conversation.ID == "" {
+			return fmt.Errorf("conversation %d has no id", i)
+		}
+		if ids[conversation.ID] {
+			return fmt.Errorf("conversation id %s is used twice", conversation.ID)
+		}
+		ids[conversation.ID] = true
+
+		if _, exists := npcs[conversation.NPC]; !exists {
+			return fmt.Errorf("conversation %s is with unknown NPC %q", conversation.ID, conversation.NPC)
+		}
+		if len(conversation.Turns) == 0 {
+			return fmt.Errorf("conversation %s has no turns", conversation.ID)
+		}
+		for j, turn := range conversation.Turns {
+			if strings.TrimSpace(turn.Player) == "" {
+				return fmt.Errorf("turn %d of conversation %s has no player line", j, conversation.ID)
+			}
+		}
+	}
+
+	for id := range s.NPCs {
+		if _, exists := npcs[id]; !exists {
+			return fmt.Errorf("checks for unknown NPC %s", id)
+		}
+	}
+	return nil
+}
+
+// FakeReplies are the turns' fake replies in the order the conversations run
+func (s *Suite) FakeReplies() []string {
+	var replies []string
+	for _, conversation := range s.Conversations {
+		for _, turn := range conversation.Turns {
+			replies = append(replies, turn.Fake)
+		}
+	}
+	return replies
+}
+
+// quirkNames are the NPC's quirks in a stable order
+func (c NPCChecks) quirkNames() []string {
+	names := make([]string, 0, len(c.Quirks))
+	for name := range c.Quirks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,210 @@
+package events
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"rd-backend/internal/ai"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// cacheSize is how many descriptions are kept, events repeat a lot (same door, same shop)
+const cacheSize = 2048
+
+// Funcs are the helpers available in event templates
+var Funcs = template.FuncMap{
+	"lower": func(value any) string {
+		return strings.ToLower(fmt.Sprint(value))
+	},
+	// join .items ", "
+	"join": func(items []any, sep string) string {
+		parts := make([]string, len(items))
+		for i, item := range items {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	},
+	// default "somewhere" .location
+	"default": func(fallback any, value any) any {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// Registry turns Unity events into the one-line descriptions NPCs see. Event types with a
+// template are described without a model call; unknown types, or events their template
+// can't render, fall back to the LLM. Descriptions are cached by payload.
+type Registry struct {
+	aiHandler *ai.AIHandler
+	templates map[string]*template.Template
+
+	mu      sync.Mutex
+	cache   map[string]*list.Element
+	recency *list.List
+}
+
+type cacheEntry struct {
+	key         string
+	description string
+}
+
+// LoadTemplates reads a JSON object of event_type to template source
+func LoadTemplates(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates map[string]string
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func NewRegistry(templates map[string]string, aiHandler *ai.AIHandler) (*Registry, error) {
+	registry := &Registry{
+		aiHandler: aiHandler,
+		templates: make(map[string]*template.Template),
+		cache:     make(map[string]*list.Element),
+		recency:   list.New(),
+	}
+
+	for eventType, text := range templates {
+		if err := registry.Register(eventType, text); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// Register sets the template for eventType. Templates see the event's JSON fields,
+// e.g. "The player bought {{.item}}{{with .price}} for {{.}} coins{{end}}."
+func (r *Registry) Register(eventType string, text string) error {
+	tmpl, err := template.New(eventType).Funcs(Funcs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid template for %s events: %w", eventType, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.templates[eventType] = tmpl
+	return nil
+}
+
+// Describe returns a sentence describing what the player did
+func (r *Registry) Describe(unityID string, eventType string, details string) (string, error) {
+	key := cacheKey(eventType, details)
+	if description, cached := r.cached(key); cached {
+		return description, nil
+	}
+
+	description, ok := r.render(eventType, details)
+	if !ok {
+		completion, err := r.aiHandler.GetDescriptionCompletion(unityID, details)
+		if err != nil {
+			return "", err
+		}
+		description = *completion
+	}
+
+	r.store(key, description)
+	return description, nil
+}
+
+// DescribeWithoutModel is Describe for players over their limits: the template or a cached
+// description when there is one, otherwise the raw payload rather than a model call
+func (r *Registry) DescribeWithoutModel(eventType string, details string) string {
+	if description, cached := r.cached(cacheKey(eventType, details)); cached {
+		return description
+	}
+	if description, ok := r.render(eventType, details); ok {
+		return description
+	}
+	return details
+}
+
+// render fills in eventType's template, reporting false when there is none or it doesn't fit the payload
+func (r *Registry) render(eventType string, details string) (string, bool) {
+	r.mu.Lock()
+	tmpl, exists := r.templates[eventType]
+	r.mu.Unlock()
+	if !exists {
+		return "", false
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(details), &fields); err != nil {
+		log.Printf("Event %s isn't a JSON object, describing it with the model: %v", eventType, err)
+		return "", false
+	}
+
+	// Missing fields are allowed so templates can use {{with .field}} for optional ones, but a
+	// missing field that gets printed means the payload isn't what the template expects
+	var description strings.Builder
+	if err := tmpl.Execute(&description, fields); err != nil {
+		log.Printf("Template for %s events failed, describing it with the model: %v", eventType, err)
+		return "", false
+	}
+	if strings.Contains(description.String(), "<no value>") {
+		log.Printf("Event %s is missing fields its template needs, describing it with the model", eventType)
+		return "", false
+	}
+
+	return strings.TrimSpace(description.String()), true
+}
+
+// cacheKey hashes the event so payloads that differ only in whitespace share an entry
+func cacheKey(eventType string, details string) string {
+	payload := []byte(details)
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, payload); err == nil {
+		payload = compacted.Bytes()
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(eventType))
+	hash.Write([]byte{0})
+	hash.Write(payload)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (r *Registry) cached(key string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, exists := r.cache[key]
+	if !exists {
+		return "", false
+	}
+	r.recency.MoveToFront(element)
+	return element.Value.(*cacheEntry).description, true
+}
+
+func (r *Registry) store(key string, description string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if element, exists := r.cache[key]; exists {
+		r.recency.MoveToFront(element)
+		return
+	}
+
+	r.cache[key] = r.recency.PushFront(&cacheEntry{key: key, description: description})
+
+	if r.recency.Len() > cacheSize {
+		oldest := r.recency.Back()
+		r.recency.Remove(oldest)
+		delete(r.cache, oldest.Value.(*cacheEntry).key)
+	}
+}
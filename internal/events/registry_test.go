@@ -0,0 +1,153 @@
+package events
+
+import (
+	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/npc"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	registry, err := NewRegistry(map[string]string{
+		"purchase": "The player bought {{.item}}{{with .price}} for {{.}} coins{{end}}.",
+		"travel":   "The player walked to {{default \"somewhere\" .location | lower}}.",
+		"gift":     "The player gave {{join .items \", \"}} to {{.npc}}.",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		eventType string
+		details   string
+		want      string
+		ok        bool
+	}{
+		{"all fields", "purchase", `{"item": "bread", "price": 3}`, "The player bought bread for 3 coins.", true},
+		{"optional field missing", "purchase", `{"item": "bread"}`, "The player bought bread.", true},
+		{"printed field missing", "purchase", `{"price": 3}`, "", false},
+		{"default and lower", "travel", `{"location": "The DOCKS"}`, "The player walked to the docks.", true},
+		{"default used", "travel", `{}`, "The player walked to somewhere.", true},
+		{"join", "gift", `{"items": ["a rose", "a letter"], "npc": "Bea"}`, "The player gave a rose, a letter to Bea.", true},
+		{"join on the wrong type", "gift", `{"items": "a rose", "npc": "Bea"}`, "", false},
+		{"not a JSON object", "purchase", `bought bread`, "", false},
+		{"no template", "dance", `{"style": "waltz"}`, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := registry.render(test.eventType, test.details)
+			if ok != test.ok || got != test.want {
+				t.Errorf("render = %q, %v, want %q, %v", got, ok, test.want, test.ok)
+			}
+		})
+	}
+}
+
+func TestRegisterRejectsBadTemplates(t *testing.T) {
+	if _, err := NewRegistry(map[string]string{"purchase": "{{.item"}, nil); err == nil {
+		t.Error("expected a template that doesn't parse to be rejected")
+	}
+}
+
+func TestDescribeCachesModelDescriptions(t *testing.T) {
+	provider := ai.NewFakeProvider("The player danced a waltz.")
+	aiHandler := ai.NewAIHandler(provider, &npc.NPCs{}, &npc.NPCNumbers{})
+
+	registry, err := NewRegistry(map[string]string{"purchase": "The player bought {{.item}}."}, aiHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		eventType string
+		details   string
+		want      string
+		calls     int
+	}{
+		{"template needs no model", "purchase", `{"item": "bread"}`, "The player bought bread.", 0},
+		{"unknown type asks the model", "dance", `{"style": "waltz"}`, "The player danced a waltz.", 1},
+		{"same payload is cached", "dance", `{"style": "waltz"}`, "The player danced a waltz.", 1},
+		{"whitespace doesn't matter", "dance", "{ \"style\" :\n\"waltz\" }", "The player danced a waltz.", 1},
+		{"other payloads aren't", "dance", `{"style": "tango"}`, "The player danced a waltz.", 2},
+		{"same payload of another type isn't", "spin", `{"style": "waltz"}`, "The player danced a waltz.", 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := registry.Describe("player", test.eventType, test.details)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("description = %q, want %q", got, test.want)
+			}
+			if calls := len(provider.Requests()); calls != test.calls {
+				t.Errorf("model calls = %d, want %d", calls, test.calls)
+			}
+		})
+	}
+}
+
+func TestDescribeWithoutModel(t *testing.T) {
+	provider := ai.NewFakeProvider("The player danced a waltz.")
+	aiHandler := ai.NewAIHandler(provider, &npc.NPCs{}, &npc.NPCNumbers{})
+
+	registry, err := NewRegistry(map[string]string{"purchase": "The player bought {{.item}}."}, aiHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Describe("player", "dance", `{"style": "waltz"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		eventType string
+		details   string
+		want      string
+	}{
+		{"template", "purchase", `{"item": "bread"}`, "The player bought bread."},
+		{"cached", "dance", `{"style": "waltz"}`, "The player danced a waltz."},
+		{"raw JSON otherwise", "dance", `{"style": "tango"}`, `{"style": "tango"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := registry.DescribeWithoutModel(test.eventType, test.details); got != test.want {
+				t.Errorf("description = %q, want %q", got, test.want)
+			}
+		})
+	}
+	if calls := len(provider.Requests()); calls != 1 {
+		t.Errorf("model calls = %d, want only the one Describe made", calls)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	registry, err := NewRegistry(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry.store("first", "a")
+	registry.store("second", "b")
+	for i := range cacheSize - 2 {
+		registry.store(cacheKey("filler", string(rune(i))), "c")
+	}
+
+	// Using the first entry keeps it, so the second is the oldest
+	registry.cached("first")
+	registry.store("one too many", "d")
+
+	if _, ok := registry.cached("first"); !ok {
+		t.Error("the recently used entry was evicted")
+	}
+	if _, ok := registry.cached("second"); ok {
+		t.Error("the least recently used entry should be evicted")
+	}
+	if len(registry.cache) != cacheSize || registry.recency.Len() != cacheSize {
+		t.Errorf("cache holds %d/%d entries, want %d", len(registry.cache), registry.recency.Len(), cacheSize)
+	}
+}
@@ -0,0 +1,271 @@
+package gossip
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/clock"
+	"rd-backend/internal/db"
+	"rd-backend/internal/memory"
+	"rd-backend/internal/types"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// IntervalSeconds is how often NPCs gossip
+	IntervalSeconds int `json:"interval_seconds"`
+	// DelayMinutes is how long an NPC keeps something to themselves before passing it on
+	DelayMinutes int `json:"delay_minutes"`
+	// MaxHops is how many retellings news travels from a witness
+	MaxHops int `json:"max_hops"`
+	// PerPair is the most one NPC tells another per round
+	PerPair int `json:"per_pair"`
+	// Chance is how likely each piece of news is passed on when it could be
+	Chance float64 `json:"chance"`
+	// Distort has a model retell news the way gossip goes, slightly wrong
+	Distort bool `json:"distort"`
+	// Hangouts are the places each NPC is around to see what happens, NPCs left out
+	// only see what happens at their location in npc.json
+	Hangouts map[string][]string `json:"hangouts"`
+	// Links is who each NPC talks to
+	Links map[string][]string `json:"links"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Check makes sure every NPC the config mentions exists
+func (c *Config) Check(npcs npc.NPCs) error {
+	for id := range c.Hangouts {
+		if _, exists := npcs[id]; !exists {
+			return fmt.Errorf("hangouts of unknown NPC %s", id)
+		}
+	}
+	for teller, listeners := range c.Links {
+		if _, exists := npcs[teller]; !exists {
+			return fmt.Errorf("links of unknown NPC %s", teller)
+		}
+		for _, listener := range listeners {
+			if _, exists := npcs[listener]; !exists {
+				return fmt.Errorf("%s links to unknown NPC %s", teller, listener)
+			}
+		}
+	}
+	return nil
+}
+
+// Network decides which NPCs witness the player's events and spreads what they know to
+// the NPCs they talk to, with a delay and the odd detail getting lost on the way
+type Network struct {
+	dbHandler *db.DBHandler
+	aiHandler *ai.AIHandler
+	indexer   *memory.Indexer
+	npcs      *npc.NPCs
+	clock     *clock.Clock
+	config    Config
+}
+
+func NewNetwork(dbHandler *db.DBHandler, aiHandler *ai.AIHandler, indexer *memory.Indexer, npcs *npc.NPCs, clock *clock.Clock, config Config) *Network {
+	return &Network{
+		dbHandler: dbHandler,
+		aiHandler: aiHandler,
+		indexer:   indexer,
+		npcs:      npcs,
+		clock:     clock,
+		config:    config,
+	}
+}
+
+// Witness records the event as seen by the NPCs where it happened and the NPCs it involves.
+// Events without a location happen wherever the player was last seen. Only the witnesses
+// remember it, the others recall it once they've heard about it.
+func (n *Network) Witness(unityID string, eventID int, eventType string, details string, description string) {
+	// Details that aren't a JSON object just have no fields to go on
+	var fields map[string]any
+	json.Unmarshal([]byte(details), &fields)
+
+	location, _ := fields["location"].(string)
+	if location != "" && eventType == "location_entered" {
+		if err := n.dbHandler.SetPlayerLocation(unityID, location); err != nil {
+			log.Printf("Could not set location of %s: %v", unityID, err)
+		}
+	}
+	if location == "" {
+		var err error
+		if location, err = n.dbHandler.GetPlayerLocation(unityID); err != nil {
+			log.Printf("Could not get location of %s: %v", unityID, err)
+		}
+	}
+
+	for id := range n.witnesses(unityID, location, fields) {
+		added, err := n.dbHandler.AddKnowledge(types.DBKnowledge{
+			UnityID: unityID,
+			NpcID:   id,
+			EventID: eventID,
+			Content: description,
+		})
+		if err != nil {
+			log.Printf("Could not record that %s saw event %d: %v", id, eventID, err)
+			continue
+		}
+		if added {
+			n.indexer.Remember(unityID, id, types.MemoryKindEvent, description)
+		}
+	}
+}
+
+// witnesses returns the NPCs at location and those named in the event's fields
+func (n *Network) witnesses(unityID string, location string, fields map[string]any) map[string]bool {
+	witnesses := make(map[string]bool)
+	minute, timeKnown := n.clock.Now(unityID)
+
+	for id, npcPersonality := range *n.npcs {
+		if location != "" && n.isAround(id, npcPersonality, location, minute, timeKnown) {
+			witnesses[id] = true
+			continue
+		}
+
+		for _, value := range fields {
+			name, ok := value.(string)
+			if ok && (strings.EqualFold(name, id) || strings.EqualFold(name, npcPersonality.Name)) {
+				witnesses[id] = true
+				break
+			}
+		}
+	}
+
+	return witnesses
+}
+
+// isAround is whether the NPC is at location. NPCs whose schedule covers the player's game time
+// are wherever it puts them, the others at their usual location or one of their hangouts.
+func (n *Network) isAround(id string, npcPersonality types.NPC, location string, minute int, timeKnown bool) bool {
+	if timeKnown {
+		if entry, scheduled := npc.At(npcPersonality, minute); scheduled {
+			return strings.EqualFold(entry.Location, location)
+		}
+	}
+
+	if strings.EqualFold(npcPersonality.Location, location) {
+		return true
+	}
+	for _, hangout := range n.config.Hangouts[id] {
+		if strings.EqualFold(hangout, location) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start spreads gossip every interval in the background
+func (n *Network) Start() {
+	interval := time.Duration(n.config.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			n.Spread()
+		}
+	}()
+}
+
+// Spread has every NPC tell the NPCs they talk to what they've known for long enough
+func (n *Network) Spread() {
+	learnedBefore := time.Now().Add(-time.Duration(n.config.DelayMinutes) * time.Minute)
+
+	for tellerID, listeners := range n.config.Links {
+		teller, exists := (*n.npcs)[tellerID]
+		if !exists {
+			continue
+		}
+
+		for _, listenerID := range listeners {
+			news, err := n.dbHandler.GetGossip(tellerID, listenerID, learnedBefore, n.config.MaxHops, n.config.PerPair)
+			if err != nil {
+				log.Printf("Could not get gossip from %s for %s: %v", tellerID, listenerID, err)
+				continue
+			}
+
+			for _, item := range news {
+				if rand.Float64() >= n.config.Chance {
+					continue
+				}
+				n.tell(teller, listenerID, item)
+			}
+		}
+	}
+}
+
+// tell passes one piece of news on, retold by the teller
+func (n *Network) tell(teller types.NPC, listenerID string, item types.DBKnowledge) {
+	content := item.Content
+	if n.config.Distort {
+		retold, err := n.retell(teller, item)
+		if err != nil {
+			log.Printf("Could not retell %q as %s, passing it on as is: %v", item.Content, teller.ID, err)
+		} else {
+			content = retold
+		}
+	}
+
+	added, err := n.dbHandler.AddKnowledge(types.DBKnowledge{
+		UnityID:     item.UnityID,
+		NpcID:       listenerID,
+		EventID:     item.EventID,
+		Content:     content,
+		SourceNpcID: teller.ID,
+		Hops:        item.Hops + 1,
+	})
+	if err != nil {
+		log.Printf("Could not pass gossip from %s to %s: %v", teller.ID, listenerID, err)
+		return
+	}
+	if added {
+		log.Printf("%s told %s about %s: %s", teller.ID, listenerID, item.UnityID, content)
+		n.indexer.Remember(item.UnityID, listenerID, types.MemoryKindEvent, content)
+	}
+}
+
+// retelling is what retell asks the model for
+type retelling struct {
+	Retelling string `json:"retelling" jsonschema:"minLength=1,maxLength=300"`
+}
+
+// retell has a model pass the news on the way the teller would, getting a detail wrong now and then
+func (n *Network) retell(teller types.NPC, item types.DBKnowledge) (string, error) {
+	result, err := ai.CompleteJSONAs[retelling](n.aiHandler, ai.UsageKey{UnityID: item.UnityID, NpcID: teller.ID, CallType: ai.CallGossip}, ai.JSONRequest{
+		Name: "gossip",
+		Instructions: fmt.Sprintf(
+			"You are %s, a game character, passing on news about the player to a friend. %s speaks like this: %s "+
+				"Retell the news in one sentence, in the third person about the player. Like real gossip it may "+
+				"exaggerate a little or get a minor detail wrong, but keep who did what.",
+			teller.Name, teller.Name, teller.SpeechStyle,
+		),
+		Input: item.Content,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(result.Retelling), nil
+}
@@ -0,0 +1,245 @@
+package lore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"rd-backend/internal/ai/npc"
+	"sort"
+	"strings"
+)
+
+// maxChunkWords keeps chunks small enough that a few of them fit the lore budget
+const maxChunkWords = 120
+
+// Chunk is a passage of lore, the unit that gets retrieved
+type Chunk struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	// KnownBy are the NPCs who know this, empty means everyone does
+	KnownBy []string `json:"known_by,omitempty"`
+}
+
+// KnownTo says whether the NPC knows the chunk
+func (c Chunk) KnownTo(npcID string) bool {
+	if len(c.KnownBy) == 0 {
+		return true
+	}
+	for _, id := range c.KnownBy {
+		if id == npcID {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckNPCs makes sure every NPC that chunks are restricted to exists
+func CheckNPCs(chunks []Chunk, npcs npc.NPCs) error {
+	for _, chunk := range chunks {
+		for _, id := range chunk.KnownBy {
+			if _, exists := npcs[id]; !exists {
+				return fmt.Errorf("%s is known by unknown NPC %s", chunk.ID, id)
+			}
+		}
+	}
+	return nil
+}
+
+// entry is one lore document in a JSON file
+type entry struct {
+	Title   string   `json:"title"`
+	Text    string   `json:"text"`
+	KnownBy []string `json:"known_by"`
+}
+
+// Load reads every .md and .json document in dir and splits them into chunks.
+//
+// Markdown documents may start with a front matter block of "key: value" lines between
+// "---" lines, where known_by is a comma separated list of NPC IDs. They are chunked by
+// heading and paragraph. JSON documents are an array of {title, text, known_by}.
+func Load(dir string) ([]Chunk, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var chunks []Chunk
+	for _, path := range paths {
+		var loaded []Chunk
+		switch filepath.Ext(path) {
+		case ".md":
+			loaded, err = loadMarkdown(path)
+		case ".json":
+			loaded, err = loadJSON(path)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		chunks = append(chunks, loaded...)
+	}
+
+	return chunks, nil
+}
+
+func loadJSON(path string) ([]Chunk, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), ".json")
+	var chunks []Chunk
+	for i, entry := range entries {
+		for j, text := range split(strings.Split(entry.Text, "\n\n")) {
+			chunks = append(chunks, Chunk{
+				ID:      fmt.Sprintf("%s/%d.%d", name, i, j),
+				Title:   entry.Title,
+				Text:    text,
+				KnownBy: entry.KnownBy,
+			})
+		}
+	}
+	return chunks, nil
+}
+
+func loadMarkdown(path string) ([]Chunk, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	name := strings.TrimSuffix(filepath.Base(path), ".md")
+	meta := map[string]string{}
+	title := name
+	var knownBy []string
+
+	var chunks []Chunk
+	var heading string
+	var paragraphs []string
+	var paragraph []string
+
+	endParagraph := func() {
+		if len(paragraph) > 0 {
+			paragraphs = append(paragraphs, strings.Join(paragraph, " "))
+			paragraph = nil
+		}
+	}
+	endSection := func() {
+		endParagraph()
+		sectionTitle := title
+		if heading != "" && heading != title {
+			sectionTitle = title + " > " + heading
+		}
+		for _, text := range split(paragraphs) {
+			chunks = append(chunks, Chunk{
+				ID:      fmt.Sprintf("%s/%d", name, len(chunks)),
+				Title:   sectionTitle,
+				Text:    text,
+				KnownBy: knownBy,
+			})
+		}
+		paragraphs = nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	first := true
+	inFrontMatter := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if first && line == "---" {
+			first = false
+			inFrontMatter = true
+			continue
+		}
+		first = false
+
+		if inFrontMatter {
+			if line == "---" {
+				inFrontMatter = false
+				if meta["title"] != "" {
+					title = meta["title"]
+				}
+				knownBy = splitList(meta["known_by"])
+				continue
+			}
+			if key, value, found := strings.Cut(line, ":"); found {
+				meta[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#"):
+			endSection()
+			heading = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		case line == "":
+			endParagraph()
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if inFrontMatter {
+		return nil, fmt.Errorf("front matter is never closed")
+	}
+	endSection()
+
+	return chunks, nil
+}
+
+// split packs paragraphs into chunks of up to maxChunkWords. Longer paragraphs get a chunk
+// of their own rather than being cut mid-sentence.
+func split(paragraphs []string) []string {
+	var chunks []string
+	var current []string
+	words := 0
+
+	for _, paragraph := range paragraphs {
+		paragraph = strings.Join(strings.Fields(paragraph), " ")
+		if paragraph == "" {
+			continue
+		}
+
+		count := len(strings.Fields(paragraph))
+		if words > 0 && words+count > maxChunkWords {
+			chunks = append(chunks, strings.Join(current, " "))
+			current = nil
+			words = 0
+		}
+		current = append(current, paragraph)
+		words += count
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, " "))
+	}
+
+	return chunks
+}
+
+// splitList reads "a, b, c" and "[a, b, c]"
+func splitList(value string) []string {
+	value = strings.Trim(strings.TrimSpace(value), "[]")
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.Trim(strings.TrimSpace(item), `"'`); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,207 @@
+package lore
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"rd-backend/internal/ai"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// BM25 parameters, the usual defaults
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// rrfK damps reciprocal rank fusion so the top rank of one ranking doesn't decide alone
+	rrfK = 60
+	// minLoreSimilarity filters out chunks that are only vaguely related to the message
+	minLoreSimilarity = 0.3
+)
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "but": true,
+	"by": true, "do": true, "for": true, "from": true, "has": true, "have": true, "he": true, "her": true,
+	"his": true, "i": true, "in": true, "is": true, "it": true, "its": true, "me": true, "my": true,
+	"of": true, "on": true, "or": true, "she": true, "so": true, "that": true, "the": true, "their": true,
+	"there": true, "they": true, "this": true, "to": true, "was": true, "we": true, "what": true,
+	"when": true, "where": true, "who": true, "with": true, "you": true, "your": true,
+}
+
+// Result is a retrieved chunk and how well it matched
+type Result struct {
+	Chunk
+	Score float64
+}
+
+// Index finds the lore chunks related to a message. Chunks are ranked by BM25 keyword
+// relevance and, with an embedder, by embedding similarity, and the two rankings are fused.
+type Index struct {
+	chunks   []Chunk
+	embedder ai.Embedder
+
+	terms      []map[string]int
+	lengths    []int
+	avgLength  float64
+	docFreq    map[string]int
+	embeddings [][]float32
+}
+
+// NewIndex indexes chunks. embedder may be nil for keyword search only.
+func NewIndex(chunks []Chunk, embedder ai.Embedder) (*Index, error) {
+	index := &Index{
+		chunks:   chunks,
+		embedder: embedder,
+		terms:    make([]map[string]int, len(chunks)),
+		lengths:  make([]int, len(chunks)),
+		docFreq:  make(map[string]int),
+	}
+
+	total := 0
+	for i, chunk := range chunks {
+		words := tokenize(chunk.Title + " " + chunk.Text)
+		counts := make(map[string]int)
+		for _, word := range words {
+			counts[word]++
+		}
+		for word := range counts {
+			index.docFreq[word]++
+		}
+		index.terms[i] = counts
+		index.lengths[i] = len(words)
+		total += len(words)
+	}
+	if len(chunks) > 0 {
+		index.avgLength = float64(total) / float64(len(chunks))
+	}
+
+	if embedder != nil && len(chunks) > 0 {
+		texts := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			texts[i] = chunk.Title + ": " + chunk.Text
+		}
+		embeddings, err := embedder.Embed(texts)
+		if err != nil {
+			return nil, fmt.Errorf("could not embed lore: %w", err)
+		}
+		index.embeddings = embeddings
+	}
+
+	return index, nil
+}
+
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := words[:0]
+	for _, word := range words {
+		if len(word) > 1 && !stopWords[word] {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+func (x *Index) bm25(query []string, i int) float64 {
+	score := 0.0
+	n := float64(len(x.chunks))
+	for _, word := range query {
+		tf := float64(x.terms[i][word])
+		if tf == 0 {
+			continue
+		}
+		df := float64(x.docFreq[word])
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		score += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(x.lengths[i])/x.avgLength))
+	}
+	return score
+}
+
+// Search returns up to limit chunks the NPC knows that are related to query, best first
+func (x *Index) Search(query string, npcID string, limit int) []Result {
+	words := tokenize(query)
+	seen := make(map[string]bool)
+	unique := words[:0]
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			unique = append(unique, word)
+		}
+	}
+
+	type candidate struct {
+		index int
+		score float64
+	}
+
+	var keyword []candidate
+	for i, chunk := range x.chunks {
+		if !chunk.KnownTo(npcID) {
+			continue
+		}
+		if score := x.bm25(unique, i); score > 0 {
+			keyword = append(keyword, candidate{i, score})
+		}
+	}
+
+	var semantic []candidate
+	if x.embeddings != nil {
+		embeddings, err := x.embedder.Embed([]string{query})
+		if err != nil || len(embeddings) == 0 {
+			log.Printf("Could not embed lore query: %v", err)
+		} else {
+			for i, chunk := range x.chunks {
+				if !chunk.KnownTo(npcID) {
+					continue
+				}
+				if similarity := ai.CosineSimilarity(embeddings[0], x.embeddings[i]); similarity >= minLoreSimilarity {
+					semantic = append(semantic, candidate{i, similarity})
+				}
+			}
+		}
+	}
+
+	// Reciprocal rank fusion, BM25 scores and similarities aren't on the same scale
+	fused := make(map[int]float64)
+	for _, ranking := range [][]candidate{keyword, semantic} {
+		sort.SliceStable(ranking, func(a, b int) bool { return ranking[a].score > ranking[b].score })
+		for rank, c := range ranking {
+			fused[c.index] += 1.0 / float64(rrfK+rank+1)
+		}
+	}
+
+	results := make([]Result, 0, len(fused))
+	for i, score := range fused {
+		results = append(results, Result{Chunk: x.chunks[i], Score: score})
+	}
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return results[a].ID < results[b].ID
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// Retrieve returns the text of the chunks Search finds, for prompts
+func (x *Index) Retrieve(query string, npcID string, limit int) []string {
+	results := x.Search(query, npcID, limit)
+
+	passages := make([]string, len(results))
+	for i, result := range results {
+		passages[i] = result.Title + ": " + result.Text
+	}
+	return passages
+}
+
+// Size is how many chunks are indexed
+func (x *Index) Size() int {
+	return len(x.chunks)
+}
@@ -0,0 +1,97 @@
+package lore
+
+import (
+	"fmt"
+	"rd-backend/internal/ai"
+	"testing"
+)
+
+var testChunks = []Chunk{
+	{ID: "bakery", Title: "The bakery", Text: "Bea bakes rye bread every morning and sells it at the market."},
+	{ID: "harbor", Title: "The harbor", Text: "Fishing boats leave the harbor at dawn. The harbor master keeps a ledger of every boat."},
+	{ID: "market", Title: "The market", Text: "The market opens on Saturdays in the square."},
+	{ID: "smuggling", Title: "Smugglers", Text: "Smugglers use the harbor caves at night.", KnownBy: []string{"fisher"}},
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"The Harbor, at dawn!", []string{"harbor", "dawn"}},
+		{"it's a 5-day walk", []string{"day", "walk"}},
+		{"I and you", nil},
+	}
+
+	for _, test := range tests {
+		if got := tokenize(test.text); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestSearchKeywords(t *testing.T) {
+	index, err := NewIndex(testChunks, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		npcID string
+		limit int
+		want  []string
+	}{
+		{"single match", "who bakes the bread?", "baker", 5, []string{"bakery"}},
+		{"more mentions rank first", "when do boats leave the harbor", "baker", 5, []string{"harbor"}},
+		{"shorter chunk ranks first", "market harbor", "baker", 5, []string{"market", "harbor", "bakery"}},
+		{"restricted chunk hidden", "harbor caves at night", "baker", 5, []string{"harbor"}},
+		{"restricted chunk known", "harbor caves at night", "fisher", 5, []string{"smuggling", "harbor"}},
+		{"repeating a word doesn't count twice", "harbor harbor harbor caves", "fisher", 5, []string{"smuggling", "harbor"}},
+		{"limit", "market harbor", "baker", 1, []string{"market"}},
+		{"only stop words", "what is the", "baker", 5, nil},
+		{"nothing related", "dragons", "baker", 5, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, result := range index.Search(test.query, test.npcID, test.limit) {
+				got = append(got, result.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("Search(%q) = %q, want %q", test.query, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSearchFusesEmbeddings(t *testing.T) {
+	index, err := NewIndex(testChunks, ai.NewHashingEmbedder(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := index.Search("harbor caves at night", "fisher", 5)
+	if len(results) == 0 || results[0].ID != "smuggling" {
+		t.Fatalf("results = %+v, want the smuggling chunk first", results)
+	}
+	for _, result := range index.Search("harbor caves at night", "baker", 5) {
+		if result.ID == "smuggling" {
+			t.Error("the embedding ranking returned a chunk the NPC doesn't know")
+		}
+	}
+}
+
+func TestRetrieve(t *testing.T) {
+	index, err := NewIndex(testChunks, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passages := index.Retrieve("saturdays", "baker", 5)
+	if fmt.Sprint(passages) != "[The market: The market opens on Saturdays in the square.]" {
+		t.Errorf("passages = %q", passages)
+	}
+}
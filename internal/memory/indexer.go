@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"log"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/db"
+)
+
+// Indexer embeds messages and events as they happen so NPCs can recall them later
+type Indexer struct {
+	dbHandler *db.DBHandler
+	embedder  ai.Embedder
+}
+
+func NewIndexer(dbHandler *db.DBHandler, embedder ai.Embedder) *Indexer {
+	return &Indexer{
+		dbHandler: dbHandler,
+		embedder:  embedder,
+	}
+}
+
+// Remember embeds and stores content in the background. kind is one of the
+// types.MemoryKind constants; use an empty npcID for memories every NPC shares.
+func (i *Indexer) Remember(unityID string, npcID string, kind string, content string) {
+	if content == "" {
+		return
+	}
+
+	go func() {
+		embeddings, err := i.embedder.Embed([]string{content})
+		if err != nil || len(embeddings) == 0 {
+			log.Printf("Could not embed %s memory for %s: %v", kind, unityID, err)
+			return
+		}
+
+		if err := i.dbHandler.AddMemory(unityID, npcID, kind, content, embeddings[0]); err != nil {
+			log.Printf("Could not store %s memory for %s: %v", kind, unityID, err)
+		}
+	}()
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"log"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/db"
+	"strconv"
+	"sync"
+)
+
+const (
+	// keepRecent messages per player/NPC pair are left out of the summary,
+	// they are still sent to the model word for word
+	keepRecent = 20
+	// batchSize is how many older messages have to pile up before they get summarized
+	batchSize = 20
+)
+
+// Summarizer condenses older exchanges between a player and an NPC into a rolling summary,
+// which is the NPC's long-term memory of the relationship
+type Summarizer struct {
+	dbHandler *db.DBHandler
+	aiHandler *ai.AIHandler
+	running   sync.Map
+}
+
+func NewSummarizer(dbHandler *db.DBHandler, aiHandler *ai.AIHandler) *Summarizer {
+	return &Summarizer{
+		dbHandler: dbHandler,
+		aiHandler: aiHandler,
+	}
+}
+
+// Summary returns the latest summary for the pair, empty if there is none yet
+func (s *Summarizer) Summary(unityID string, npcID string) string {
+	summary, err := s.dbHandler.GetConversationSummary(unityID, npcID)
+	if err != nil {
+		log.Printf("Could not get conversation summary for %s/%s: %v", unityID, npcID, err)
+		return ""
+	}
+	return summary.Summary
+}
+
+// Update summarizes the pair in the background once enough messages have piled up
+// outside the recent window. Only one update per pair runs at a time.
+func (s *Summarizer) Update(unityID string, npcID string) {
+	key := unityID + "/" + npcID
+	if _, busy := s.running.LoadOrStore(key, struct{}{}); busy {
+		return
+	}
+
+	go func() {
+		defer s.running.Delete(key)
+
+		if err := s.summarize(unityID, npcID); err != nil {
+			log.Printf("Could not summarize conversation %s: %v", key, err)
+		}
+	}()
+}
+
+func (s *Summarizer) summarize(unityID string, npcID string) error {
+	summary, err := s.dbHandler.GetConversationSummary(unityID, npcID)
+	if err != nil {
+		return err
+	}
+
+	unsummarized, err := s.dbHandler.CountMessagesWithNPCAfter(unityID, npcID, summary.LastMessageID)
+	if err != nil {
+		return err
+	}
+
+	if unsummarized < keepRecent+batchSize {
+		return nil
+	}
+
+	// Fold in everything but the recent window, a batch at a time
+	messages, err := s.dbHandler.GetMessagesWithNPCAfter(unityID, npcID, summary.LastMessageID, unsummarized-keepRecent)
+	if err != nil {
+		return err
+	}
+
+	text := summary.Summary
+	for start := 0; start < len(messages); start += batchSize {
+		end := min(start+batchSize, len(messages))
+		batch := messages[start:end]
+
+		updated, err := s.aiHandler.SummarizeConversation(unityID, text, batch, npcID)
+		if err != nil {
+			return err
+		}
+
+		lastID, err := strconv.Atoi(batch[len(batch)-1].ID)
+		if err != nil {
+			return err
+		}
+
+		// Save after every batch so a failure halfway doesn't lose the work done so far
+		if err := s.dbHandler.SaveConversationSummary(unityID, npcID, *updated, lastID); err != nil {
+			return err
+		}
+		text = *updated
+	}
+
+	log.Printf("Summarized %d messages between %s and %s", len(messages), unityID, npcID)
+	return nil
+}
@@ -0,0 +1,269 @@
+package quests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/db"
+	"rd-backend/internal/types"
+	"strings"
+	"sync"
+)
+
+type Config struct {
+	// MaxOpen is how many offered and unfinished quests a player can have at once, at least 1.
+	// It also bounds the quests looked at when offering and advancing.
+	MaxOpen int `json:"max_open"`
+	// MaxSteps and MaxCoins bound what the model can come up with
+	MaxSteps int `json:"max_steps"`
+	MaxCoins int `json:"max_coins"`
+	// EventTypes are the events the game sends that quests can be built on, with the
+	// fields each one has
+	EventTypes map[string]string `json:"event_types"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	if config.MaxOpen <= 0 {
+		return nil, fmt.Errorf("max_open must be at least 1")
+	}
+	return &config, nil
+}
+
+// openStates are the states of quests that aren't over yet
+var openStates = []string{types.QuestOffered, types.QuestAccepted, types.QuestInProgress}
+
+// activeStates are the states of quests that events move along
+var activeStates = []string{types.QuestAccepted, types.QuestInProgress}
+
+// Board keeps the quests NPCs give players. NPCs offer quests written from their goals, the
+// player accepts them in conversation and the game's events move them along to the end.
+type Board struct {
+	dbHandler *db.DBHandler
+	aiHandler *ai.AIHandler
+	npcs      *npc.NPCs
+	config    Config
+
+	mu          sync.Mutex
+	subscribers map[string]map[int]func(types.DBQuest)
+	nextID      int
+}
+
+func NewBoard(dbHandler *db.DBHandler, aiHandler *ai.AIHandler, npcs *npc.NPCs, config Config) *Board {
+	return &Board{
+		dbHandler:   dbHandler,
+		aiHandler:   aiHandler,
+		npcs:        npcs,
+		config:      config,
+		subscribers: make(map[string]map[int]func(types.DBQuest)),
+	}
+}
+
+// Offer has the NPC come up with a quest for the player. An NPC with a quest for the player
+// that isn't over yet returns that one instead, with true.
+func (b *Board) Offer(unityID string, npcID string, idea string) (*types.DBQuest, bool, error) {
+	npcPersonality, exists := (*b.npcs)[npcID]
+	if !exists {
+		return nil, false, fmt.Errorf("NPC with ID %s not found", npcID)
+	}
+
+	open, err := b.dbHandler.GetQuests(unityID, "", openStates, b.config.MaxOpen+1)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, quest := range open {
+		if quest.NpcID == npcID {
+			return &quest, true, nil
+		}
+	}
+	if len(open) >= b.config.MaxOpen {
+		return nil, false, fmt.Errorf("the player already has %d quests going", len(open))
+	}
+
+	previous, err := b.dbHandler.GetQuests(unityID, npcID, nil, 5)
+	if err != nil {
+		return nil, false, err
+	}
+
+	quest, err := b.write(unityID, npcPersonality, idea, previous)
+	if err != nil {
+		return nil, false, err
+	}
+
+	quest.ID, err = b.dbHandler.CreateQuest(*quest)
+	if err != nil {
+		return nil, false, err
+	}
+
+	log.Printf("%s offered %s the quest %q", npcID, unityID, quest.Title)
+	b.notify(unityID, *quest)
+	return quest, false, nil
+}
+
+// Accept starts the quest the NPC offered the player
+func (b *Board) Accept(unityID string, npcID string) (*types.DBQuest, error) {
+	offered, err := b.dbHandler.GetQuests(unityID, npcID, []string{types.QuestOffered}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(offered) == 0 {
+		return nil, fmt.Errorf("%s hasn't offered %s a quest", npcID, unityID)
+	}
+
+	quest := offered[0]
+	quest.State = types.QuestAccepted
+	if err := b.dbHandler.UpdateQuest(quest); err != nil {
+		return nil, err
+	}
+
+	log.Printf("%s accepted the quest %q from %s", unityID, quest.Title, npcID)
+	b.notify(unityID, quest)
+	return &quest, nil
+}
+
+// Advance moves the player's quests along after an event and returns the ones that changed.
+// details are the event's fields as the game sent them.
+func (b *Board) Advance(unityID string, eventType string, details string) []types.DBQuest {
+	active, err := b.dbHandler.GetQuests(unityID, "", activeStates, b.config.MaxOpen+1)
+	if err != nil {
+		log.Printf("Could not get quests of %s: %v", unityID, err)
+		return nil
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	// Details that aren't a JSON object just have no fields to match
+	var fields map[string]any
+	json.Unmarshal([]byte(details), &fields)
+
+	var changed []types.DBQuest
+	for _, quest := range active {
+		if !b.advance(&quest, eventType, fields) {
+			continue
+		}
+
+		if err := b.dbHandler.UpdateQuest(quest); err != nil {
+			log.Printf("Could not update quest %d: %v", quest.ID, err)
+			continue
+		}
+		if quest.State == types.QuestComplete || quest.State == types.QuestFailed {
+			log.Printf("Quest %q of %s is %s", quest.Title, unityID, quest.State)
+		}
+
+		b.notify(unityID, quest)
+		changed = append(changed, quest)
+	}
+
+	return changed
+}
+
+// advance applies the event to the quest, returning false if it didn't change it
+func (b *Board) advance(quest *types.DBQuest, eventType string, fields map[string]any) bool {
+	if quest.FailEventType != "" && quest.FailEventType == eventType {
+		quest.State = types.QuestFailed
+		return true
+	}
+	if quest.Step >= len(quest.Steps) {
+		return false
+	}
+
+	step := quest.Steps[quest.Step]
+	if step.EventType != eventType || !b.matches(step.Target, fields) {
+		return false
+	}
+
+	quest.State = types.QuestInProgress
+	quest.Progress++
+	if quest.Progress >= max(step.Count, 1) {
+		quest.Step++
+		quest.Progress = 0
+	}
+	if quest.Step >= len(quest.Steps) {
+		quest.State = types.QuestComplete
+	}
+
+	return true
+}
+
+// matches is whether one of the event's fields is target, or mentions it. NPCs can be
+// named by their ID or their name.
+func (b *Board) matches(target string, fields map[string]any) bool {
+	if target == "" {
+		return true
+	}
+
+	targets := []string{strings.ToLower(target)}
+	for id, npcPersonality := range *b.npcs {
+		if strings.EqualFold(id, target) || strings.EqualFold(npcPersonality.Name, target) {
+			targets = []string{strings.ToLower(id), strings.ToLower(npcPersonality.Name)}
+			break
+		}
+	}
+
+	for _, value := range fields {
+		text, ok := value.(string)
+		if !ok {
+			continue
+		}
+		for _, candidate := range targets {
+			if strings.Contains(strings.ToLower(text), candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Quests returns the player's quests, newest first
+func (b *Board) Quests(unityID string) ([]types.DBQuest, error) {
+	return b.dbHandler.GetQuests(unityID, "", nil, 100)
+}
+
+// Subscribe calls push with every change to the player's quests until unsubscribe is called
+func (b *Board) Subscribe(unityID string, push func(types.DBQuest)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+
+	if b.subscribers[unityID] == nil {
+		b.subscribers[unityID] = make(map[int]func(types.DBQuest))
+	}
+	b.subscribers[unityID][id] = push
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers[unityID], id)
+		if len(b.subscribers[unityID]) == 0 {
+			delete(b.subscribers, unityID)
+		}
+	}
+}
+
+func (b *Board) notify(unityID string, quest types.DBQuest) {
+	b.mu.Lock()
+	pushes := make([]func(types.DBQuest), 0, len(b.subscribers[unityID]))
+	for _, push := range b.subscribers[unityID] {
+		pushes = append(pushes, push)
+	}
+	b.mu.Unlock()
+
+	for _, push := range pushes {
+		push(quest)
+	}
+}
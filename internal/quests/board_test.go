@@ -0,0 +1,117 @@
+package quests
+
+import (
+	"os"
+	"path/filepath"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/types"
+	"testing"
+)
+
+func newTestBoard() *Board {
+	return NewBoard(nil, nil, &npc.NPCs{
+		"bea": {ID: "bea", Name: "Bea Baker"},
+	}, Config{MaxOpen: 3})
+}
+
+func TestLoadConfigRequiresMaxOpen(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{"capped", `{"max_open": 3}`, false},
+		{"zero", `{"max_open": 0}`, true},
+		{"missing", `{}`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "quests.json")
+			if err := os.WriteFile(path, []byte(test.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadConfig(path); (err != nil) != test.wantErr {
+				t.Errorf("LoadConfig error = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	b := newTestBoard()
+
+	tests := []struct {
+		name   string
+		target string
+		fields map[string]any
+		want   bool
+	}{
+		{"no target", "", nil, true},
+		{"exact field", "apple", map[string]any{"item": "apple"}, true},
+		{"ignoring case", "Apple", map[string]any{"item": "APPLE"}, true},
+		{"mentioned in a field", "apple", map[string]any{"item": "a red apple"}, true},
+		{"other field", "apple", map[string]any{"item": "pear", "from": "apple tree"}, true},
+		{"not there", "apple", map[string]any{"item": "pear"}, false},
+		{"not a string", "3", map[string]any{"count": 3}, false},
+		{"no fields", "apple", nil, false},
+		{"NPC by ID matches their name", "bea", map[string]any{"npc": "Bea Baker"}, true},
+		{"NPC by name matches their ID", "Bea Baker", map[string]any{"npc_id": "bea"}, true},
+		{"NPC not there", "bea", map[string]any{"npc": "Tom"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := b.matches(test.target, test.fields); got != test.want {
+				t.Errorf("matches(%q, %v) = %v, want %v", test.target, test.fields, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	b := newTestBoard()
+
+	quest := func(step int, progress int) types.DBQuest {
+		return types.DBQuest{
+			State: types.QuestAccepted,
+			Steps: []types.QuestStep{
+				{EventType: "pickup", Target: "apple", Count: 2},
+				{EventType: "talk", Target: "bea"},
+			},
+			FailEventType: "steal",
+			Step:          step,
+			Progress:      progress,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		quest     types.DBQuest
+		eventType string
+		fields    map[string]any
+		changed   bool
+		state     string
+		step      int
+		progress  int
+	}{
+		{"other event", quest(0, 0), "talk", map[string]any{"npc": "bea"}, false, types.QuestAccepted, 0, 0},
+		{"wrong target", quest(0, 0), "pickup", map[string]any{"item": "pear"}, false, types.QuestAccepted, 0, 0},
+		{"progress", quest(0, 0), "pickup", map[string]any{"item": "apple"}, true, types.QuestInProgress, 0, 1},
+		{"step done", quest(0, 1), "pickup", map[string]any{"item": "apple"}, true, types.QuestInProgress, 1, 0},
+		{"count of 0 takes one event", quest(1, 0), "talk", map[string]any{"npc": "Bea Baker"}, true, types.QuestComplete, 2, 0},
+		{"fail event", quest(1, 0), "steal", nil, true, types.QuestFailed, 1, 0},
+		{"already done", quest(2, 0), "talk", map[string]any{"npc": "bea"}, false, types.QuestAccepted, 2, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q := test.quest
+			changed := b.advance(&q, test.eventType, test.fields)
+			if changed != test.changed || q.State != test.state || q.Step != test.step || q.Progress != test.progress {
+				t.Errorf("got changed %v, %s at step %d progress %d, want changed %v, %s at step %d progress %d",
+					changed, q.State, q.Step, q.Progress, test.changed, test.state, test.step, test.progress)
+			}
+		})
+	}
+}
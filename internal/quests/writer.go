@@ -0,0 +1,142 @@
+package quests
+
+import (
+	"fmt"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/schema"
+	"rd-backend/internal/types"
+	"sort"
+	"strings"
+)
+
+// draft is what write asks the model for
+type draft struct {
+	Title   string      `json:"title" jsonschema:"minLength=1,maxLength=80"`
+	Summary string      `json:"summary" jsonschema:"minLength=1,maxLength=300,description=What the NPC asks of the player and why, in the NPC's words"`
+	Steps   []draftStep `json:"steps" jsonschema:"minItems=1"`
+	// FailEventType is "none" when nothing fails the quest
+	FailEventType string      `json:"fail_event_type" jsonschema:"description=An event that ruins the quest, none if nothing does"`
+	Rewards       draftReward `json:"rewards"`
+}
+
+type draftStep struct {
+	Description string `json:"description" jsonschema:"minLength=1,maxLength=200"`
+	EventType   string `json:"event_type"`
+	Target      string `json:"target" jsonschema:"maxLength=64,description=The item, place or person the event has to be about, empty for any"`
+	Count       int    `json:"count" jsonschema:"minimum=1,maximum=5"`
+}
+
+type draftReward struct {
+	Items []string `json:"items" jsonschema:"maxItems=2"`
+	Coins int      `json:"coins" jsonschema:"minimum=0"`
+}
+
+// write has the model come up with a quest the NPC would give, built on events the game sends
+func (b *Board) write(unityID string, npcPersonality types.NPC, idea string, previous []types.DBQuest) (*types.DBQuest, error) {
+	eventTypes := make([]string, 0, len(b.config.EventTypes))
+	for eventType := range b.config.EventTypes {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+	if len(eventTypes) == 0 {
+		return nil, fmt.Errorf("no event types to build quests on")
+	}
+
+	request := ai.JSONRequest{
+		Name:         "quest",
+		Instructions: b.instructions(npcPersonality, eventTypes, previous),
+		Input:        idea,
+	}
+	if request.Input == "" {
+		request.Input = "Come up with a quest that fits you."
+	}
+
+	s, err := schemaFor(eventTypes, b.config)
+	if err != nil {
+		return nil, err
+	}
+	request.Schema = s
+
+	result, err := ai.CompleteJSONAs[draft](b.aiHandler, ai.UsageKey{UnityID: unityID, NpcID: npcPersonality.ID, CallType: ai.CallQuest}, request)
+	if err != nil {
+		return nil, err
+	}
+
+	quest := &types.DBQuest{
+		UnityID: unityID,
+		NpcID:   npcPersonality.ID,
+		Title:   result.Title,
+		Summary: result.Summary,
+		Rewards: types.QuestRewards{
+			Items: result.Rewards.Items,
+			Coins: result.Rewards.Coins,
+		},
+		State: types.QuestOffered,
+	}
+	if result.FailEventType != "none" {
+		quest.FailEventType = result.FailEventType
+	}
+	for _, step := range result.Steps {
+		quest.Steps = append(quest.Steps, types.QuestStep{
+			Description: step.Description,
+			EventType:   step.EventType,
+			Target:      strings.TrimSpace(step.Target),
+			Count:       step.Count,
+		})
+	}
+
+	return quest, nil
+}
+
+func (b *Board) instructions(npcPersonality types.NPC, eventTypes []string, previous []types.DBQuest) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "You write quests for a life-sim game. %s, the %s, is about to ask the player for help. "+
+		"%s's goal: %s. Their backstory: %s\n", npcPersonality.Name, npcPersonality.Occupation, npcPersonality.Name, npcPersonality.Goals, npcPersonality.Backstory)
+	fmt.Fprintf(&sb, "Write a small, down-to-earth quest that moves that goal along, with at most %d steps. "+
+		"The game can only tell when these events happen, so every step has to be one of them, with the fields they have:\n", b.config.MaxSteps)
+	for _, eventType := range eventTypes {
+		fmt.Fprintf(&sb, "- %s: %s\n", eventType, b.config.EventTypes[eventType])
+	}
+	sb.WriteString("Set a step's target when the event has to be about a particular item, place or person, " +
+		"written the way the game would name it. Steps are done in order.\n")
+	if b.config.MaxCoins > 0 {
+		fmt.Fprintf(&sb, "Rewards are at most %d coins and things %s could actually give.\n", b.config.MaxCoins, npcPersonality.Name)
+	}
+
+	if len(previous) > 0 {
+		titles := make([]string, len(previous))
+		for i, quest := range previous {
+			titles[i] = quest.Title
+		}
+		fmt.Fprintf(&sb, "%s already gave the player these, come up with something different: %s\n", npcPersonality.Name, strings.Join(titles, "; "))
+	}
+
+	return sb.String()
+}
+
+// schemaFor is the draft schema with event types limited to the ones the game sends
+func schemaFor(eventTypes []string, config Config) (*schema.Schema, error) {
+	s, err := schema.For(draft{})
+	if err != nil {
+		return nil, err
+	}
+
+	step := s.Properties["steps"].Items
+	fail := s.Properties["fail_event_type"]
+	fail.Enum = append(fail.Enum, "none")
+	for _, eventType := range eventTypes {
+		step.Properties["event_type"].Enum = append(step.Properties["event_type"].Enum, eventType)
+		fail.Enum = append(fail.Enum, eventType)
+	}
+
+	if config.MaxSteps > 0 {
+		s.Properties["steps"].MaxItems = &config.MaxSteps
+	}
+	if config.MaxCoins > 0 {
+		maxCoins := float64(config.MaxCoins)
+		s.Properties["rewards"].Properties["coins"].Maximum = &maxCoins
+	}
+
+	return s, nil
+}
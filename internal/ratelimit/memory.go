@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore drops buckets that have refilled
+const sweepInterval = time.Minute
+
+// MemoryStore keeps buckets and counts in process, for running a single instance
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucketState
+	lastSweep time.Time
+	day       string
+	counts    map[string]int
+	// now is time.Now, swapped out in tests
+	now func() time.Time
+}
+
+type bucketState struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket is back to capacity. A full bucket is the same as none, so it
+	// can be dropped from then on.
+	full time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucketState),
+		counts:  make(map[string]int),
+		now:     time.Now,
+	}
+}
+
+// sweep drops the buckets that have refilled, so players who left don't stay in memory
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, state := range s.buckets {
+		if !now.Before(state.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func (s *MemoryStore) TakeToken(key string, capacity float64, perSecond float64) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	state, exists := s.buckets[key]
+	if !exists {
+		state = &bucketState{tokens: capacity, updated: now}
+		s.buckets[key] = state
+	}
+
+	state.tokens = min(capacity, state.tokens+now.Sub(state.updated).Seconds()*perSecond)
+	state.updated = now
+
+	if state.tokens < 1 {
+		wait := time.Duration((1 - state.tokens) / perSecond * float64(time.Second))
+		return false, wait, nil
+	}
+
+	state.tokens--
+	state.full = now.Add(time.Duration((capacity - state.tokens) / perSecond * float64(time.Second)))
+	return true, 0, nil
+}
+
+func (s *MemoryStore) IncrementDailyCount(key string, day string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Yesterday's counts are no use anymore
+	if day != s.day {
+		s.day = day
+		s.counts = make(map[string]int)
+	}
+
+	s.counts[key]++
+	return s.counts[key], nil
+}
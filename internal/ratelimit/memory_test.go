@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a MemoryStore clock that only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+	return store, clock
+}
+
+func TestMemoryStoreTakeToken(t *testing.T) {
+	// A bucket of 2 refilling one token every 10 seconds
+	const capacity, perSecond = 2, 0.1
+
+	type take struct {
+		after    time.Duration
+		allowed  bool
+		wantWait time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{
+			name:  "starts full",
+			takes: []take{{0, true, 0}, {0, true, 0}, {0, false, 10 * time.Second}},
+		},
+		{
+			name:  "wait shrinks as the bucket refills",
+			takes: []take{{0, true, 0}, {0, true, 0}, {4 * time.Second, false, 6 * time.Second}},
+		},
+		{
+			name:  "one token back after its interval",
+			takes: []take{{0, true, 0}, {0, true, 0}, {10 * time.Second, true, 0}, {0, false, 10 * time.Second}},
+		},
+		{
+			name:  "never refills past capacity",
+			takes: []take{{0, true, 0}, {time.Hour, true, 0}, {0, true, 0}, {0, false, 10 * time.Second}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store, clock := newTestStore()
+
+			for i, take := range test.takes {
+				clock.advance(take.after)
+				allowed, wait, err := store.TakeToken("ws:player", capacity, perSecond)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if allowed != take.allowed {
+					t.Fatalf("take %d: allowed = %v, want %v", i, allowed, take.allowed)
+				}
+				if (wait - take.wantWait).Abs() > time.Millisecond {
+					t.Fatalf("take %d: wait = %s, want %s", i, wait, take.wantWait)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	store, clock := newTestStore()
+
+	// One token taken from each, "idle" is full again after 10 seconds and "busy" after 2 minutes
+	store.TakeToken("ws:idle", 3, 0.1)
+	store.TakeToken("ws:busy", 3, 1.0/120)
+
+	clock.advance(15 * time.Second)
+	store.sweep(clock.now)
+	if len(store.buckets) != 2 {
+		t.Fatalf("swept before the interval, %d buckets left", len(store.buckets))
+	}
+
+	clock.advance(sweepInterval)
+	store.sweep(clock.now)
+	if _, ok := store.buckets["ws:idle"]; ok {
+		t.Error("a refilled bucket should be swept")
+	}
+	if _, ok := store.buckets["ws:busy"]; !ok {
+		t.Error("a bucket that hasn't refilled shouldn't be swept")
+	}
+
+	clock.advance(sweepInterval)
+	store.sweep(clock.now)
+	if len(store.buckets) != 0 {
+		t.Errorf("%d buckets left after everything refilled", len(store.buckets))
+	}
+}
+
+func TestMemoryStoreSweepKeepsState(t *testing.T) {
+	store, clock := newTestStore()
+
+	// Empty the bucket, then sweep well before it refills
+	store.TakeToken("ws:player", 1, 1.0/120)
+	clock.advance(sweepInterval)
+	store.sweep(clock.now)
+
+	allowed, wait, _ := store.TakeToken("ws:player", 1, 1.0/120)
+	if allowed {
+		t.Fatal("sweeping a bucket that hasn't refilled gave the player a fresh one")
+	}
+	if (wait - time.Minute).Abs() > time.Millisecond {
+		t.Errorf("wait = %s, want 1m", wait)
+	}
+}
+
+func TestMemoryStoreDailyCount(t *testing.T) {
+	store := NewMemoryStore()
+
+	tests := []struct {
+		key  string
+		day  string
+		want int
+	}{
+		{"ws:a", "2026-01-01", 1},
+		{"ws:a", "2026-01-01", 2},
+		{"ws:b", "2026-01-01", 1},
+		{"sms:a", "2026-01-01", 1},
+		{"ws:a", "2026-01-02", 1},
+		{"ws:b", "2026-01-02", 1},
+	}
+
+	for _, test := range tests {
+		count, err := store.IncrementDailyCount(test.key, test.day)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != test.want {
+			t.Errorf("%s on %s: count = %d, want %d", test.key, test.day, count, test.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Channels players reach NPCs through
+const (
+	ChannelWS  = "ws"
+	ChannelSMS = "sms"
+)
+
+// Reasons a message is turned away
+const (
+	ReasonRate  = "rate"
+	ReasonQuota = "quota"
+)
+
+// Decision is whether a message may go to the model, and if not, why and for how long
+type Decision struct {
+	Allowed    bool
+	Reason     string
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether a player's message may trigger a model call. key is whatever
+// identifies the player on the channel: a unity_id for ws, a phone number for sms.
+type Limiter interface {
+	Allow(key string, channel string, tier string) (Decision, error)
+}
+
+// Bucket is a token bucket: Burst messages at once, refilling at PerMinute
+type Bucket struct {
+	Burst     int     `json:"burst"`
+	PerMinute float64 `json:"per_minute"`
+}
+
+type Config struct {
+	// Channels without a bucket aren't rate limited
+	Channels map[string]Bucket `json:"channels"`
+	// DailyQuotas is messages per day by tier, then channel. A missing or zero quota is unlimited.
+	DailyQuotas map[string]map[string]int `json:"daily_quotas"`
+	// DefaultTier applies to players without a tier
+	DefaultTier string `json:"default_tier"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	for channel, bucket := range config.Channels {
+		if bucket.Burst <= 0 || bucket.PerMinute <= 0 {
+			return nil, fmt.Errorf("channel %s needs a positive burst and per_minute", channel)
+		}
+	}
+
+	return &config, nil
+}
+
+// Store keeps bucket levels and daily counts, in memory or somewhere shared between instances
+type Store interface {
+	// TakeToken takes a token from the bucket if it has one, refilling perSecond since the last
+	// call. When it's empty it returns how long until the next token.
+	TakeToken(key string, capacity float64, perSecond float64) (bool, time.Duration, error)
+	// IncrementDailyCount counts a message for the day and returns the day's total
+	IncrementDailyCount(key string, day string) (int, error)
+}
+
+// TokenBucketLimiter applies the config's buckets and daily quotas on top of a Store
+type TokenBucketLimiter struct {
+	store  Store
+	config Config
+}
+
+func NewTokenBucketLimiter(store Store, config Config) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		store:  store,
+		config: config,
+	}
+}
+
+func (l *TokenBucketLimiter) Allow(key string, channel string, tier string) (Decision, error) {
+	storeKey := channel + ":" + key
+
+	if bucket, limited := l.config.Channels[channel]; limited {
+		allowed, retryAfter, err := l.store.TakeToken(storeKey, float64(bucket.Burst), bucket.PerMinute/60)
+		if err != nil {
+			return Decision{}, fmt.Errorf("could not check rate limit: %w", err)
+		}
+		if !allowed {
+			return Decision{Reason: ReasonRate, RetryAfter: retryAfter}, nil
+		}
+	}
+
+	if tier == "" {
+		tier = l.config.DefaultTier
+	}
+	quota := l.config.DailyQuotas[tier][channel]
+	if quota <= 0 {
+		return Decision{Allowed: true}, nil
+	}
+
+	now := time.Now().UTC()
+	count, err := l.store.IncrementDailyCount(storeKey, now.Format(time.DateOnly))
+	if err != nil {
+		return Decision{}, fmt.Errorf("could not check daily quota: %w", err)
+	}
+	if count > quota {
+		tomorrow := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return Decision{Reason: ReasonQuota, RetryAfter: tomorrow.Sub(now)}, nil
+	}
+
+	return Decision{Allowed: true}, nil
+}
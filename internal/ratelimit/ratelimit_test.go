@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	config := Config{
+		Channels: map[string]Bucket{
+			ChannelWS: {Burst: 2, PerMinute: 6},
+		},
+		DailyQuotas: map[string]map[string]int{
+			"free": {ChannelWS: 1, ChannelSMS: 1},
+			"paid": {ChannelWS: 10},
+		},
+		DefaultTier: "free",
+	}
+
+	type call struct {
+		key, channel, tier string
+		reason             string
+	}
+
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "burst then rate limited",
+			calls: []call{
+				{"a", ChannelWS, "paid", ""},
+				{"a", ChannelWS, "paid", ""},
+				{"a", ChannelWS, "paid", ReasonRate},
+			},
+		},
+		{
+			name: "players have their own buckets",
+			calls: []call{
+				{"a", ChannelWS, "paid", ""},
+				{"a", ChannelWS, "paid", ""},
+				{"b", ChannelWS, "paid", ""},
+			},
+		},
+		{
+			name: "daily quota of the default tier",
+			calls: []call{
+				{"a", ChannelWS, "", ""},
+				{"a", ChannelWS, "", ReasonQuota},
+			},
+		},
+		{
+			name: "daily quota of the player's tier",
+			calls: []call{
+				{"a", ChannelWS, "free", ""},
+				{"a", ChannelWS, "free", ReasonQuota},
+				{"b", ChannelWS, "paid", ""},
+				{"b", ChannelWS, "paid", ""},
+			},
+		},
+		{
+			name: "channel without a bucket only has its quota",
+			calls: []call{
+				{"+15550100", ChannelSMS, "", ""},
+				{"+15550100", ChannelSMS, "", ReasonQuota},
+			},
+		},
+		{
+			name: "no bucket and no quota is unlimited",
+			calls: []call{
+				{"+15550100", ChannelSMS, "paid", ""},
+				{"+15550100", ChannelSMS, "paid", ""},
+				{"+15550100", ChannelSMS, "paid", ""},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewTokenBucketLimiter(NewMemoryStore(), config)
+
+			for i, call := range test.calls {
+				decision, err := limiter.Allow(call.key, call.channel, call.tier)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decision.Allowed != (call.reason == "") || decision.Reason != call.reason {
+					t.Fatalf("call %d: got %+v, want reason %q", i, decision, call.reason)
+				}
+				if !decision.Allowed && decision.RetryAfter <= 0 {
+					t.Fatalf("call %d: denied without a retry after", i)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenBucketLimiterQuotaRetryAfter(t *testing.T) {
+	limiter := NewTokenBucketLimiter(NewMemoryStore(), Config{
+		DailyQuotas: map[string]map[string]int{"free": {ChannelWS: 1}},
+		DefaultTier: "free",
+	})
+
+	limiter.Allow("a", ChannelWS, "")
+	decision, err := limiter.Allow("a", ChannelWS, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	midnight := now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+	if decision.Reason != ReasonQuota || (decision.RetryAfter-midnight.Sub(now)).Abs() > time.Second {
+		t.Errorf("got %+v, want a quota denial lasting until midnight UTC (%s)", decision, midnight.Sub(now))
+	}
+}
+
+func TestLoadConfigRejectsEmptyBuckets(t *testing.T) {
+	path := t.TempDir() + "/limits.json"
+	if err := os.WriteFile(path, []byte(`{"channels": {"ws": {"burst": 0, "per_minute": 6}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected a bucket without a burst to be rejected")
+	}
+}
@@ -0,0 +1,100 @@
+package relationships
+
+import (
+	"fmt"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/types"
+	"regexp"
+	"strings"
+)
+
+// maxJudgedDelta is the most a single exchange can move affinity, the change_affinity tool
+// is there for the moments that really matter
+const maxJudgedDelta = 5
+
+// Judge decides how much an exchange changed the way the NPC feels about the player
+type Judge interface {
+	Judge(unityID string, npcPersonality types.NPC, message string, reply string) (int, error)
+}
+
+// RuleJudge looks for kind or rude words in the player's message, with no model calls
+type RuleJudge struct {
+	delta    int
+	positive *regexp.Regexp
+	negative *regexp.Regexp
+}
+
+func NewRuleJudge(rules ExchangeRules) *RuleJudge {
+	return &RuleJudge{
+		delta:    rules.Delta,
+		positive: wordPattern(rules.PositiveWords),
+		negative: wordPattern(rules.NegativeWords),
+	}
+}
+
+func (j *RuleJudge) Judge(unityID string, npcPersonality types.NPC, message string, reply string) (int, error) {
+	score := 0
+	if j.positive != nil {
+		score += len(j.positive.FindAllString(message, -1))
+	}
+	if j.negative != nil {
+		score -= len(j.negative.FindAllString(message, -1))
+	}
+
+	switch {
+	case score > 0:
+		return j.delta, nil
+	case score < 0:
+		return -j.delta, nil
+	}
+	return 0, nil
+}
+
+// wordPattern matches any of words as whole words, ignoring case. Nil when there are none.
+func wordPattern(words []string) *regexp.Regexp {
+	if len(words) == 0 {
+		return nil
+	}
+
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	return regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+}
+
+// LLMJudge asks a cheap model how the NPC would take the exchange
+type LLMJudge struct {
+	aiHandler *ai.AIHandler
+}
+
+func NewLLMJudge(aiHandler *ai.AIHandler) *LLMJudge {
+	return &LLMJudge{
+		aiHandler: aiHandler,
+	}
+}
+
+// judgement is what LLMJudge asks the model for
+type judgement struct {
+	Delta  int    `json:"delta" jsonschema:"minimum=-5,maximum=5,description=How much the NPC's opinion of the player changed, 0 for small talk"`
+	Reason string `json:"reason" jsonschema:"maxLength=200"`
+}
+
+func (j *LLMJudge) Judge(unityID string, npcPersonality types.NPC, message string, reply string) (int, error) {
+	result, err := ai.CompleteJSONAs[judgement](j.aiHandler, ai.UsageKey{UnityID: unityID, NpcID: npcPersonality.ID, CallType: ai.CallRelationship}, ai.JSONRequest{
+		Name: "relationship_judgement",
+		Instructions: fmt.Sprintf(
+			"You track how %s, a game character, feels about the player. %s is %s and cares about %s. "+
+				"Given what the player said and %s's reply, say how much %s's opinion of the player changed, "+
+				"from -%d (deeply hurt or offended) to %d (really touched). Most small talk changes nothing.",
+			npcPersonality.Name, npcPersonality.Name, strings.Join(npcPersonality.Traits, ", "), npcPersonality.Goals,
+			npcPersonality.Name, npcPersonality.Name, maxJudgedDelta, maxJudgedDelta,
+		),
+		Input: fmt.Sprintf("Player: %s\n%s: %s", message, npcPersonality.Name, reply),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return max(-maxJudgedDelta, min(maxJudgedDelta, result.Delta)), nil
+}
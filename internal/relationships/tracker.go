@@ -0,0 +1,222 @@
+package relationships
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/db"
+	"rd-backend/internal/types"
+	"strings"
+	"sync"
+)
+
+// ExchangeRules are the word lists RuleJudge scores the player's messages with
+type ExchangeRules struct {
+	Delta         int      `json:"delta"`
+	PositiveWords []string `json:"positive_words"`
+	NegativeWords []string `json:"negative_words"`
+}
+
+// EventRule changes the affinity of the NPC named in the event's NPCField
+type EventRule struct {
+	Delta    int    `json:"delta"`
+	NPCField string `json:"npc_field"`
+}
+
+type Config struct {
+	Exchange ExchangeRules `json:"exchange"`
+	// Events is keyed by event_type
+	Events map[string]EventRule `json:"events"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Tracker keeps each NPC's affinity with each player up to date and tells connected
+// clients when it changes. Affinity moves after conversations, through the judge, and
+// after game events, through the event rules.
+type Tracker struct {
+	dbHandler *db.DBHandler
+	npcs      *npc.NPCs
+	judge     Judge
+	events    map[string]EventRule
+
+	mu          sync.Mutex
+	subscribers map[string]map[int]func(types.RelationshipResponse)
+	nextID      int
+}
+
+func NewTracker(dbHandler *db.DBHandler, npcs *npc.NPCs, config *Config, judge Judge) *Tracker {
+	return &Tracker{
+		dbHandler:   dbHandler,
+		npcs:        npcs,
+		judge:       judge,
+		events:      config.Events,
+		subscribers: make(map[string]map[int]func(types.RelationshipResponse)),
+	}
+}
+
+// Change adds delta to the NPC's affinity with the player, moves the relationship to the
+// stage that goes with it and notifies the player's subscribers
+func (t *Tracker) Change(unityID string, npcID string, delta int) (*types.RelationshipResponse, error) {
+	change, err := t.dbHandler.ChangeAffinity(unityID, npcID, delta, npc.StageFor)
+	if err != nil {
+		return nil, err
+	}
+
+	response := types.RelationshipResponse{
+		NpcId:        npcID,
+		Affinity:     change.Affinity,
+		Delta:        delta,
+		Stage:        change.Stage,
+		StageChanged: change.StageChanged,
+	}
+	if change.StageChanged {
+		log.Printf("%s is now %s with %s (%d)", unityID, change.Stage, npcID, change.Affinity)
+	}
+
+	t.notify(unityID, response)
+	return &response, nil
+}
+
+// AfterExchange judges a chat exchange in the background. Exchanges where the NPC already
+// changed their affinity through a tool are skipped, so it isn't counted twice.
+func (t *Tracker) AfterExchange(unityID string, npcID string, message string, reply string, actions []types.ActionResponse) {
+	if t.judge == nil || strings.TrimSpace(reply) == "" {
+		return
+	}
+	for _, action := range actions {
+		if action.Name == "change_affinity" {
+			return
+		}
+	}
+
+	npcPersonality, exists := (*t.npcs)[npcID]
+	if !exists {
+		return
+	}
+
+	go func() {
+		delta, err := t.judge.Judge(unityID, npcPersonality, message, reply)
+		if err != nil {
+			log.Printf("Could not judge exchange of %s with %s: %v", unityID, npcID, err)
+			return
+		}
+		if delta == 0 {
+			return
+		}
+
+		if _, err := t.Change(unityID, npcID, delta); err != nil {
+			log.Printf("Could not change affinity of %s with %s: %v", unityID, npcID, err)
+		}
+	}()
+}
+
+// AfterEvent applies the rule for eventType, if there is one, to the NPC the event names
+func (t *Tracker) AfterEvent(unityID string, eventType string, details string) {
+	rule, exists := t.events[eventType]
+	if !exists {
+		return
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(details), &fields); err != nil {
+		return
+	}
+
+	value, _ := fields[rule.NPCField].(string)
+	npcID, found := t.findNPC(value)
+	if !found {
+		log.Printf("No NPC %q in %s event of %s", value, eventType, unityID)
+		return
+	}
+
+	if _, err := t.Change(unityID, npcID, rule.Delta); err != nil {
+		log.Printf("Could not change affinity of %s with %s: %v", unityID, npcID, err)
+	}
+}
+
+// findNPC matches the ID or name Unity used for an NPC
+func (t *Tracker) findNPC(value string) (string, bool) {
+	if _, exists := (*t.npcs)[value]; exists {
+		return value, true
+	}
+	for id, npcPersonality := range *t.npcs {
+		if strings.EqualFold(npcPersonality.Name, value) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// Subscribe calls push with every relationship change of the player until unsubscribe is called
+func (t *Tracker) Subscribe(unityID string, push func(types.RelationshipResponse)) (unsubscribe func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := t.nextID
+	t.nextID++
+
+	if t.subscribers[unityID] == nil {
+		t.subscribers[unityID] = make(map[int]func(types.RelationshipResponse))
+	}
+	t.subscribers[unityID][id] = push
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		delete(t.subscribers[unityID], id)
+		if len(t.subscribers[unityID]) == 0 {
+			delete(t.subscribers, unityID)
+		}
+	}
+}
+
+func (t *Tracker) notify(unityID string, response types.RelationshipResponse) {
+	t.mu.Lock()
+	pushes := make([]func(types.RelationshipResponse), 0, len(t.subscribers[unityID]))
+	for _, push := range t.subscribers[unityID] {
+		pushes = append(pushes, push)
+	}
+	t.mu.Unlock()
+
+	for _, push := range pushes {
+		push(response)
+	}
+}
+
+// Relationship returns the NPC's relationship with the player, a stranger if they haven't met
+func (t *Tracker) Relationship(unityID string, npcID string) (*types.DBRelationship, error) {
+	if _, exists := (*t.npcs)[npcID]; !exists {
+		return nil, fmt.Errorf("NPC with ID %s not found", npcID)
+	}
+
+	relationship, err := t.dbHandler.GetRelationship(unityID, npcID)
+	if err != nil || relationship != nil {
+		return relationship, err
+	}
+
+	return &types.DBRelationship{
+		UnityID: unityID,
+		NpcID:   npcID,
+		Stage:   npc.StageFor(0),
+	}, nil
+}
+
+// Relationships returns the relationships of every NPC that has an opinion on the player
+func (t *Tracker) Relationships(unityID string) ([]types.DBRelationship, error) {
+	return t.dbHandler.GetRelationships(unityID)
+}
@@ -0,0 +1,220 @@
+package scene
+
+import (
+	"fmt"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/schema"
+	"rd-backend/internal/types"
+	"regexp"
+	"strings"
+)
+
+// maxLinesPerRound is how often one NPC may speak between two player messages
+const maxLinesPerRound = 2
+
+// State is a scene as the director sees it. Transcript is oldest first and ends with the
+// latest line, the player's message starts the current round.
+type State struct {
+	UnityID      string
+	Participants []types.NPC
+	Transcript   []types.DBSceneLine
+}
+
+// round returns the lines since the player last spoke, the player's line first
+func (s State) round() []types.DBSceneLine {
+	for i := len(s.Transcript) - 1; i >= 0; i-- {
+		if s.Transcript[i].Speaker == types.SpeakerPlayer {
+			return s.Transcript[i:]
+		}
+	}
+	return s.Transcript
+}
+
+// Director decides who speaks next in a scene, an empty ID hands the turn back to the player
+type Director interface {
+	Next(state State) (string, error)
+}
+
+// mentions returns the participants named in text in the order they're named, leaving out exclude
+func mentions(text string, participants []types.NPC, exclude string) []string {
+	type mention struct {
+		id       string
+		position int
+	}
+
+	var found []mention
+	for _, participant := range participants {
+		if participant.ID == exclude {
+			continue
+		}
+		re := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(participant.Name) + `\b`)
+		if loc := re.FindStringIndex(text); loc != nil {
+			found = append(found, mention{participant.ID, loc[0]})
+		}
+	}
+
+	for i := 1; i < len(found); i++ {
+		for j := i; j > 0 && found[j].position < found[j-1].position; j-- {
+			found[j], found[j-1] = found[j-1], found[j]
+		}
+	}
+
+	ids := make([]string, len(found))
+	for i, m := range found {
+		ids[i] = m.id
+	}
+	return ids
+}
+
+// addressed returns who the player spoke to that hasn't answered yet this round
+func addressed(state State) string {
+	round := state.round()
+	if len(round) == 0 {
+		return ""
+	}
+
+	spoken := make(map[string]bool)
+	for _, line := range round[1:] {
+		spoken[line.Speaker] = true
+	}
+	for _, id := range mentions(round[0].Text, state.Participants, "") {
+		if !spoken[id] {
+			return id
+		}
+	}
+	return ""
+}
+
+// leastRecent returns the participant who spoke longest ago, or never
+func leastRecent(state State) string {
+	lastSpoke := make(map[string]int)
+	for i, line := range state.Transcript {
+		lastSpoke[line.Speaker] = i + 1
+	}
+
+	best := ""
+	for _, participant := range state.Participants {
+		if best == "" || lastSpoke[participant.ID] < lastSpoke[best] {
+			best = participant.ID
+		}
+	}
+	return best
+}
+
+// canSpeak is whether id may take the next line: not twice in a row, not too often per round
+func canSpeak(state State, id string) bool {
+	round := state.round()
+	if id == "" || round[len(round)-1].Speaker == id {
+		return false
+	}
+
+	count := 0
+	for _, line := range round {
+		if line.Speaker == id {
+			count++
+		}
+	}
+	return count < maxLinesPerRound
+}
+
+// RuleDirector lets the NPCs the player names answer in the order they're named, or the one
+// who's been quiet longest when nobody is named. After that NPCs answer each other when named.
+type RuleDirector struct{}
+
+func (RuleDirector) Next(state State) (string, error) {
+	if len(state.Transcript) == 0 {
+		return "", nil
+	}
+
+	if id := addressed(state); id != "" {
+		return id, nil
+	}
+
+	round := state.round()
+	if len(round) == 1 {
+		return leastRecent(state), nil
+	}
+
+	last := round[len(round)-1]
+	for _, id := range mentions(last.Text, state.Participants, last.Speaker) {
+		if canSpeak(state, id) {
+			return id, nil
+		}
+	}
+	return "", nil
+}
+
+// LLMDirector lets the NPCs the player names answer first, then asks a model whether anyone
+// would naturally chime in
+type LLMDirector struct {
+	aiHandler *ai.AIHandler
+}
+
+func NewLLMDirector(aiHandler *ai.AIHandler) *LLMDirector {
+	return &LLMDirector{
+		aiHandler: aiHandler,
+	}
+}
+
+// pick is what LLMDirector asks the model for, Next is limited to the participants and "none"
+type pick struct {
+	Next string `json:"next"`
+}
+
+func (d *LLMDirector) Next(state State) (string, error) {
+	if len(state.Transcript) == 0 {
+		return "", nil
+	}
+
+	if id := addressed(state); id != "" {
+		return id, nil
+	}
+
+	names := make(map[string]string, len(state.Participants)+1)
+	names[types.SpeakerPlayer] = "Player"
+	choices := []string{"none"}
+	var cast strings.Builder
+	for _, participant := range state.Participants {
+		names[participant.ID] = participant.Name
+		if canSpeak(state, participant.ID) {
+			choices = append(choices, participant.ID)
+			fmt.Fprintf(&cast, "- %s (%s): %s, %s\n", participant.ID, participant.Name, participant.Occupation, strings.Join(participant.Traits, ", "))
+		}
+	}
+	if len(choices) == 1 {
+		return "", nil
+	}
+
+	var transcript strings.Builder
+	for _, line := range state.Transcript {
+		fmt.Fprintf(&transcript, "%s: %s\n", names[line.Speaker], line.Text)
+	}
+
+	request := ai.JSONRequest{
+		Name: "next_speaker",
+		Instructions: "You direct a group conversation between the player and characters in a life-sim game. " +
+			"Pick who would naturally speak next, or none if the conversation is waiting on the player. " +
+			"Someone who was just asked something or talked about should answer; don't drag the scene out. " +
+			"Characters who can speak:\n" + cast.String(),
+		Input: transcript.String(),
+	}
+
+	s, err := schema.For(pick{})
+	if err != nil {
+		return "", err
+	}
+	for _, choice := range choices {
+		s.Properties["next"].Enum = append(s.Properties["next"].Enum, choice)
+	}
+	request.Schema = s
+
+	result, err := ai.CompleteJSONAs[pick](d.aiHandler, ai.UsageKey{UnityID: state.UnityID, CallType: ai.CallDirector}, request)
+	if err != nil {
+		return "", err
+	}
+
+	if result.Next == "none" {
+		return "", nil
+	}
+	return result.Next, nil
+}
@@ -0,0 +1,214 @@
+package scene
+
+import (
+	"fmt"
+	"log"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/db"
+	"rd-backend/internal/memory"
+	"rd-backend/internal/types"
+	"strings"
+)
+
+const (
+	// MaxParticipants keeps scenes small enough to follow, and the model calls per message down
+	MaxParticipants = 4
+	// DefaultMaxTurns is how many NPC lines may follow one player message
+	DefaultMaxTurns = 4
+	// sceneHistory is how many lines of the scene are loaded for context
+	sceneHistory = 30
+	// eventCandidates is how far back to look for the player's events
+	eventCandidates = 20
+)
+
+// Orchestrator runs group conversations: it stores the scene, asks the director who speaks
+// and gets each NPC's line in turn
+type Orchestrator struct {
+	dbHandler  *db.DBHandler
+	aiHandler  *ai.AIHandler
+	summarizer *memory.Summarizer
+	indexer    *memory.Indexer
+	npcs       *npc.NPCs
+	director   Director
+	maxTurns   int
+}
+
+func NewOrchestrator(dbHandler *db.DBHandler, aiHandler *ai.AIHandler, summarizer *memory.Summarizer, indexer *memory.Indexer, npcs *npc.NPCs, director Director, maxTurns int) *Orchestrator {
+	if maxTurns <= 0 {
+		maxTurns = DefaultMaxTurns
+	}
+
+	return &Orchestrator{
+		dbHandler:  dbHandler,
+		aiHandler:  aiHandler,
+		summarizer: summarizer,
+		indexer:    indexer,
+		npcs:       npcs,
+		director:   director,
+		maxTurns:   maxTurns,
+	}
+}
+
+// Scene returns the player's scene with sceneID, or starts a new one with npcIDs when sceneID is 0
+func (o *Orchestrator) Scene(unityID string, sceneID int, npcIDs []string, location string) (*types.DBScene, error) {
+	if sceneID != 0 {
+		scene, err := o.dbHandler.GetScene(sceneID)
+		if err != nil {
+			return nil, err
+		}
+		if scene == nil || scene.UnityID != unityID {
+			return nil, fmt.Errorf("scene %d not found", sceneID)
+		}
+		return scene, nil
+	}
+
+	participants := make([]string, 0, len(npcIDs))
+	seen := make(map[string]bool)
+	for _, id := range npcIDs {
+		if _, exists := (*o.npcs)[id]; !exists {
+			return nil, fmt.Errorf("NPC with ID %s not found", id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			participants = append(participants, id)
+		}
+	}
+	if len(participants) < 2 {
+		return nil, fmt.Errorf("a group conversation needs at least 2 NPCs")
+	}
+	if len(participants) > MaxParticipants {
+		return nil, fmt.Errorf("a group conversation can have at most %d NPCs", MaxParticipants)
+	}
+
+	id, err := o.dbHandler.CreateScene(unityID, participants, location)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.DBScene{
+		ID:           id,
+		UnityID:      unityID,
+		Participants: participants,
+		Location:     location,
+	}, nil
+}
+
+// Play adds the player's message to the scene and lets NPCs answer until the director hands
+// the turn back to the player. onLine is called with every NPC line as soon as it's ready.
+// It returns how many lines were said.
+func (o *Orchestrator) Play(scene *types.DBScene, text string, onLine func(npcID string, result *ai.ChatResult) error) (int, error) {
+	participants := make([]types.NPC, 0, len(scene.Participants))
+	for _, id := range scene.Participants {
+		if npcPersonality, exists := (*o.npcs)[id]; exists {
+			participants = append(participants, npcPersonality)
+		}
+	}
+	if len(participants) == 0 {
+		return 0, fmt.Errorf("scene %d has no NPCs left", scene.ID)
+	}
+
+	// Whoever is first deflects a message that fails moderation, it doesn't go into the scene
+	text, blocked := o.aiHandler.ModerateInput(scene.UnityID, participants[0].ID, text)
+	if blocked {
+		return 1, onLine(participants[0].ID, &ai.ChatResult{Completion: text, Moderated: true})
+	}
+
+	transcript, err := o.dbHandler.GetSceneLines(scene.ID, sceneHistory)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := o.dbHandler.AddSceneLine(scene.ID, types.SpeakerPlayer, text); err != nil {
+		return 0, err
+	}
+	transcript = append(transcript, types.DBSceneLine{SceneID: scene.ID, Speaker: types.SpeakerPlayer, Text: text})
+	round := len(transcript) - 1
+
+	eventHistory, err := o.dbHandler.GetLastEventsFromDB(scene.UnityID, eventCandidates)
+	if err != nil {
+		log.Printf("Could not get events for scene %d: %v", scene.ID, err)
+	}
+
+	state := State{
+		UnityID:      scene.UnityID,
+		Participants: participants,
+		Transcript:   transcript,
+	}
+
+	turns := 0
+	for turns < o.maxTurns {
+		next, err := o.director.Next(state)
+		if err != nil {
+			log.Printf("Director failed in scene %d, using the rules: %v", scene.ID, err)
+			next, _ = RuleDirector{}.Next(state)
+		}
+		if next == "" || !o.inScene(scene, next) || !canSpeak(state, next) {
+			break
+		}
+
+		result, err := o.aiHandler.GetGroupChatCompletion(scene.UnityID, next, *scene, state.Transcript, eventHistory, o.summarizer.Summary(scene.UnityID, next))
+		if err != nil {
+			if turns == 0 {
+				return 0, err
+			}
+			log.Printf("Could not get %s's line in scene %d: %v", next, scene.ID, err)
+			break
+		}
+		if strings.TrimSpace(result.Completion) == "" {
+			break
+		}
+
+		if err := o.dbHandler.AddSceneLine(scene.ID, next, result.Completion); err != nil {
+			log.Printf("Could not save %s's line in scene %d: %v", next, scene.ID, err)
+		}
+		state.Transcript = append(state.Transcript, types.DBSceneLine{SceneID: scene.ID, Speaker: next, Text: result.Completion})
+		turns++
+
+		if err := onLine(next, result); err != nil {
+			break
+		}
+	}
+
+	o.remember(scene, participants, state.Transcript[round:])
+	return turns, nil
+}
+
+func (o *Orchestrator) inScene(scene *types.DBScene, npcID string) bool {
+	for _, id := range scene.Participants {
+		if id == npcID {
+			return true
+		}
+	}
+	return false
+}
+
+// remember gives every NPC in the scene a memory of the round, so they can bring it up later
+// whether they spoke or just listened
+func (o *Orchestrator) remember(scene *types.DBScene, participants []types.NPC, lines []types.DBSceneLine) {
+	names := map[string]string{types.SpeakerPlayer: "Player"}
+	for _, participant := range participants {
+		names[participant.ID] = participant.Name
+	}
+
+	said := make([]string, len(lines))
+	for i, line := range lines {
+		said[i] = names[line.Speaker] + ": " + line.Text
+	}
+
+	for _, participant := range participants {
+		others := make([]string, 0, len(participants)-1)
+		for _, other := range participants {
+			if other.ID != participant.ID {
+				others = append(others, other.Name)
+			}
+		}
+
+		where := ""
+		if scene.Location != "" {
+			where = " at " + scene.Location
+		}
+		recap := fmt.Sprintf("in a group conversation with the player and %s%s: %s", strings.Join(others, " and "), where, strings.Join(said, " / "))
+		o.indexer.Remember(scene.UnityID, participant.ID, types.MemoryKindScene, recap)
+	}
+}
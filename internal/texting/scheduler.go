@@ -0,0 +1,279 @@
+package texting
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/clock"
+	"rd-backend/internal/db"
+	"rd-backend/internal/types"
+	"slices"
+	"sort"
+	"time"
+)
+
+type Config struct {
+	// IntervalSeconds is how often triggers are checked
+	IntervalSeconds int `json:"interval_seconds"`
+	// PlayerDailyCap is the most texts all NPCs together start with one player a day, 0 for no cap
+	PlayerDailyCap int `json:"player_daily_cap"`
+	// EventMaxAgeMinutes is how old an event can be and still set a trigger off, so NPCs
+	// don't bring up old news after a restart
+	EventMaxAgeMinutes int `json:"event_max_age_minutes"`
+	// History is how many of the last texts with the player the NPC sees
+	History int `json:"history"`
+	// RetryMinutes is how long a trigger waits after its text couldn't be sent, doubling with
+	// every failure up to a day, so a broken sender doesn't cost a model call every check
+	RetryMinutes int `json:"retry_minutes"`
+}
+
+// maxRetryDelay caps the wait after repeated failures to send
+const maxRetryDelay = 24 * time.Hour
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Sender sends an SMS from an NPC's number to a player's
+type Sender interface {
+	SendSMS(from string, to string, message string) error
+}
+
+// Scheduler has NPCs text players first when one of the triggers in their texting config
+// fires, within the trigger's cooldown and limits and the daily caps
+type Scheduler struct {
+	dbHandler *db.DBHandler
+	aiHandler *ai.AIHandler
+	npcs      *npc.NPCs
+	clock     *clock.Clock
+	sender    Sender
+	config    Config
+	// retries are the triggers whose text couldn't be sent, by player, NPC and trigger. Only
+	// the Check loop touches them.
+	retries map[string]retry
+}
+
+// retry is when a trigger may try again after failures in a row
+type retry struct {
+	at       time.Time
+	failures int
+}
+
+func NewScheduler(dbHandler *db.DBHandler, aiHandler *ai.AIHandler, npcs *npc.NPCs, clock *clock.Clock, sender Sender, config Config) *Scheduler {
+	return &Scheduler{
+		dbHandler: dbHandler,
+		aiHandler: aiHandler,
+		npcs:      npcs,
+		clock:     clock,
+		sender:    sender,
+		config:    config,
+		retries:   make(map[string]retry),
+	}
+}
+
+// Start checks the triggers every interval in the background
+func (s *Scheduler) Start() {
+	interval := time.Duration(s.config.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.Check()
+		}
+	}()
+}
+
+// Check goes through every player with a phone number. Each NPC texts a player at most once
+// per check, for the first of their triggers that fires.
+func (s *Scheduler) Check() {
+	players, err := s.dbHandler.GetTextablePlayers()
+	if err != nil {
+		log.Printf("Could not get players to text: %v", err)
+		return
+	}
+
+	// Same order every check, so earlier NPCs don't lose out to map order under the caps
+	ids := make([]string, 0, len(*s.npcs))
+	for id, npcPersonality := range *s.npcs {
+		if npcPersonality.Texting != nil && npcPersonality.PhoneNumber != "" {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, player := range players {
+		s.checkPlayer(player, ids)
+	}
+}
+
+func (s *Scheduler) checkPlayer(player types.Player, ids []string) {
+	dayAgo := time.Now().Add(-24 * time.Hour)
+
+	sentToday, err := s.dbHandler.CountTextTriggers(player.UnityID, "", dayAgo)
+	if err != nil {
+		log.Printf("Could not count texts to %s: %v", player.UnityID, err)
+		return
+	}
+
+	for _, id := range ids {
+		if s.config.PlayerDailyCap > 0 && sentToday >= s.config.PlayerDailyCap {
+			return
+		}
+
+		npcPersonality := (*s.npcs)[id]
+		if dailyCap := npcPersonality.Texting.DailyCap; dailyCap > 0 {
+			sent, err := s.dbHandler.CountTextTriggers(player.UnityID, id, dayAgo)
+			if err != nil {
+				log.Printf("Could not count texts from %s to %s: %v", id, player.UnityID, err)
+				continue
+			}
+			if sent >= dailyCap {
+				continue
+			}
+		}
+
+		for _, trigger := range npcPersonality.Texting.Triggers {
+			if s.waiting(retryKey(player, npcPersonality, trigger)) || !s.due(player, npcPersonality, trigger) {
+				continue
+			}
+			if s.text(player, npcPersonality, trigger) {
+				sentToday++
+			}
+			break
+		}
+	}
+}
+
+// due is whether the trigger fires for the player and is outside its cooldown and limit
+func (s *Scheduler) due(player types.Player, npcPersonality types.NPC, trigger types.TextTrigger) bool {
+	count, last, err := s.dbHandler.GetTextTrigger(player.UnityID, npcPersonality.ID, trigger.ID)
+	if err != nil {
+		log.Printf("Could not get trigger %s of %s: %v", trigger.ID, npcPersonality.ID, err)
+		return false
+	}
+
+	if trigger.MaxPerPlayer > 0 && count >= trigger.MaxPerPlayer {
+		return false
+	}
+	cooldown := time.Duration(trigger.CooldownMinutes) * time.Minute
+	if !last.IsZero() && time.Since(last) < cooldown {
+		return false
+	}
+
+	switch trigger.Kind {
+	case types.TriggerTime:
+		minute, known := s.clock.Now(player.UnityID)
+		return known && npc.Between(trigger.From, trigger.To, minute)
+
+	case types.TriggerInactivity:
+		active, err := s.dbHandler.GetLastActivity(player.UnityID)
+		if err != nil {
+			log.Printf("Could not get last activity of %s: %v", player.UnityID, err)
+			return false
+		}
+		// Once per absence, players who never played aren't missed
+		inactive := time.Duration(trigger.InactiveHours) * time.Hour
+		return !active.IsZero() && time.Since(active) >= inactive && last.Before(active)
+
+	case types.TriggerEvent:
+		event, err := s.dbHandler.GetLatestEvent(player.UnityID, trigger.EventType)
+		if err != nil {
+			log.Printf("Could not get %s events of %s: %v", trigger.EventType, player.UnityID, err)
+			return false
+		}
+		maxAge := time.Duration(s.config.EventMaxAgeMinutes) * time.Minute
+		return event != nil && event.CreatedAt.After(last) && time.Since(event.CreatedAt) <= maxAge
+
+	case types.TriggerAffinity:
+		// Milestones are only reached once
+		if count > 0 {
+			return false
+		}
+		relationship, err := s.dbHandler.GetRelationship(player.UnityID, npcPersonality.ID)
+		if err != nil {
+			log.Printf("Could not get relationship of %s with %s: %v", player.UnityID, npcPersonality.ID, err)
+			return false
+		}
+		return relationship != nil && npc.StageRank(relationship.Stage) >= npc.StageRank(trigger.Stage)
+	}
+
+	return false
+}
+
+func retryKey(player types.Player, npcPersonality types.NPC, trigger types.TextTrigger) string {
+	return player.UnityID + "/" + npcPersonality.ID + "/" + trigger.ID
+}
+
+// waiting is whether the trigger's last text couldn't be sent and it's too soon to try again
+func (s *Scheduler) waiting(key string) bool {
+	next, exists := s.retries[key]
+	return exists && time.Now().Before(next.at)
+}
+
+// failed backs the trigger off after its text couldn't be sent
+func (s *Scheduler) failed(key string) {
+	next := s.retries[key]
+	next.failures++
+
+	delay := time.Duration(s.config.RetryMinutes) * time.Minute << (next.failures - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	next.at = time.Now().Add(delay)
+	s.retries[key] = next
+}
+
+// text has the NPC write and send the text, returning whether it went out. A trigger whose
+// text fails moderation still counts as fired so it isn't written again on every check.
+func (s *Scheduler) text(player types.Player, npcPersonality types.NPC, trigger types.TextTrigger) bool {
+	history, err := s.dbHandler.GetLastTextsFromDB(player.UnityID, npcPersonality.PhoneNumber, s.config.History)
+	if err != nil {
+		log.Printf("Could not get texts between %s and %s: %v", npcPersonality.ID, player.UnityID, err)
+		return false
+	}
+	// Newest first from the database
+	slices.Reverse(history)
+
+	text, ok, err := s.aiHandler.ComposeText(player.UnityID, npcPersonality.ID, trigger.Prompt, history, player.PhoneNumber)
+	if err != nil {
+		log.Printf("Could not write %s text from %s to %s: %v", trigger.ID, npcPersonality.ID, player.UnityID, err)
+		return false
+	}
+
+	key := retryKey(player, npcPersonality, trigger)
+	if ok {
+		if err := s.sender.SendSMS(npcPersonality.PhoneNumber, player.PhoneNumber, text); err != nil {
+			log.Printf("Could not send %s text from %s to %s: %v", trigger.ID, npcPersonality.ID, player.UnityID, err)
+			s.failed(key)
+			return false
+		}
+		delete(s.retries, key)
+		if err := s.dbHandler.AddTextToDatabase(player.UnityID, text, npcPersonality.PhoneNumber, player.PhoneNumber, player.PhoneNumber); err != nil {
+			log.Printf("Could not store text from %s to %s: %v", npcPersonality.ID, player.UnityID, err)
+		}
+		log.Printf("%s texted %s (%s): %s", npcPersonality.ID, player.UnityID, trigger.ID, text)
+	} else {
+		log.Printf("Dropped %s text from %s to %s, it failed moderation", trigger.ID, npcPersonality.ID, player.UnityID)
+	}
+
+	if err := s.dbHandler.AddTextTrigger(player.UnityID, npcPersonality.ID, trigger.ID); err != nil {
+		log.Printf("Could not record trigger %s of %s: %v", trigger.ID, npcPersonality.ID, err)
+	}
+	return ok
+}
@@ -12,6 +12,35 @@ type ChatMessage struct {
 	UnityID string `json:"unity_id"`
 	Text    string `json:"text"`
 	NpcId   string `json:"npcId"`
+	Stream  bool   `json:"stream,omitempty"`
+	// Suggestions is how many replies to suggest for the player's next line, 2 to 4, 0 for none
+	Suggestions int `json:"suggestions,omitempty"`
+}
+
+// SuggestMessage asks for reply suggestions without sending anything to the NPC, e.g. before
+// the player has said a word
+type SuggestMessage struct {
+	UnityID string `json:"unity_id"`
+	NpcId   string `json:"npcId"`
+	Count   int    `json:"count,omitempty"`
+}
+
+// GroupChatMessage is the player talking to several NPCs at once. SceneId continues an
+// earlier scene, leave it out to start a new one.
+type GroupChatMessage struct {
+	UnityID  string   `json:"unity_id"`
+	Text     string   `json:"text"`
+	NpcIds   []string `json:"npcIds"`
+	SceneId  int      `json:"scene_id,omitempty"`
+	Location string   `json:"location,omitempty"`
+}
+
+// ClockMessage reports the player's game time as "HH:MM". Scale is how many game minutes pass
+// per real minute, so the server can keep time between reports; 0 holds the time until the next one.
+type ClockMessage struct {
+	UnityID string  `json:"unity_id"`
+	Time    string  `json:"time"`
+	Scale   float64 `json:"scale,omitempty"`
 }
 
 type EventMessage struct {
@@ -29,8 +58,88 @@ type WSResponse struct {
 type ChatResponse struct {
 	Completion string `json:"completion"`
 	NpcId      string `json:"npcId"`
+	// SceneId is set for lines of a group conversation
+	SceneId int `json:"scene_id,omitempty"`
+	// Emotion, intensity and gesture for the NPC's animation, left out when untagged
+	*Expression
+	// RetryAfter is set, in seconds, when the player hit a limit and the NPC is taking a break
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Suggestions are what the player could say next, when the chat message asked for them
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// Suggestion is a line the player could say, Tone labels it on the dialogue wheel
+type Suggestion struct {
+	Text string `json:"text"`
+	Tone string `json:"tone"`
+}
+
+// Answers a "suggest" message
+type SuggestionsResponse struct {
+	NpcId       string       `json:"npcId"`
+	Suggestions []Suggestion `json:"suggestions"`
+	// RetryAfter is set, in seconds, when the player hit a limit and got no suggestions
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// Sent for every chunk of a streamed completion
+type ChatDeltaResponse struct {
+	MessageID string `json:"message_id"`
+	NpcId     string `json:"npcId"`
+	Delta     string `json:"delta"`
+}
+
+// Sent once a streamed completion finishes, carrying the full text
+type ChatDoneResponse struct {
+	MessageID  string `json:"message_id"`
+	NpcId      string `json:"npcId"`
+	Completion string `json:"completion"`
+	Aborted    bool   `json:"aborted,omitempty"`
+	// Replaced means moderation changed the line, show Completion instead of the streamed text
+	Replaced bool `json:"replaced,omitempty"`
+	*Expression
+	// RetryAfter is set, in seconds, when the player hit a limit and the NPC is taking a break
+	RetryAfter int `json:"retry_after,omitempty"`
+	// Suggestions are what the player could say next, when the chat message asked for them
+	Suggestions []Suggestion `json:"suggestions,omitempty"`
+}
+
+// Sent for every game action an NPC takes, before the line they speak
+type ActionResponse struct {
+	NpcId     string          `json:"npcId"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
 }
 
 type EventResponse struct {
 	EventType string `json:"event_type"`
 }
+
+// Expression is how an NPC delivers a line, for Unity to pick an animation
+type Expression struct {
+	Emotion string `json:"emotion"`
+	// Intensity goes from 0 (barely) to 1 (as strong as it gets)
+	Intensity float64 `json:"intensity"`
+	Gesture   string  `json:"gesture,omitempty"`
+}
+
+// Pushed whenever an NPC's feelings about the player change
+type RelationshipResponse struct {
+	NpcId    string `json:"npcId"`
+	Affinity int    `json:"affinity"`
+	Delta    int    `json:"delta"`
+	Stage    string `json:"stage"`
+	// StageChanged is set when this change moved the relationship to a new stage
+	StageChanged bool `json:"stage_changed,omitempty"`
+}
+
+// Sent after the last NPC line of a group conversation, the player's turn again
+type GroupDoneResponse struct {
+	SceneId int `json:"scene_id"`
+	// Turns is how many NPC lines were sent
+	Turns int `json:"turns"`
+}
+
+type ClockResponse struct {
+	Time string `json:"time"`
+}
@@ -1,24 +1,101 @@
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Player struct {
 	ID          string `json:"_id,omitempty" db:"id"`
 	UnityID     string `json:"unity_id" db:"unity_id"`
 	PhoneNumber string `json:"phone_number" db:"phone_number"`
+	// Tier picks the player's daily message quotas, see limits.json
+	Tier string `json:"tier" db:"tier"`
 }
 
 type NPC struct {
-	ID          string   `json:"npc_id"`
-	Name        string   `json:"name"`
-	PhoneNumber string   `json:"phone_number"`
-	Location    string   `json:"location"`
-	Occupation  string   `json:"occupation"`
-	Traits      []string `json:"traits"`
-	Quirks      []string `json:"quirks"`
-	Goals       string   `json:"goals"`
-	Backstory   string   `json:"backstory"`
-	SpeechStyle string   `json:"speech_style"`
+	ID          string    `json:"npc_id"`
+	Name        string    `json:"name"`
+	PhoneNumber string    `json:"npc_phone_number"`
+	Location    string    `json:"location"`
+	Occupation  string    `json:"occupation"`
+	Traits      []string  `json:"traits"`
+	Quirks      []string  `json:"quirks"`
+	Goals       string    `json:"goals"`
+	Backstory   string    `json:"backstory"`
+	SpeechStyle string    `json:"speech_style"`
+	Model       *NPCModel `json:"model,omitempty"`
+	// Tools are the names of the game actions this NPC may take, see tools.json
+	Tools []string `json:"tools,omitempty"`
+	// Deflections are in-character lines used in place of replies that fail moderation
+	Deflections []string `json:"deflections,omitempty"`
+	// BreakLines are what the NPC says when the player has hit their message limit
+	BreakLines []string `json:"break_lines,omitempty"`
+	// RelationshipTones is how the NPC acts towards the player at each relationship stage,
+	// stages left out use a generic tone
+	RelationshipTones map[string]string `json:"relationship_tones,omitempty"`
+	// Schedule is where the NPC is through the game day, Location is used outside of it
+	Schedule []ScheduleEntry `json:"schedule,omitempty"`
+	// Texting is when the NPC texts the player first, nil if they never do
+	Texting *Texting `json:"texting,omitempty"`
+}
+
+// Texting is the NPC's text triggers. DailyCap is the most texts they start with one
+// player a day, 0 for no cap.
+type Texting struct {
+	DailyCap int           `json:"daily_cap"`
+	Triggers []TextTrigger `json:"triggers"`
+}
+
+// Text trigger kinds
+const (
+	// TriggerTime fires while the player's game time is between From and To
+	TriggerTime = "time"
+	// TriggerInactivity fires once the player has done nothing for InactiveHours
+	TriggerInactivity = "inactivity"
+	// TriggerEvent fires after the player has an event of EventType
+	TriggerEvent = "event"
+	// TriggerAffinity fires once the relationship reaches Stage
+	TriggerAffinity = "affinity"
+)
+
+// TextTrigger is a reason for the NPC to text the player. Prompt tells the model what the text
+// is about. A trigger fires at most once every CooldownMinutes and MaxPerPlayer times a player,
+// 0 for no limit.
+type TextTrigger struct {
+	ID              string `json:"id"`
+	Kind            string `json:"kind"`
+	From            string `json:"from,omitempty"`
+	To              string `json:"to,omitempty"`
+	InactiveHours   int    `json:"inactive_hours,omitempty"`
+	EventType       string `json:"event_type,omitempty"`
+	Stage           string `json:"stage,omitempty"`
+	Prompt          string `json:"prompt"`
+	CooldownMinutes int    `json:"cooldown_minutes"`
+	MaxPerPlayer    int    `json:"max_per_player"`
+}
+
+// ScheduleEntry is a stretch of the game day from From to To ("HH:MM"), which may run past midnight
+type ScheduleEntry struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Location string `json:"location"`
+	Activity string `json:"activity"`
+}
+
+// ToolDefinition describes a game action NPCs can take. Parameters is the JSON Schema
+// the arguments are validated against.
+type ToolDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// NPCModel overrides the default roleplay model and sampling for a single NPC
+type NPCModel struct {
+	ModelName     string   `json:"model_name,omitempty"`
+	ProviderOrder []string `json:"provider_order,omitempty"`
+	SamplingParams
 }
 
 type DBChatMessage struct {
@@ -47,3 +124,167 @@ type DBPlayerEvent struct {
 	EventDetails string    `json:"event_details" db:"event_details"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 }
+
+type DBConversationSummary struct {
+	ID            string    `json:"_id,omitempty" db:"id"`
+	UnityID       string    `json:"unity_id" db:"unity_id"`
+	NpcID         string    `json:"npc_id" db:"npc_id"`
+	Summary       string    `json:"summary" db:"summary"`
+	LastMessageID int       `json:"last_message_id" db:"last_message_id"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// DBMemory kinds
+const (
+	MemoryKindPlayer = "player"
+	MemoryKindNPC    = "npc"
+	MemoryKindEvent  = "event"
+	MemoryKindScene  = "scene"
+)
+
+type DBMemory struct {
+	ID      string `json:"_id,omitempty" db:"id"`
+	UnityID string `json:"unity_id" db:"unity_id"`
+	// NpcID is empty for memories every NPC shares, like player events
+	NpcID     string    `json:"npc_id" db:"npc_id"`
+	Kind      string    `json:"kind" db:"kind"`
+	Content   string    `json:"content" db:"content"`
+	Embedding []float32 `json:"-" db:"embedding"`
+	// Similarity to the search query, only set by searches
+	Similarity float64   `json:"similarity,omitempty"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+type DBPlayerFlag struct {
+	UnityID   string    `json:"unity_id" db:"unity_id"`
+	Flag      string    `json:"flag" db:"flag"`
+	Value     string    `json:"value" db:"value"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// DBUsage is the token usage of a single model call
+type DBUsage struct {
+	ID               string `json:"_id,omitempty" db:"id"`
+	UnityID          string `json:"unity_id" db:"unity_id"`
+	NpcID            string `json:"npc_id" db:"npc_id"`
+	Model            string `json:"model" db:"model"`
+	CallType         string `json:"call_type" db:"call_type"`
+	GenerationID     string `json:"generation_id" db:"generation_id"`
+	PromptTokens     int    `json:"prompt_tokens" db:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens" db:"completion_tokens"`
+	// Cost is in USD, nil when the provider didn't report it
+	Cost *float64 `json:"cost,omitempty" db:"cost"`
+	// Estimated is set when the provider reported no usage and the tokens were counted here
+	Estimated bool      `json:"estimated" db:"estimated"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// UsageTotal adds up usage for one day and one NPC, model or player
+type UsageTotal struct {
+	Day              string  `json:"day"`
+	Key              string  `json:"key"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	// EstimatedCalls are the calls whose tokens were estimated, their cost isn't known
+	EstimatedCalls int `json:"estimated_calls"`
+}
+
+// FlagCount is how often a player's messages, or the NPCs' replies to them, were flagged in one category
+type FlagCount struct {
+	UnityID  string    `json:"id"`
+	Category string    `json:"category"`
+	Count    int       `json:"count"`
+	Last     time.Time `json:"last"`
+}
+
+// DBRelationship is how an NPC feels about a player. Stage follows from Affinity.
+type DBRelationship struct {
+	UnityID   string    `json:"unity_id" db:"unity_id"`
+	NpcID     string    `json:"npc_id" db:"npc_id"`
+	Affinity  int       `json:"affinity" db:"affinity"`
+	Stage     string    `json:"stage" db:"stage"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// DBKnowledge is something an NPC knows the player did, either because they saw it or
+// because another NPC told them
+type DBKnowledge struct {
+	ID      string `json:"_id,omitempty" db:"id"`
+	UnityID string `json:"unity_id" db:"unity_id"`
+	NpcID   string `json:"npc_id" db:"npc_id"`
+	EventID int    `json:"event_id" db:"event_id"`
+	// Content is the event as the NPC knows it, retellings get details wrong
+	Content string `json:"content" db:"content"`
+	// SourceNpcID is who told them, empty when they witnessed it
+	SourceNpcID string `json:"source_npc_id,omitempty" db:"source_npc_id"`
+	// Hops is how many retellings away from a witness this is
+	Hops      int       `json:"hops" db:"hops"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// DBScene is a group conversation between the player and several NPCs
+type DBScene struct {
+	ID           int       `json:"id" db:"id"`
+	UnityID      string    `json:"unity_id" db:"unity_id"`
+	Participants []string  `json:"participants" db:"participants"`
+	Location     string    `json:"location,omitempty" db:"location"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// SpeakerPlayer is the Speaker of the player's lines in a scene
+const SpeakerPlayer = "player"
+
+// DBSceneLine is one line of a group conversation, Speaker is SpeakerPlayer or an NPC ID
+type DBSceneLine struct {
+	ID        int       `json:"id" db:"id"`
+	SceneID   int       `json:"scene_id" db:"scene_id"`
+	Speaker   string    `json:"speaker" db:"speaker"`
+	Text      string    `json:"text" db:"text"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Quest states. Offered quests wait for the player to accept, accepted ones move to in progress
+// with the first step done and end complete or failed.
+const (
+	QuestOffered    = "offered"
+	QuestAccepted   = "accepted"
+	QuestInProgress = "in_progress"
+	QuestComplete   = "complete"
+	QuestFailed     = "failed"
+)
+
+// DBQuest is a quest an NPC gave a player. Step is the index of the current step and Progress
+// how many of its events have happened so far.
+type DBQuest struct {
+	ID      int          `json:"id" db:"id"`
+	UnityID string       `json:"unity_id" db:"unity_id"`
+	NpcID   string       `json:"npc_id" db:"npc_id"`
+	Title   string       `json:"title" db:"title"`
+	Summary string       `json:"summary" db:"summary"`
+	Steps   []QuestStep  `json:"steps" db:"steps"`
+	Rewards QuestRewards `json:"rewards" db:"rewards"`
+	// FailEventType is the event that fails the quest, empty if nothing does
+	FailEventType string    `json:"fail_event_type,omitempty" db:"fail_event_type"`
+	State         string    `json:"state" db:"state"`
+	Step          int       `json:"step" db:"step"`
+	Progress      int       `json:"progress" db:"progress"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// QuestStep is done after Count events of EventType. When Target is set one of the event's
+// fields has to be it, like the item picked up or the location entered.
+type QuestStep struct {
+	Description string `json:"description"`
+	EventType   string `json:"event_type"`
+	Target      string `json:"target,omitempty"`
+	Count       int    `json:"count"`
+}
+
+// QuestRewards are handed out by the game when the quest is complete
+type QuestRewards struct {
+	Items []string `json:"items,omitempty"`
+	Coins int      `json:"coins,omitempty"`
+}
@@ -1,9 +1,44 @@
 // types/openrouter.go
 package types
 
+import "encoding/json"
+
 type OpenRouterMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Tool calling
+type ToolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type Tool struct {
+	Type     string       `json:"type"`
+	Function ToolFunction `json:"function"`
+}
+
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallDelta is a fragment of a tool call in a stream, fragments with the same index add up
+type ToolCallDelta struct {
+	Index    int              `json:"index"`
+	ID       string           `json:"id,omitempty"`
+	Type     string           `json:"type,omitempty"`
+	Function ToolCallFunction `json:"function"`
 }
 
 type OpenRouterChoice struct {
@@ -11,7 +46,45 @@ type OpenRouterChoice struct {
 }
 
 type OpenRouterResponse struct {
+	// ID is the generation ID, Model the model that actually answered
+	ID      string             `json:"id,omitempty"`
+	Model   string             `json:"model,omitempty"`
 	Choices []OpenRouterChoice `json:"choices"`
+	Usage   *Usage             `json:"usage,omitempty"`
+}
+
+// Usage is the token count of a completion. Cost is in USD and only set by providers
+// that report it, like OpenRouter with usage accounting on.
+type Usage struct {
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	TotalTokens      int      `json:"total_tokens"`
+	Cost             *float64 `json:"cost,omitempty"`
+}
+
+// Streaming (SSE) chunks
+type OpenRouterDelta struct {
+	Content   string          `json:"content"`
+	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+type OpenRouterStreamChoice struct {
+	Delta        OpenRouterDelta `json:"delta"`
+	FinishReason *string         `json:"finish_reason"`
+}
+
+type OpenRouterStreamError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// The usage arrives in the last chunk, which has no choices
+type OpenRouterStreamChunk struct {
+	ID      string                   `json:"id,omitempty"`
+	Model   string                   `json:"model,omitempty"`
+	Choices []OpenRouterStreamChoice `json:"choices"`
+	Usage   *Usage                   `json:"usage,omitempty"`
+	Error   *OpenRouterStreamError   `json:"error,omitempty"`
 }
 
 type Provider struct {
@@ -19,8 +92,63 @@ type Provider struct {
 	AllowFallbacks bool     `json:"allow_fallbacks,omitempty"`
 }
 
+// SamplingParams are optional generation settings, nil means the provider's default
+type SamplingParams struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"top_p,omitempty"`
+	MaxTokens        *int     `json:"max_tokens,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+	PresencePenalty  *float64 `json:"presence_penalty,omitempty"`
+	FrequencyPenalty *float64 `json:"frequency_penalty,omitempty"`
+}
+
 type OpenRouterRequest struct {
 	Model    string              `json:"model"`
 	Messages []OpenRouterMessage `json:"messages"`
 	Provider *Provider           `json:"provider,omitempty"`
+	Stream   bool                `json:"stream,omitempty"`
+	Tools    []Tool              `json:"tools,omitempty"`
+	// ToolChoice is "auto" or "none", empty leaves it to the provider
+	ToolChoice string `json:"tool_choice,omitempty"`
+	// Usage asks OpenRouter to report the cost, StreamOptions asks for usage at the end of a stream
+	Usage         *UsageOptions  `json:"usage,omitempty"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+	// ResponseFormat constrains the reply to JSON, for models that support structured outputs
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	SamplingParams
+}
+
+type ResponseFormat struct {
+	// Type is "json_schema" or "json_object"
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+type JSONSchemaFormat struct {
+	Name   string          `json:"name"`
+	Strict bool            `json:"strict"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+type UsageOptions struct {
+	Include bool `json:"include"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// Embeddings (OpenAI-compatible /embeddings endpoint)
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type EmbeddingData struct {
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+type EmbeddingResponse struct {
+	Data []EmbeddingData `json:"data"`
 }
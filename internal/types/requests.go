@@ -13,3 +13,20 @@ type RegisterPhoneNumberRequest struct {
 	UnityID     string `json:"unity_id" binding:"required"`
 	PhoneNumber string `json:"phone_number" binding:"required"`
 }
+
+// PromptPreviewRequest renders a prompt template. Template replaces the loaded one when set,
+// the other fields stand in for what the game would fill in.
+type PromptPreviewRequest struct {
+	Channel  string   `json:"channel" binding:"required"`
+	NpcID    string   `json:"npc_id"`
+	Template string   `json:"template"`
+	Events   []string `json:"events"`
+	Summary  string   `json:"summary"`
+	Memory   []string `json:"memory"`
+	Lore     []string `json:"lore"`
+	Details  string   `json:"details"`
+}
+
+type PromptReloadRequest struct {
+	Version string `json:"version"`
+}
@@ -15,3 +15,61 @@ type RegisterPhoneNumberResponse struct {
 	PhoneNumber string `json:"phone_number"`
 	Message     string `json:"message"`
 }
+
+type UsageResponse struct {
+	Since   string       `json:"since"`
+	ByNPC   []UsageTotal `json:"by_npc"`
+	ByModel []UsageTotal `json:"by_model"`
+}
+
+type FlagCountsResponse struct {
+	Since  string      `json:"since"`
+	Counts []FlagCount `json:"counts"`
+}
+
+type PromptsResponse struct {
+	Version   string            `json:"version"`
+	Source    string            `json:"source"`
+	Templates map[string]string `json:"templates"`
+}
+
+type PromptPreviewResponse struct {
+	Prompt string `json:"prompt"`
+	Tokens int    `json:"tokens"`
+}
+
+type RelationshipsResponse struct {
+	UnityID       string           `json:"id"`
+	Relationships []DBRelationship `json:"relationships"`
+}
+
+type LoreSearchResponse struct {
+	Query string `json:"query"`
+	NpcID string `json:"npc_id,omitempty"`
+	// Chunks is how many chunks are indexed
+	Chunks  int          `json:"chunks"`
+	Results []LoreResult `json:"results"`
+}
+
+type LoreResult struct {
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Text    string   `json:"text"`
+	KnownBy []string `json:"known_by,omitempty"`
+	Score   float64  `json:"score"`
+}
+
+// WhereaboutsResponse is where an NPC is. Scheduled is false when their schedule doesn't cover
+// the time, or the time isn't known, and Location is their usual spot.
+type WhereaboutsResponse struct {
+	NpcId     string `json:"npcId"`
+	Time      string `json:"time,omitempty"`
+	Location  string `json:"location"`
+	Activity  string `json:"activity,omitempty"`
+	Scheduled bool   `json:"scheduled"`
+}
+
+type QuestsResponse struct {
+	UnityID string    `json:"id"`
+	Quests  []DBQuest `json:"quests"`
+}
@@ -1,56 +1,132 @@
 package ws
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"rd-backend/internal/ai"
+	"rd-backend/internal/ai/npc"
+	"rd-backend/internal/clock"
 	"rd-backend/internal/db"
+	"rd-backend/internal/events"
+	"rd-backend/internal/gossip"
+	"rd-backend/internal/memory"
+	"rd-backend/internal/quests"
+	"rd-backend/internal/ratelimit"
+	"rd-backend/internal/relationships"
+	"rd-backend/internal/scene"
 	"rd-backend/internal/types"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
+// How far back to look for chat context. The AI handler trims these down to
+// whatever fits the model's token budget.
+const (
+	historyCandidates = 50
+	eventCandidates   = 20
+)
+
 type WSHandler struct {
-	upgrader  websocket.Upgrader
-	aiHandler *ai.AIHandler
-	dbHandler *db.DBHandler
+	upgrader      websocket.Upgrader
+	aiHandler     *ai.AIHandler
+	dbHandler     *db.DBHandler
+	summarizer    *memory.Summarizer
+	indexer       *memory.Indexer
+	limiter       ratelimit.Limiter
+	eventRegistry *events.Registry
+	tracker       *relationships.Tracker
+	gossip        *gossip.Network
+	scenes        *scene.Orchestrator
+	clock         *clock.Clock
+	quests        *quests.Board
+}
+
+// client is a websocket connection that is safe to write to from more than one goroutine,
+// relationship changes can be pushed while a reply is streaming
+type client struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (c *client) WriteJSON(v any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.WriteJSON(v)
 }
 
-func NewWebsocketHandler(dbHandler *db.DBHandler, aiHandler *ai.AIHandler) *WSHandler {
+func NewWebsocketHandler(dbHandler *db.DBHandler, aiHandler *ai.AIHandler, summarizer *memory.Summarizer, indexer *memory.Indexer, limiter ratelimit.Limiter, eventRegistry *events.Registry, tracker *relationships.Tracker, gossip *gossip.Network, scenes *scene.Orchestrator, clock *clock.Clock, quests *quests.Board) *WSHandler {
 	return &WSHandler{
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true
 			},
 		},
-		aiHandler: aiHandler,
-		dbHandler: dbHandler,
+		aiHandler:     aiHandler,
+		dbHandler:     dbHandler,
+		summarizer:    summarizer,
+		indexer:       indexer,
+		limiter:       limiter,
+		eventRegistry: eventRegistry,
+		tracker:       tracker,
+		gossip:        gossip,
+		scenes:        scenes,
+		clock:         clock,
+		quests:        quests,
 	}
 }
 
 func (h *WSHandler) Handle(c *gin.Context) {
 	// Get and validate Unity ID
 	unityID := c.Query("unity_id")
-	exists, err := h.dbHandler.GetPlayerByUnityId(unityID)
-	if err != nil || exists == nil {
+	player, err := h.dbHandler.GetPlayerByUnityId(unityID)
+	if err != nil || player == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "player not found"})
 		return
 	}
 
 	// If auth passes, upgrade to WebSocket
-	ws, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		createErrorMessage("Upgrade Error: " + err.Error())
 		return
 	}
 
-	defer ws.Close()
+	defer conn.Close()
+	ws := &client{conn: conn}
+
+	// The game reports its time again when the player reconnects
+	defer h.clock.Forget(player.UnityID)
+
+	// Push relationship changes as they happen, judging an exchange finishes after the reply
+	unsubscribe := h.tracker.Subscribe(player.UnityID, func(relationship types.RelationshipResponse) {
+		content, _ := json.Marshal(relationship)
+		ws.WriteJSON(types.WSResponse{
+			Type:    "relationship",
+			Content: content,
+		})
+	})
+	defer unsubscribe()
+
+	// Quests change when NPCs offer them in conversation and when events move them along
+	unsubscribeQuests := h.quests.Subscribe(player.UnityID, func(quest types.DBQuest) {
+		content, _ := json.Marshal(quest)
+		ws.WriteJSON(types.WSResponse{
+			Type:    "quest",
+			Content: content,
+		})
+	})
+	defer unsubscribeQuests()
 
 	for {
 		var msg types.Message
-		err := ws.ReadJSON(&msg)
+		err := conn.ReadJSON(&msg)
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				createErrorMessage("Upgrade Error: " + err.Error())
@@ -58,12 +134,12 @@ func (h *WSHandler) Handle(c *gin.Context) {
 			break
 		}
 
-		response := h.handleMessage(msg)
+		response := h.handleMessage(ws, player, msg)
 		ws.WriteJSON(response)
 	}
 }
 
-func (h *WSHandler) handleMessage(msg types.Message) types.WSResponse {
+func (h *WSHandler) handleMessage(ws *client, player *types.Player, msg types.Message) types.WSResponse {
 	switch msg.Type {
 	case "chat":
 		var chatMsg types.ChatMessage
@@ -72,51 +148,93 @@ func (h *WSHandler) handleMessage(msg types.Message) types.WSResponse {
 			log.Printf("Error Parsing Message to Chat Message: %v", err)
 			return createErrorMessage("Invalid Chat Message")
 		}
-		return h.handleChatMessage(&chatMsg)
+		if response, limited := h.checkLimit(player, &chatMsg); limited {
+			return response
+		}
+		if chatMsg.Stream {
+			return h.handleChatStream(ws, &chatMsg)
+		}
+		return h.handleChatMessage(ws, &chatMsg)
+	case "group_chat":
+		var groupMsg types.GroupChatMessage
+		if err := json.Unmarshal(msg.Content, &groupMsg); err != nil {
+			log.Printf("Error Parsing Message to Group Chat Message: %v", err)
+			return createErrorMessage("Invalid Group Chat Message")
+		}
+		return h.handleGroupChat(ws, player, &groupMsg)
 	case "system":
 		var systemMsg types.ChatMessage
 		if err := json.Unmarshal(msg.Content, &systemMsg); err != nil {
 			log.Printf("Error Parsing Message to System Message: %v", err)
 			return createErrorMessage("Invalid System Message")
 		}
-		return h.handleSystemMessage(&systemMsg)
+		if response, limited := h.checkLimit(player, &systemMsg); limited {
+			response.Type = "system"
+			return response
+		}
+		return h.handleSystemMessage(ws, &systemMsg)
+	case "suggest":
+		var suggestMsg types.SuggestMessage
+		if err := json.Unmarshal(msg.Content, &suggestMsg); err != nil {
+			log.Printf("Error Parsing Message to Suggest Message %v", err)
+			return createErrorMessage("Invalid Suggest Message")
+		}
+		return h.handleSuggestMessage(player, &suggestMsg)
+	case "clock":
+		var clockMsg types.ClockMessage
+		if err := json.Unmarshal(msg.Content, &clockMsg); err != nil {
+			log.Printf("Error Parsing Message to Clock Message %v", err)
+			return createErrorMessage("Invalid Clock Message")
+		}
+		return h.handleClockMessage(player, &clockMsg)
 	case "event":
 		var eventMsg types.EventMessage
 		if err := json.Unmarshal(msg.Content, &eventMsg); err != nil {
 			log.Printf("Error Parsing Message to Event Message %v", err)
 			return createErrorMessage("Invalid Event Message")
 		}
-		return h.handleEventMessage(&eventMsg)
+		return h.handleEventMessage(player, &eventMsg)
 	default:
 		return createErrorMessage("Unknown Message Type")
 	}
 }
 
 // "chat"
-func (h *WSHandler) handleChatMessage(msg *types.ChatMessage) types.WSResponse {
-	history, err := h.dbHandler.GetLastMessagesFromDB(msg.UnityID, 4)
+func (h *WSHandler) handleChatMessage(ws *client, msg *types.ChatMessage) types.WSResponse {
+	history, err := h.dbHandler.GetLastMessagesWithNPC(msg.UnityID, msg.NpcId, historyCandidates)
 	if err != nil {
 		return createErrorMessage(err.Error())
 	}
 
-	eventHistory, err := h.dbHandler.GetLastEventsFromDB(msg.UnityID, 4)
+	eventHistory, err := h.dbHandler.GetLastEventsFromDB(msg.UnityID, eventCandidates)
 	if err != nil {
 		return createErrorMessage("Could not get last events from Database")
 	}
 
-	h.dbHandler.AddMessageToDatabase(msg.UnityID, msg.Text, "player", msg.NpcId)
+	summary := h.summarizer.Summary(msg.UnityID, msg.NpcId)
+
+	input := h.storePlayerMessage(msg)
 
-	completion, err := h.aiHandler.GetChatCompletion(msg.Text, history, eventHistory, "user", msg.NpcId)
+	completion, err := h.aiHandler.GetChatCompletion(msg.UnityID, input, history, eventHistory, summary, "user", msg.NpcId, msg.Suggestions)
 	if err != nil || completion == nil {
 		return createErrorMessage(err.Error())
 	}
 
+	sendActions(ws, completion.Actions)
+
 	response := types.ChatResponse{
-		Completion: *completion,
-		NpcId:      msg.NpcId,
+		Completion:  completion.Completion,
+		NpcId:       msg.NpcId,
+		Expression:  completion.Expression,
+		Suggestions: completion.Suggestions,
 	}
 
-	h.dbHandler.AddMessageToDatabase(msg.UnityID, response.Completion, msg.NpcId, "player")
+	if !input.Blocked() {
+		h.dbHandler.AddReplyToDatabase(msg.UnityID, response.Completion, msg.NpcId, "player", response.Expression)
+		h.indexer.Remember(msg.UnityID, msg.NpcId, types.MemoryKindNPC, response.Completion)
+		h.summarizer.Update(msg.UnityID, msg.NpcId)
+		h.tracker.AfterExchange(msg.UnityID, msg.NpcId, input.Text, completion.Completion, completion.Actions)
+	}
 
 	content, _ := json.Marshal(response)
 
@@ -126,29 +244,168 @@ func (h *WSHandler) handleChatMessage(msg *types.ChatMessage) types.WSResponse {
 	}
 }
 
+// "chat" with stream set: sends "chat_delta" frames as text arrives and returns the "chat_done" frame
+func (h *WSHandler) handleChatStream(ws *client, msg *types.ChatMessage) types.WSResponse {
+	history, err := h.dbHandler.GetLastMessagesWithNPC(msg.UnityID, msg.NpcId, historyCandidates)
+	if err != nil {
+		return createErrorMessage(err.Error())
+	}
+
+	eventHistory, err := h.dbHandler.GetLastEventsFromDB(msg.UnityID, eventCandidates)
+	if err != nil {
+		return createErrorMessage("Could not get last events from Database")
+	}
+
+	summary := h.summarizer.Summary(msg.UnityID, msg.NpcId)
+
+	input := h.storePlayerMessage(msg)
+
+	messageID := newMessageID()
+
+	completion, err := h.aiHandler.GetChatCompletionStream(msg.UnityID, input, history, eventHistory, summary, "user", msg.NpcId, msg.Suggestions, func(delta string) error {
+		content, _ := json.Marshal(types.ChatDeltaResponse{
+			MessageID: messageID,
+			NpcId:     msg.NpcId,
+			Delta:     delta,
+		})
+
+		return ws.WriteJSON(types.WSResponse{
+			Type:    "chat_delta",
+			Content: content,
+		})
+	})
+
+	// Keep whatever the NPC said, even if the stream was cut short
+	if completion != nil && completion.Completion != "" && !input.Blocked() {
+		h.dbHandler.AddReplyToDatabase(msg.UnityID, completion.Completion, msg.NpcId, "player", completion.Expression)
+		h.indexer.Remember(msg.UnityID, msg.NpcId, types.MemoryKindNPC, completion.Completion)
+		h.summarizer.Update(msg.UnityID, msg.NpcId)
+	}
+
+	if err != nil {
+		log.Printf("Chat stream %s for %s aborted: %v", messageID, msg.UnityID, err)
+		if completion == nil || completion.Completion == "" {
+			return createErrorMessage(err.Error())
+		}
+	}
+
+	sendActions(ws, completion.Actions)
+	if err == nil && !input.Blocked() {
+		h.tracker.AfterExchange(msg.UnityID, msg.NpcId, input.Text, completion.Completion, completion.Actions)
+	}
+
+	response := types.ChatDoneResponse{
+		MessageID:   messageID,
+		NpcId:       msg.NpcId,
+		Completion:  completion.Completion,
+		Aborted:     err != nil,
+		Replaced:    completion.Moderated,
+		Expression:  completion.Expression,
+		Suggestions: completion.Suggestions,
+	}
+
+	content, _ := json.Marshal(response)
+
+	return types.WSResponse{
+		Type:    "chat_done",
+		Content: content,
+	}
+}
+
+// storePlayerMessage screens the player's chat message and keeps what's left of it. Blocked
+// messages aren't kept, so they can't come back through history, memory or summaries.
+func (h *WSHandler) storePlayerMessage(msg *types.ChatMessage) ai.ScreenedInput {
+	input := h.aiHandler.ScreenInput(msg.UnityID, msg.NpcId, msg.Text)
+	if input.Blocked() {
+		return input
+	}
+
+	h.dbHandler.AddMessageToDatabase(msg.UnityID, input.Text, "player", msg.NpcId)
+	h.indexer.Remember(msg.UnityID, msg.NpcId, types.MemoryKindPlayer, input.Text)
+	return input
+}
+
+// "group_chat": sends a "chat" frame for every NPC line and returns the "group_done" frame
+func (h *WSHandler) handleGroupChat(ws *client, player *types.Player, msg *types.GroupChatMessage) types.WSResponse {
+	// One player message counts once, however many NPCs answer it. The limit is checked before
+	// the scene is looked up so limited players can't keep creating scenes; resumed scenes
+	// don't name their NPCs, which gets the default break line.
+	var firstNPC string
+	if len(msg.NpcIds) > 0 {
+		firstNPC = msg.NpcIds[0]
+	}
+	if response, limited := h.checkLimit(player, &types.ChatMessage{UnityID: msg.UnityID, Text: msg.Text, NpcId: firstNPC}); limited {
+		return response
+	}
+
+	currentScene, err := h.scenes.Scene(msg.UnityID, msg.SceneId, msg.NpcIds, msg.Location)
+	if err != nil {
+		return createErrorMessage(err.Error())
+	}
+
+	turns, err := h.scenes.Play(currentScene, msg.Text, func(npcID string, result *ai.ChatResult) error {
+		sendActions(ws, result.Actions)
+		h.tracker.AfterExchange(msg.UnityID, npcID, msg.Text, result.Completion, result.Actions)
+
+		content, _ := json.Marshal(types.ChatResponse{
+			Completion: result.Completion,
+			NpcId:      npcID,
+			SceneId:    currentScene.ID,
+			Expression: result.Expression,
+		})
+
+		return ws.WriteJSON(types.WSResponse{
+			Type:    "chat",
+			Content: content,
+		})
+	})
+	if err != nil {
+		return createErrorMessage(err.Error())
+	}
+
+	content, _ := json.Marshal(types.GroupDoneResponse{
+		SceneId: currentScene.ID,
+		Turns:   turns,
+	})
+
+	return types.WSResponse{
+		Type:    "group_done",
+		Content: content,
+	}
+}
+
 // "system"
-func (h *WSHandler) handleSystemMessage(msg *types.ChatMessage) types.WSResponse {
-	history, err := h.dbHandler.GetLastMessagesFromDB(msg.UnityID, 4)
+func (h *WSHandler) handleSystemMessage(ws *client, msg *types.ChatMessage) types.WSResponse {
+	history, err := h.dbHandler.GetLastMessagesWithNPC(msg.UnityID, msg.NpcId, historyCandidates)
 	if err != nil {
 		return createErrorMessage("Could not get last messages from Database")
 	}
 
-	eventHistory, err := h.dbHandler.GetLastEventsFromDB(msg.UnityID, 4)
+	eventHistory, err := h.dbHandler.GetLastEventsFromDB(msg.UnityID, eventCandidates)
 	if err != nil {
 		return createErrorMessage("Could not get last events from Database")
 	}
 
-	completion, err := h.aiHandler.GetChatCompletion(msg.Text, history, eventHistory, "system", msg.NpcId)
+	summary := h.summarizer.Summary(msg.UnityID, msg.NpcId)
+
+	// System messages come from the game, not the player, so they aren't screened
+	completion, err := h.aiHandler.GetChatCompletion(msg.UnityID, ai.ScreenedInput{Text: msg.Text}, history, eventHistory, summary, "system", msg.NpcId, msg.Suggestions)
 	if err != nil || completion == nil {
 		return createErrorMessage(err.Error())
 	}
 
+	sendActions(ws, completion.Actions)
+
 	response := types.ChatResponse{
-		Completion: *completion,
-		NpcId:      msg.NpcId,
+		Completion:  completion.Completion,
+		NpcId:       msg.NpcId,
+		Expression:  completion.Expression,
+		Suggestions: completion.Suggestions,
 	}
 
-	h.dbHandler.AddMessageToDatabase(msg.UnityID, response.Completion, msg.NpcId, "player")
+	h.dbHandler.AddReplyToDatabase(msg.UnityID, response.Completion, msg.NpcId, "player", response.Expression)
+	h.indexer.Remember(msg.UnityID, msg.NpcId, types.MemoryKindNPC, response.Completion)
+	h.summarizer.Update(msg.UnityID, msg.NpcId)
 
 	content, _ := json.Marshal(response)
 
@@ -158,39 +415,202 @@ func (h *WSHandler) handleSystemMessage(msg *types.ChatMessage) types.WSResponse
 	}
 }
 
-func (h *WSHandler) handleEventMessage(msg *types.EventMessage) types.WSResponse {
-	log.Printf(msg.EventDetails)
-	detailsDecription, err := h.aiHandler.GetDescriptionCompletion(msg.EventDetails)
+func (h *WSHandler) handleEventMessage(player *types.Player, msg *types.EventMessage) types.WSResponse {
+	// Events are still recorded over the limits, just without a model call to describe them
+	_, limited := h.limited(player)
+	if err := h.recordEvent(msg.UnityID, msg.EventType, msg.EventDetails, !limited); err != nil {
+		return createErrorMessage(err.Error())
+	}
+
+	response := types.EventResponse{
+		EventType: msg.EventType,
+	}
+
+	content, _ := json.Marshal(response)
 
+	return types.WSResponse{
+		Type:    "event",
+		Content: content,
+	}
+}
+
+// "suggest": reply options for the player's next line to the NPC
+func (h *WSHandler) handleSuggestMessage(player *types.Player, msg *types.SuggestMessage) types.WSResponse {
+	// Suggestions cost a model call too, so they count against the same limits as chat
+	if decision, limited := h.limited(player); limited {
+		content, _ := json.Marshal(types.SuggestionsResponse{
+			NpcId:       msg.NpcId,
+			Suggestions: []types.Suggestion{},
+			RetryAfter:  int(decision.RetryAfter.Seconds()) + 1,
+		})
+		return types.WSResponse{Type: "suggestions", Content: content}
+	}
+
+	history, err := h.dbHandler.GetLastMessagesWithNPC(msg.UnityID, msg.NpcId, historyCandidates)
 	if err != nil {
-		log.Printf("Could not create text description of json")
-		return createErrorMessage("could not create text description of JSON")
+		return createErrorMessage(err.Error())
 	}
 
-	log.Printf(*detailsDecription)
+	count := msg.Count
+	if count == 0 {
+		count = ai.DefaultSuggestions
+	}
+
+	suggestions, err := h.aiHandler.SuggestReplies(msg.UnityID, msg.NpcId, history, count)
+	if err != nil {
+		return createErrorMessage(err.Error())
+	}
+
+	content, _ := json.Marshal(types.SuggestionsResponse{
+		NpcId:       msg.NpcId,
+		Suggestions: suggestions,
+	})
+
+	return types.WSResponse{
+		Type:    "suggestions",
+		Content: content,
+	}
+}
+
+// recordEvent stores what the player did and lets the NPCs and quests react to it. Quests it
+// completes are recorded as quest_completed events in turn. Without useModel, events with no
+// template or cached description are stored as their raw JSON.
+func (h *WSHandler) recordEvent(unityID string, eventType string, details string, useModel bool) error {
+	log.Printf(details)
+	var detailsDecription string
+	if useModel {
+		var err error
+		detailsDecription, err = h.eventRegistry.Describe(unityID, eventType, details)
+		if err != nil {
+			log.Printf("Could not create text description of json")
+			return fmt.Errorf("could not create text description of JSON")
+		}
+	} else {
+		detailsDecription = h.eventRegistry.DescribeWithoutModel(eventType, details)
+	}
+
+	log.Printf(detailsDecription)
 
 	event := types.DBPlayerEvent{
-		UnityID:      msg.UnityID,
-		EventType:    msg.EventType,
-		EventDetails: *detailsDecription,
+		UnityID:      unityID,
+		EventType:    eventType,
+		EventDetails: detailsDecription,
 	}
 
-	if err := h.dbHandler.AddEventToDatabase(event.UnityID, event.EventType, event.EventDetails); err != nil {
-		return createErrorMessage(err.Error())
+	eventID, err := h.dbHandler.AddEventToDatabase(event.UnityID, event.EventType, event.EventDetails)
+	if err != nil {
+		return err
 	}
 
-	response := types.EventResponse{
-		EventType: event.EventType,
+	// Only NPCs who were there know about it and remember it, the rest hear it through gossip
+	h.gossip.Witness(event.UnityID, eventID, event.EventType, details, event.EventDetails)
+	h.tracker.AfterEvent(unityID, eventType, details)
+
+	for _, quest := range h.quests.Advance(unityID, eventType, details) {
+		if quest.State != types.QuestComplete {
+			continue
+		}
+
+		completed, _ := json.Marshal(map[string]string{
+			"quest": quest.Title,
+			"giver": quest.NpcID,
+		})
+		if err := h.recordEvent(unityID, "quest_completed", string(completed), useModel); err != nil {
+			log.Printf("Could not record completion of quest %d: %v", quest.ID, err)
+		}
 	}
 
-	content, _ := json.Marshal(response)
+	return nil
+}
+
+// "clock": the game time NPC schedules follow
+func (h *WSHandler) handleClockMessage(player *types.Player, msg *types.ClockMessage) types.WSResponse {
+	minute, err := npc.ParseClock(msg.Time)
+	if err != nil {
+		return createErrorMessage(err.Error())
+	}
+	if msg.Scale < 0 || msg.Scale > clock.MaxScale {
+		return createErrorMessage(fmt.Sprintf("scale must be between 0 and %d", clock.MaxScale))
+	}
+
+	h.clock.Set(player.UnityID, minute, msg.Scale)
+
+	content, _ := json.Marshal(types.ClockResponse{
+		Time: npc.FormatClock(minute),
+	})
 
 	return types.WSResponse{
-		Type:    "event",
+		Type:    "clock",
 		Content: content,
 	}
 }
 
+// checkLimit answers with the NPC's break line, without calling the model, when the
+// player has sent too many messages
+func (h *WSHandler) checkLimit(player *types.Player, msg *types.ChatMessage) (types.WSResponse, bool) {
+	decision, limited := h.limited(player)
+	if !limited {
+		return types.WSResponse{}, false
+	}
+
+	completion := h.aiHandler.GetBreakLine(msg.NpcId)
+	retryAfter := int(decision.RetryAfter.Seconds()) + 1
+
+	if msg.Stream {
+		content, _ := json.Marshal(types.ChatDoneResponse{
+			MessageID:  newMessageID(),
+			NpcId:      msg.NpcId,
+			Completion: completion,
+			RetryAfter: retryAfter,
+		})
+		return types.WSResponse{Type: "chat_done", Content: content}, true
+	}
+
+	content, _ := json.Marshal(types.ChatResponse{
+		Completion: completion,
+		NpcId:      msg.NpcId,
+		RetryAfter: retryAfter,
+	})
+	return types.WSResponse{Type: "chat", Content: content}, true
+}
+
+// limited takes one request from the player's ws limits and quotas, returning the decision and
+// whether the player is over them
+func (h *WSHandler) limited(player *types.Player) (ratelimit.Decision, bool) {
+	decision, err := h.limiter.Allow(player.UnityID, ratelimit.ChannelWS, player.Tier)
+	if err != nil {
+		// Better to let a message through than lock everyone out while the limiter is down
+		log.Printf("Rate limiter failed for %s: %v", player.UnityID, err)
+		return decision, false
+	}
+	if decision.Allowed {
+		return decision, false
+	}
+
+	log.Printf("Limited %s (%s), retry in %s", player.UnityID, decision.Reason, decision.RetryAfter.Round(time.Second))
+	return decision, true
+}
+
+// sendActions forwards the game actions an NPC took as "action" frames
+func sendActions(ws *client, actions []types.ActionResponse) {
+	for _, action := range actions {
+		content, _ := json.Marshal(action)
+		ws.WriteJSON(types.WSResponse{
+			Type:    "action",
+			Content: content,
+		})
+	}
+}
+
+// newMessageID returns a random ID the client uses to stitch chat_delta frames together
+func newMessageID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
 func createErrorMessage(msg string) types.WSResponse {
 	content, _ := json.Marshal(map[string]string{
 		"error": msg,